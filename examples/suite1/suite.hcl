@@ -0,0 +1,72 @@
+suitename = "suite1"
+
+variable "foo" {
+  default = "bar"
+}
+
+variable "baz" {
+  default = 5
+}
+
+testcase {
+  casename = "case1"
+
+  step {
+    stepname = "step1"
+  }
+
+  step {
+    stepname = "post-trailer"
+    after    = ["trailer"]
+  }
+
+  step {
+    id       = "trailer"
+    stepname = "trailer"
+    after    = ["1", "s2", "5"]
+  }
+
+  step {
+    id       = "s2"
+    stepname = "step2"
+    before   = ["1"]
+  }
+
+  step {
+    stepname = "step3"
+    after    = ["s2"]
+  }
+
+  step {
+    id       = "pre-trailer"
+    stepname = "pre-trailer"
+    before   = ["trailer"]
+  }
+
+  fixture {
+    fixturename = "fixname1"
+    some_rando  = "blah ${upper(foo)} ${baz}"
+  }
+}
+
+testcase {
+  casename = "case2"
+
+  step {
+    id       = "greet"
+    stepname = "case2.step1"
+    type     = "exec"
+    command  = "echo"
+    args     = ["hello", fixture.greeting.name]
+  }
+
+  step {
+    stepname = "case2.step2"
+    output   = upper(step.greet.stdout)
+  }
+
+  fixture {
+    fixturename = "greeting"
+    name        = foo
+  }
+}
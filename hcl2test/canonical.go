@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/hashicorp/hcl2/hclwrite"
+)
+
+// attributeRank orders the attributes of a block: names and ids first, then
+// explicit dependencies, then everything else in its original order.
+var attributeRank = map[string]int{
+	"suitename":   0,
+	"casename":    0,
+	"stepname":    0,
+	"fixturename": 0,
+	"id":          1,
+	"for_each":    1,
+	"use":         1,
+	"before":      2,
+	"after":       3,
+}
+
+const otherAttributeRank = 4
+
+// blockRank orders the nested blocks of a body. Blocks of the same rank keep
+// their original order, which matters for steps since their positional ids
+// follow it, and modules stay among the steps they are used by.
+var blockRank = map[string]int{
+	"include":       0,
+	"variable":      1,
+	"locals":        2,
+	"matrix":        3,
+	"fixture":       4,
+	"step_template": 5,
+	"step":          6,
+	"module":        6,
+}
+
+const otherBlockRank = 7
+
+// canonicalize reorders the content of a suite file into the conventional
+// layout and then formats it.
+//
+// The hclwrite parser in the vendored HCL cannot handle labelled blocks, such
+// as variable blocks, so the items are located the same way it does: using
+// the source ranges of the hclsyntax AST to partition the raw tokens. As in
+// hclwrite, lead comments and comments on the same line travel with the item
+// they describe.
+func canonicalize(src []byte, filename string) ([]byte, hcl.Diagnostics) {
+	start := hcl.Pos{Byte: 0, Line: 1, Column: 1}
+	f, diags := hclsyntax.ParseConfig(src, filename, start)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	tokens, diags := hclsyntax.LexConfig(src, filename, start)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	c := &canonicalizer{src: src, tokens: tokens}
+	var buf bytes.Buffer
+	c.writeBody(&buf, f.Body.(*hclsyntax.Body), 0, len(tokens)-1)
+	return hclwrite.Format(buf.Bytes()), nil
+}
+
+type canonicalizer struct {
+	src    []byte
+	tokens hclsyntax.Tokens
+}
+
+// bodyItem is an attribute or block together with the tokens that belong to
+// it. Tokens [gap, lead) are blank lines and comments separating it from the
+// previous item, [lead, end) are its lead comments, the item itself and its
+// line comments and newline.
+type bodyItem struct {
+	node      hclsyntax.Node
+	rank      int
+	gap       int
+	lead, end int
+}
+
+// writeBody writes the items of body, which occupy tokens [from, to), in
+// canonical order.
+func (c *canonicalizer) writeBody(buf *bytes.Buffer, body *hclsyntax.Body, from, to int) {
+	nodes := make([]hclsyntax.Node, 0, len(body.Attributes)+len(body.Blocks))
+	for _, attr := range body.Attributes {
+		nodes = append(nodes, attr)
+	}
+	for _, block := range body.Blocks {
+		nodes = append(nodes, block)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Range().Start.Byte < nodes[j].Range().Start.Byte
+	})
+
+	items := make([]*bodyItem, 0, len(nodes))
+	cursor := from
+	for _, node := range nodes {
+		item := &bodyItem{node: node, gap: cursor}
+		switch n := node.(type) {
+		case *hclsyntax.Attribute:
+			item.rank = otherAttributeRank
+			if rank, ok := attributeRank[n.Name]; ok {
+				item.rank = rank
+			}
+		case *hclsyntax.Block:
+			item.rank = otherAttributeRank + 1 + otherBlockRank
+			if rank, ok := blockRank[n.Type]; ok {
+				item.rank = otherAttributeRank + 1 + rank
+			}
+		}
+
+		rng := node.Range()
+		first := c.tokenAt(rng.Start.Byte, cursor)
+		item.lead = first
+		for item.lead > cursor && c.tokens[item.lead-1].Type == hclsyntax.TokenComment {
+			item.lead--
+		}
+		item.end = c.lineEnd(c.tokenAt(rng.End.Byte, first))
+
+		items = append(items, item)
+		cursor = item.end
+	}
+
+	// Comments separated from the first item by a blank line, such as a
+	// file header, stay at the start of the body.
+	if len(items) > 0 {
+		if header := bytes.TrimSpace(c.span(items[0].gap, items[0].lead)); len(header) > 0 {
+			buf.Write(header)
+			buf.WriteString("\n\n")
+		}
+		items[0].gap = items[0].lead
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].rank < items[j].rank
+	})
+
+	for i, item := range items {
+		gap := bytes.TrimLeft(c.span(item.gap, item.lead), "\n")
+		_, isBlock := item.node.(*hclsyntax.Block)
+		if i > 0 && (isBlock || c.hasBlankLine(item.gap, item.lead)) {
+			buf.WriteByte('\n')
+		}
+		buf.Write(gap)
+		c.writeItem(buf, item)
+	}
+
+	// Comments after the last item stay at the end of the body.
+	if tail := bytes.TrimSpace(c.span(cursor, to)); len(tail) > 0 {
+		if len(items) > 0 && c.hasBlankLine(cursor, to) {
+			buf.WriteByte('\n')
+		}
+		buf.Write(tail)
+		buf.WriteByte('\n')
+	}
+}
+
+func (c *canonicalizer) writeItem(buf *bytes.Buffer, item *bodyItem) {
+	var out []byte
+	block, isBlock := item.node.(*hclsyntax.Block)
+	if isBlock {
+		obrace := c.tokenAt(block.OpenBraceRange.Start.Byte, item.lead)
+		cbrace := c.tokenAt(block.CloseBraceRange.Start.Byte, obrace)
+
+		// A block written on a single line has at most one item, so
+		// there is nothing to reorder.
+		if c.tokens[obrace+1].Type == hclsyntax.TokenNewline {
+			buf.Write(c.span(item.lead, obrace+2))
+			c.writeBody(buf, block.Body, obrace+2, cbrace)
+			out = c.span(cbrace, item.end)
+		} else {
+			out = c.span(item.lead, item.end)
+		}
+	} else {
+		out = c.span(item.lead, item.end)
+	}
+
+	buf.Write(out)
+	if !bytes.HasSuffix(out, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+}
+
+// tokenAt returns the index of the first token at or after the given byte
+// offset, searching from index from.
+func (c *canonicalizer) tokenAt(offset, from int) int {
+	for i := from; i < len(c.tokens); i++ {
+		if c.tokens[i].Range.Start.Byte >= offset {
+			return i
+		}
+	}
+	return len(c.tokens)
+}
+
+// lineEnd returns the index just after the comments and newline that follow
+// the item ending before token i. Single-line comments include their newline.
+func (c *canonicalizer) lineEnd(i int) int {
+	for ; i < len(c.tokens); i++ {
+		tok := c.tokens[i]
+		switch tok.Type {
+		case hclsyntax.TokenComment:
+			if bytes.HasSuffix(tok.Bytes, []byte("\n")) {
+				return i + 1
+			}
+		case hclsyntax.TokenNewline:
+			return i + 1
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// hasBlankLine reports whether tokens [from, to) start with a blank line.
+func (c *canonicalizer) hasBlankLine(from, to int) bool {
+	return from < to && c.tokens[from].Type == hclsyntax.TokenNewline
+}
+
+// span returns the source bytes of tokens [from, to), including the spaces
+// between them.
+func (c *canonicalizer) span(from, to int) []byte {
+	if from >= to {
+		return nil
+	}
+	return c.src[c.tokens[from].Range.Start.Byte:c.tokens[to-1].Range.End.Byte]
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		src, out string
+	}{
+		{
+			name: "suite",
+			src: `# Suite header.
+
+testcase "c" {
+  step "b" {
+    command = "b"
+    after   = ["a"] # runs second
+    type    = "exec"
+  }
+
+  // The first step.
+  step "a" {}
+
+  fixture "f" {
+    path = "f"
+  }
+  casename = "ignored"
+}
+
+variable "v" {
+  default = 1
+}
+
+suitename = "s"
+
+# Trailing comment.
+`,
+			out: `# Suite header.
+
+suitename = "s"
+
+variable "v" {
+  default = 1
+}
+
+testcase "c" {
+  casename = "ignored"
+
+  fixture "f" {
+    path = "f"
+  }
+
+  step "b" {
+    after   = ["a"] # runs second
+    command = "b"
+    type    = "exec"
+  }
+
+  // The first step.
+  step "a" {}
+}
+
+# Trailing comment.
+`,
+		},
+		{
+			name: "attribute ranks",
+			src: `step {
+  value  = 1
+  after  = ["x"]
+  before = ["y"]
+  id     = "s"
+  stepname = "n"
+}
+`,
+			out: `step {
+  stepname = "n"
+  id       = "s"
+  before   = ["y"]
+  after    = ["x"]
+  value    = 1
+}
+`,
+		},
+		{
+			name: "blocks of the same rank keep their order",
+			src: `testcase "c" {
+  step "2" {}
+  module "m" {
+    source = "m"
+  }
+  step "1" {}
+  step_template "t" {}
+  include {
+    path = "x.hcl"
+  }
+}
+`,
+			out: `testcase "c" {
+  include {
+    path = "x.hcl"
+  }
+
+  step_template "t" {}
+
+  step "2" {}
+
+  module "m" {
+    source = "m"
+  }
+
+  step "1" {}
+}
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, diags := canonicalize([]byte(test.src), "suite.hcl")
+			if diags.HasErrors() {
+				t.Fatal(diags.Error())
+			}
+			if string(out) != test.out {
+				t.Errorf("got\n%s\nwant\n%s", out, test.out)
+			}
+
+			again, _ := canonicalize(out, "suite.hcl")
+			if string(again) != string(out) {
+				t.Errorf("canonicalizing again gave\n%s", again)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeSyntaxError(t *testing.T) {
+	if _, diags := canonicalize([]byte("step {\n"), "suite.hcl"); !diags.HasErrors() {
+		t.Error("no error for invalid syntax")
+	}
+}
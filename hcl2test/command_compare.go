@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/sean-/hcl2tests/suite"
+)
+
+type jsonCompareFile struct {
+	Filename    string           `json:"filename"`
+	Equal       bool             `json:"equal"`
+	Differences []jsonDifference `json:"differences"`
+}
+
+type jsonDifference struct {
+	Path    string      `json:"path"`
+	Summary string      `json:"summary"`
+	HCL1    interface{} `json:"hcl1"`
+	HCL2    interface{} `json:"hcl2"`
+	Range   *jsonRange  `json:"range,omitempty"`
+}
+
+func compareCommand(args []string) int {
+	m := &meta{}
+	fs := m.flagSet("compare", "[paths...]")
+	if status, ok := m.parseFlags(fs, args); !ok {
+		return status
+	}
+
+	filenames, diags := suite.FindFiles(fs.Args())
+	if diags.HasErrors() {
+		return m.loadFailed(diags)
+	}
+
+	m.sources = make(map[string]*hcl.File)
+	var results []jsonCompareFile
+	differ := false
+	for _, filename := range filenames {
+		// HCL1 and HCL2 read JSON the same way.
+		if suite.IsJSONFile(filename) {
+			continue
+		}
+
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to read suite file",
+				Detail:   fmt.Sprintf("The file %q could not be read: %v.", filename, err),
+			})
+			continue
+		}
+		m.sources[filename] = &hcl.File{Bytes: src}
+
+		diffs, d := compare(src, filename)
+		diags = append(diags, d...)
+		if d.HasErrors() {
+			continue
+		}
+
+		result := jsonCompareFile{
+			Filename:    filename,
+			Equal:       len(diffs) == 0,
+			Differences: []jsonDifference{},
+		}
+		for _, diff := range diffs {
+			result.Differences = append(result.Differences, jsonDifference{
+				Path:    diff.Path,
+				Summary: diff.Summary,
+				HCL1:    jsonTree(diff.HCL1),
+				HCL2:    jsonTree(diff.HCL2),
+				Range:   newJSONRange(diff.Range),
+			})
+		}
+		results = append(results, result)
+		if len(diffs) > 0 {
+			differ = true
+		}
+
+		if m.format == formatJSON || len(diffs) == 0 {
+			continue
+		}
+		fmt.Printf("--- %s (HCL1)\n+++ %s (HCL2)\n", filename, filename)
+		for _, diff := range diffs {
+			path := diff.Path
+			if path == "" {
+				path = "(root)"
+			}
+			if diff.Range != nil {
+				fmt.Printf("@@ %s @@ %s (%s)\n", path, diff.Summary, diff.Range)
+			} else {
+				fmt.Printf("@@ %s @@ %s\n", path, diff.Summary)
+			}
+			if diff.Missing != 1 {
+				fmt.Printf("-%s\n", renderTree(diff.HCL1))
+			}
+			if diff.Missing != 2 {
+				fmt.Printf("+%s\n", renderTree(diff.HCL2))
+			}
+		}
+	}
+
+	if m.format == formatJSON {
+		m.writeJSON(struct {
+			Files       []jsonCompareFile `json:"files"`
+			Diagnostics []jsonDiagnostic  `json:"diagnostics"`
+		}{results, jsonDiagnostics(diags)})
+	} else {
+		m.showDiagnostics(diags)
+	}
+
+	switch {
+	case diags.HasErrors():
+		return exitConfig
+	case differ:
+		return exitFail
+	}
+	return exitPass
+}
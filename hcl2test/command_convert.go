@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/sean-/hcl2tests/suite"
+)
+
+type jsonConvertFile struct {
+	Filename string `json:"filename"`
+	Output   string `json:"output"`
+	Written  bool   `json:"written,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+func convertCommand(args []string) int {
+	m := &meta{}
+	fs := m.flagSet("convert", "[paths...]")
+	write := fs.Bool("w", false, "Write each converted file next to its source instead of to stdout. The source is kept and should be removed before the suite is loaded again.")
+	if status, ok := m.parseFlags(fs, args); !ok {
+		return status
+	}
+
+	filenames, diags := suite.FindFiles(fs.Args())
+	if diags.HasErrors() {
+		return m.loadFailed(diags)
+	}
+
+	m.loader = suite.NewLoader()
+	var results []jsonConvertFile
+	for _, filename := range filenames {
+		// Parse first so that syntax errors are reported by the HCL
+		// parsers, with the file available for the diagnostic snippets.
+		f, d := m.loader.ParseFile(filename)
+		diags = append(diags, d...)
+		if d.HasErrors() {
+			continue
+		}
+
+		var out []byte
+		if suite.IsJSONFile(filename) {
+			out, d = toHCL(f.Bytes, filename)
+		} else {
+			out, d = toJSON(f.Bytes, filename)
+		}
+		diags = append(diags, d...)
+		if d.HasErrors() {
+			continue
+		}
+
+		result := jsonConvertFile{
+			Filename: filename,
+			Output:   convertedName(filename),
+		}
+		if *write {
+			if err := ioutil.WriteFile(result.Output, out, 0644); err != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Failed to write suite file",
+					Detail:   fmt.Sprintf("The converted file %q could not be written: %v.", result.Output, err),
+				})
+				continue
+			}
+			result.Written = true
+		} else {
+			result.Content = string(out)
+		}
+		results = append(results, result)
+
+		if m.format == formatJSON {
+			continue
+		}
+		if *write {
+			fmt.Printf("%s -> %s\n", result.Filename, result.Output)
+		} else {
+			fmt.Printf("%s", out)
+		}
+	}
+
+	if m.format == formatJSON {
+		m.writeJSON(struct {
+			Files       []jsonConvertFile `json:"files"`
+			Diagnostics []jsonDiagnostic  `json:"diagnostics"`
+		}{results, jsonDiagnostics(diags)})
+	} else {
+		m.showDiagnostics(diags)
+	}
+
+	if diags.HasErrors() {
+		return exitConfig
+	}
+	return exitPass
+}
+
+// convertedName returns the name of the file that filename converts to:
+// suite.hcl becomes suite.hcl.json, and suite.hcl.json or suite.json become
+// suite.hcl.
+func convertedName(filename string) string {
+	if !suite.IsJSONFile(filename) {
+		return filename + ".json"
+	}
+	name := strings.TrimSuffix(filename, ".json")
+	if !strings.HasSuffix(name, ".hcl") {
+		name += ".hcl"
+	}
+	return name
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/sean-/hcl2tests/suite"
+)
+
+type jsonExplainDep struct {
+	Step string `json:"step"`
+	Kind string `json:"kind"`
+}
+
+type jsonExplainStep struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	Position   int               `json:"position"`
+	Range      *jsonRange        `json:"range"`
+	DependsOn  []jsonExplainDep  `json:"depends_on"`
+	RequiredBy []jsonExplainDep  `json:"required_by"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+type jsonExplainCase struct {
+	Name     string            `json:"name"`
+	Enabled  bool              `json:"enabled"`
+	Range    *jsonRange        `json:"range"`
+	Fixtures []string          `json:"fixtures"`
+	Steps    []jsonExplainStep `json:"steps"`
+}
+
+func explainCommand(args []string) int {
+	m := &meta{}
+	fs := m.loadFlagSet("explain", "<case>[/<step>] [paths...]")
+	if status, ok := m.parseFlags(fs, args); !ok {
+		return status
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return exitConfig
+	}
+
+	addr := fs.Arg(0)
+	ts, diags := m.load(fs.Args()[1:])
+	if diags.HasErrors() {
+		return m.loadFailed(diags)
+	}
+	m.showDiagnostics(diags)
+
+	caseName, stepID := addr, ""
+	if i := strings.Index(addr, "/"); i >= 0 {
+		caseName, stepID = addr[:i], addr[i+1:]
+	}
+
+	tc := ts.Case(caseName)
+	if tc == nil {
+		fmt.Fprintf(os.Stderr, "hcl2test: no testcase named %q\n", caseName)
+		return exitConfig
+	}
+
+	steps := tc.OrderedSteps()
+	if stepID != "" {
+		step, ok := tc.StepMap[stepID]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "hcl2test: no step %q in testcase %q\n", stepID, caseName)
+			return exitConfig
+		}
+		steps = []*suite.TestStep{step}
+	}
+
+	jc := jsonExplainCase{
+		Name:     tc.Name,
+		Enabled:  tc.Enabled,
+		Range:    newJSONRange(tc.DeclRange.Ptr()),
+		Fixtures: []string{},
+		Steps:    make([]jsonExplainStep, 0, len(steps)),
+	}
+	for _, fixture := range ts.CaseFixtures(tc) {
+		jc.Fixtures = append(jc.Fixtures, fixture.Name)
+	}
+	for _, step := range steps {
+		jc.Steps = append(jc.Steps, m.explainStep(tc, step))
+	}
+
+	if m.format == formatJSON {
+		m.writeJSON(jc)
+		return exitPass
+	}
+
+	state := "enabled"
+	if !tc.Enabled {
+		state = "disabled"
+	}
+	fmt.Printf("testcase %q (%s) declared at %s\n", tc.Name, state, tc.DeclRange)
+	fixtures := "none"
+	if len(jc.Fixtures) > 0 {
+		fixtures = strings.Join(jc.Fixtures, ", ")
+	}
+	fmt.Printf("  %s, fixtures: %s\n", plural(len(tc.TestSteps), "step"), fixtures)
+
+	for _, js := range jc.Steps {
+		fmt.Printf("\n%d. step %q (name %q, type %s)\n", js.Position, js.ID, js.Name, js.Type)
+		fmt.Printf("   declared at %s:%d\n", js.Range.Filename, js.Range.Start.Line)
+		for _, dep := range js.DependsOn {
+			fmt.Printf("   runs after %q (%s)\n", dep.Step, dep.Kind)
+		}
+		for _, dep := range js.RequiredBy {
+			fmt.Printf("   runs before %q (%s)\n", dep.Step, dep.Kind)
+		}
+
+		names := make([]string, 0, len(js.Attributes))
+		for name := range js.Attributes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("   %s = %s\n", name, js.Attributes[name])
+		}
+	}
+
+	return exitPass
+}
+
+func (m *meta) explainStep(tc *suite.TestCase, step *suite.TestStep) jsonExplainStep {
+	js := jsonExplainStep{
+		ID:         step.ID(),
+		Name:       step.Name,
+		Type:       step.Type,
+		Range:      newJSONRange(step.DeclRange.Ptr()),
+		DependsOn:  []jsonExplainDep{},
+		RequiredBy: []jsonExplainDep{},
+		Attributes: map[string]string{},
+	}
+
+	for i, s := range tc.OrderedSteps() {
+		if s == step {
+			js.Position = i + 1
+		}
+	}
+	for _, dep := range tc.Dependencies(step) {
+		js.DependsOn = append(js.DependsOn, jsonExplainDep{Step: dep.From.ID(), Kind: dep.Kind.String()})
+	}
+	for _, dep := range tc.Dependents(step) {
+		js.RequiredBy = append(js.RequiredBy, jsonExplainDep{Step: dep.To.ID(), Kind: dep.Kind.String()})
+	}
+
+	// Nested blocks are not attributes, so errors here are expected and
+	// the attributes that could be read are still shown.
+	attrs, _ := step.Config.JustAttributes()
+	for name, attr := range attrs {
+		js.Attributes[name] = m.sourceText(attr.Expr.Range())
+	}
+
+	return js
+}
+
+// sourceText returns the source code covered by rng.
+func (m *meta) sourceText(rng hcl.Range) string {
+	f := m.files()[rng.Filename]
+	if f == nil || !rng.CanSliceBytes(f.Bytes) {
+		return "(unknown)"
+	}
+	return string(rng.SliceBytes(f.Bytes))
+}
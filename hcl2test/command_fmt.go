@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hclwrite"
+	"github.com/sean-/hcl2tests/suite"
+)
+
+type jsonFmtFile struct {
+	Filename string `json:"filename"`
+	Changed  bool   `json:"changed"`
+	Written  bool   `json:"written,omitempty"`
+	Diff     string `json:"diff,omitempty"`
+}
+
+func fmtCommand(args []string) int {
+	m := &meta{}
+	fs := m.flagSet("fmt", "[paths...]")
+	write := fs.Bool("w", false, "Write the result to the source files instead of stdout.")
+	check := fs.Bool("check", false, "List the files that are not formatted and exit with status 1 if there are any.")
+	showDiff := fs.Bool("diff", false, "Print a unified diff of the changes instead of the formatted files.")
+	canonical := fs.Bool("canonical", false, "Also reorder attributes and blocks into the conventional layout.")
+	upgradeLabels := fs.Bool("upgrade", false, "Also rewrite testcase, step and fixture blocks named by attributes into labelled blocks.")
+	if status, ok := m.parseFlags(fs, args); !ok {
+		return status
+	}
+	if *write && *check {
+		fmt.Fprintln(os.Stderr, "hcl2test: -w and -check cannot be combined")
+		return exitConfig
+	}
+
+	filenames, diags := suite.FindFiles(fs.Args())
+	if diags.HasErrors() {
+		return m.loadFailed(diags)
+	}
+
+	m.loader = suite.NewLoader()
+	var results []jsonFmtFile
+	unformatted := 0
+	for _, filename := range filenames {
+		// JSON suites are usually generated and have no canonical layout
+		// of their own.
+		if suite.IsJSONFile(filename) {
+			continue
+		}
+
+		// Refuse to format files that do not parse, since the result of
+		// formatting invalid input is rarely what the author intended.
+		f, d := m.loader.ParseFile(filename)
+		diags = append(diags, d...)
+		if d.HasErrors() {
+			continue
+		}
+
+		src := f.Bytes
+		out := hclwrite.Format(src)
+		if *upgradeLabels {
+			out, d = upgrade(src, filename)
+			diags = append(diags, d...)
+			if d.HasErrors() {
+				continue
+			}
+		}
+		if *canonical {
+			out, d = canonicalize(out, filename)
+			diags = append(diags, d...)
+			if d.HasErrors() {
+				continue
+			}
+		}
+		result := jsonFmtFile{
+			Filename: filename,
+			Changed:  string(src) != string(out),
+		}
+		if result.Changed {
+			unformatted++
+		}
+
+		if result.Changed && *write {
+			if err := writeFile(filename, out); err != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Failed to write suite file",
+					Detail:   fmt.Sprintf("The formatted file %q could not be written: %v.", filename, err),
+				})
+				continue
+			}
+			result.Written = true
+		}
+		if result.Changed && *showDiff {
+			result.Diff = string(suite.UnifiedDiff(filename+".orig", filename, src, out))
+		}
+		results = append(results, result)
+
+		if m.format == formatJSON {
+			continue
+		}
+		switch {
+		case *showDiff:
+			fmt.Print(result.Diff)
+		case *check || *write:
+			if result.Changed {
+				fmt.Println(filename)
+			}
+		default:
+			fmt.Printf("%s", out)
+		}
+	}
+
+	if m.format == formatJSON {
+		m.writeJSON(struct {
+			Files       []jsonFmtFile    `json:"files"`
+			Diagnostics []jsonDiagnostic `json:"diagnostics"`
+		}{results, jsonDiagnostics(diags)})
+	} else {
+		m.showDiagnostics(diags)
+	}
+
+	switch {
+	case diags.HasErrors():
+		return exitConfig
+	case *check && unformatted > 0:
+		return exitFail
+	}
+	return exitPass
+}
+
+// writeFile replaces the contents of filename, keeping its permissions.
+func writeFile(filename string, data []byte) error {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, fi.Mode().Perm())
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const unformattedSuite = `suitename = "s"
+
+testcase "c" {
+  step "a" {
+    type = "exec"
+    command   = "true"
+  }
+}
+`
+
+const formattedSuite = `suitename = "s"
+
+testcase "c" {
+  step "a" {
+    type    = "exec"
+    command = "true"
+  }
+}
+`
+
+func TestFmt(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.hcl":      unformattedSuite,
+		"b.hcl":      formattedSuite,
+		"c.hcl.json": `{"suitename":   "s"}`,
+	})
+
+	status, stdout, _ := invoke(t, "fmt", filepath.Join(dir, "a.hcl"))
+	if status != exitPass || stdout != formattedSuite {
+		t.Errorf("fmt exited with %d and printed\n%s", status, stdout)
+	}
+
+	status, stdout, _ = invoke(t, "fmt", "-check", dir)
+	if want := filepath.Join(dir, "a.hcl") + "\n"; status != exitFail || stdout != want {
+		t.Errorf("fmt -check exited with %d and printed %q, want %d and %q", status, stdout, exitFail, want)
+	}
+
+	status, stdout, _ = invoke(t, "fmt", "-diff", dir)
+	if status != exitPass || !strings.Contains(stdout, "-    type = \"exec\"\n-    command   = \"true\"\n+    type    = \"exec\"\n+    command = \"true\"\n") {
+		t.Errorf("fmt -diff exited with %d and printed\n%s", status, stdout)
+	}
+
+	// Nothing is written without -w.
+	if src, _ := ioutil.ReadFile(filepath.Join(dir, "a.hcl")); string(src) != unformattedSuite {
+		t.Errorf("a.hcl was changed to\n%s", src)
+	}
+
+	status, stdout, _ = invoke(t, "fmt", "-w", dir)
+	if want := filepath.Join(dir, "a.hcl") + "\n"; status != exitPass || stdout != want {
+		t.Errorf("fmt -w exited with %d and printed %q, want %d and %q", status, stdout, exitPass, want)
+	}
+	if src, _ := ioutil.ReadFile(filepath.Join(dir, "a.hcl")); string(src) != formattedSuite {
+		t.Errorf("fmt -w wrote\n%s", src)
+	}
+	if src, _ := ioutil.ReadFile(filepath.Join(dir, "c.hcl.json")); string(src) != `{"suitename":   "s"}` {
+		t.Errorf("fmt -w changed the JSON file to %s", src)
+	}
+
+	if status, stdout, _ = invoke(t, "fmt", "-check", dir); status != exitPass || stdout != "" {
+		t.Errorf("fmt -check after -w exited with %d and printed %q", status, stdout)
+	}
+}
+
+func TestFmtJSON(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.hcl": unformattedSuite})
+	status, stdout, _ := invoke(t, "fmt", "-check", "-diff", "-format", "json", dir)
+	if status != exitFail {
+		t.Errorf("got exit status %d, want %d", status, exitFail)
+	}
+
+	var out struct {
+		Files []jsonFmtFile `json:"files"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatalf("invalid JSON output %q: %v", stdout, err)
+	}
+	if len(out.Files) != 1 || !out.Files[0].Changed || out.Files[0].Written || !strings.HasPrefix(out.Files[0].Diff, "--- ") {
+		t.Errorf("unexpected output %+v", out.Files)
+	}
+}
+
+func TestFmtErrors(t *testing.T) {
+	invalid := "testcase \"c\" {\n"
+	dir := writeFiles(t, map[string]string{"a.hcl": invalid})
+
+	if status, _, _ := invoke(t, "fmt", "-w", "-check", dir); status != exitConfig {
+		t.Errorf("fmt -w -check exited with %d, want %d", status, exitConfig)
+	}
+	if status, _, stderr := invoke(t, "fmt", "-w", dir); status != exitConfig || !strings.Contains(stderr, "Error: ") {
+		t.Errorf("fmt -w of an invalid file exited with %d and printed %q", status, stderr)
+	}
+	if src, _ := ioutil.ReadFile(filepath.Join(dir, "a.hcl")); string(src) != invalid {
+		t.Errorf("the invalid file was changed to %q", src)
+	}
+}
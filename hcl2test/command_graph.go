@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sean-/hcl2tests/suite"
+)
+
+type jsonGraphNode struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type jsonGraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+type jsonGraphCase struct {
+	Name      string          `json:"name"`
+	DependsOn []string        `json:"depends_on"`
+	Nodes     []jsonGraphNode `json:"nodes"`
+	Order     []string        `json:"order"`
+	Edges     []jsonGraphEdge `json:"edges"`
+}
+
+func graphCommand(args []string) int {
+	m := &meta{extraFormats: []string{formatDOT, formatMermaid}}
+	fs := m.loadFlagSet("graph", "[paths...]")
+	if status, ok := m.parseFlags(fs, args); !ok {
+		return status
+	}
+
+	ts, diags := m.load(fs.Args())
+	if diags.HasErrors() {
+		return m.loadFailed(diags)
+	}
+	m.showDiagnostics(diags)
+
+	switch m.format {
+	case formatJSON:
+		writeGraphJSON(m, ts)
+	case formatDOT:
+		writeGraphDOT(ts)
+	case formatMermaid:
+		writeGraphMermaid(ts)
+	default:
+		for i, tc := range ts.TestCases {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("%s:\n", tc.Name)
+			for _, dep := range ts.CaseDependencies(tc) {
+				fmt.Printf("  depends on %s\n", dep.Name)
+			}
+			for _, dep := range tc.Edges() {
+				fmt.Printf("  %s -> %s (%s)\n", dep.From.ID(), dep.To.ID(), dep.Kind)
+			}
+		}
+	}
+
+	return exitPass
+}
+
+func writeGraphJSON(m *meta, ts *suite.TestSuite) {
+	cases := make([]jsonGraphCase, 0, len(ts.TestCases))
+	for _, tc := range ts.TestCases {
+		jc := jsonGraphCase{
+			Name:      tc.Name,
+			DependsOn: []string{},
+			Nodes:     []jsonGraphNode{},
+			Order:     []string{},
+			Edges:     []jsonGraphEdge{},
+		}
+		for _, dep := range ts.CaseDependencies(tc) {
+			jc.DependsOn = append(jc.DependsOn, dep.Name)
+		}
+		for _, step := range tc.TestSteps {
+			jc.Nodes = append(jc.Nodes, jsonGraphNode{
+				ID:   step.ID(),
+				Name: step.Name,
+			})
+		}
+		for _, step := range tc.OrderedSteps() {
+			jc.Order = append(jc.Order, step.ID())
+		}
+		for _, dep := range tc.Edges() {
+			jc.Edges = append(jc.Edges, jsonGraphEdge{
+				From: dep.From.ID(),
+				To:   dep.To.ID(),
+				Kind: dep.Kind.String(),
+			})
+		}
+		cases = append(cases, jc)
+	}
+	m.writeJSON(cases)
+}
+
+// writeGraphDOT writes the step graphs as a single Graphviz digraph with a
+// cluster per testcase. Implicit dependencies are drawn dashed. Dependencies
+// between testcases are drawn bold from cluster to cluster, which Graphviz
+// expresses as an edge between their first steps clipped to the clusters.
+func writeGraphDOT(ts *suite.TestSuite) {
+	fmt.Printf("digraph %s {\n", strconv.Quote(ts.Name))
+	fmt.Println("  rankdir = \"LR\";")
+	fmt.Println("  compound = true;")
+	fmt.Println("  node [shape = \"box\"];")
+	for i, tc := range ts.TestCases {
+		fmt.Printf("\n  subgraph \"cluster_%d\" {\n", i)
+		fmt.Printf("    label = %s;\n", strconv.Quote(tc.Name))
+		for _, step := range tc.TestSteps {
+			fmt.Printf("    %s [label = %s];\n", dotNodeID(tc, step), strconv.Quote(nodeLabel(step, "\n")))
+		}
+		for _, dep := range tc.Edges() {
+			style := "solid"
+			if dep.Kind == suite.DependencyImplicit {
+				style = "dashed"
+			}
+			fmt.Printf("    %s -> %s [label = %q, style = %q];\n", dotNodeID(tc, dep.From), dotNodeID(tc, dep.To), dep.Kind, style)
+		}
+		fmt.Println("  }")
+	}
+
+	clusters := caseIndexes(ts)
+	for _, tc := range ts.TestCases {
+		for _, dep := range ts.CaseDependencies(tc) {
+			if len(dep.TestSteps) == 0 || len(tc.TestSteps) == 0 {
+				continue
+			}
+			fmt.Printf("  %s -> %s [ltail = \"cluster_%d\", lhead = \"cluster_%d\", style = \"bold\"];\n",
+				dotNodeID(dep, dep.TestSteps[0]), dotNodeID(tc, tc.TestSteps[0]), clusters[dep], clusters[tc])
+		}
+	}
+	fmt.Println("}")
+}
+
+// dotNodeID qualifies the step's id with its testcase, since step ids are
+// only unique within a testcase.
+func dotNodeID(tc *suite.TestCase, step *suite.TestStep) string {
+	return strconv.Quote(tc.Name + "/" + step.ID())
+}
+
+// writeGraphMermaid writes the step graphs as a Mermaid flowchart with a
+// subgraph per testcase. Implicit dependencies are drawn dotted and
+// dependencies between testcases thick.
+func writeGraphMermaid(ts *suite.TestSuite) {
+	fmt.Println("flowchart LR")
+	for i, tc := range ts.TestCases {
+		// Mermaid node ids are restricted to simple identifiers, so the
+		// steps are numbered and labelled instead.
+		ids := make(map[*suite.TestStep]string, len(tc.TestSteps))
+		for j, step := range tc.TestSteps {
+			ids[step] = fmt.Sprintf("c%ds%d", i, j)
+		}
+
+		fmt.Printf("  subgraph c%d[%s]\n", i, mermaidText(tc.Name))
+		for _, step := range tc.TestSteps {
+			fmt.Printf("    %s[%s]\n", ids[step], mermaidText(nodeLabel(step, "<br/>")))
+		}
+		for _, dep := range tc.Edges() {
+			arrow := "-->"
+			if dep.Kind == suite.DependencyImplicit {
+				arrow = "-.->"
+			}
+			fmt.Printf("    %s %s|%s| %s\n", ids[dep.From], arrow, dep.Kind, ids[dep.To])
+		}
+		fmt.Println("  end")
+	}
+
+	subgraphs := caseIndexes(ts)
+	for _, tc := range ts.TestCases {
+		for _, dep := range ts.CaseDependencies(tc) {
+			fmt.Printf("  c%d ==> c%d\n", subgraphs[dep], subgraphs[tc])
+		}
+	}
+}
+
+// caseIndexes returns the position of every testcase in the suite, which
+// numbers the clusters and subgraphs.
+func caseIndexes(ts *suite.TestSuite) map[*suite.TestCase]int {
+	indexes := make(map[*suite.TestCase]int, len(ts.TestCases))
+	for i, tc := range ts.TestCases {
+		indexes[tc] = i
+	}
+	return indexes
+}
+
+// nodeLabel returns the step's id, followed by its name on another line when
+// the name differs from the id.
+func nodeLabel(step *suite.TestStep, sep string) string {
+	if step.Name == "" || step.Name == step.ID() {
+		return step.ID()
+	}
+	return step.ID() + sep + step.Name
+}
+
+// mermaidText quotes s for use as a Mermaid label.
+func mermaidText(s string) string {
+	return `"` + strings.Replace(s, `"`, "#quot;", -1) + `"`
+}
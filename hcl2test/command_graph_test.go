@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const graphSuite = `suitename = "s"
+
+testcase "setup" {
+  step "a" {}
+}
+
+testcase "c" {
+  depends_on = ["setup"]
+
+  step "a" {
+    stepname = "First step"
+  }
+
+  step "b" {
+    after = ["a"]
+  }
+
+  step "c" {
+    value = step.b
+  }
+}
+`
+
+func TestGraph(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"suite.hcl": graphSuite})
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			format: "text",
+			want: `setup:
+
+c:
+  depends on setup
+  a -> b (explicit)
+  b -> c (implicit)
+`,
+		},
+		{
+			format: "dot",
+			want: `digraph "s" {
+  rankdir = "LR";
+  compound = true;
+  node [shape = "box"];
+
+  subgraph "cluster_0" {
+    label = "setup";
+    "setup/a" [label = "a"];
+  }
+
+  subgraph "cluster_1" {
+    label = "c";
+    "c/a" [label = "a\nFirst step"];
+    "c/b" [label = "b"];
+    "c/c" [label = "c"];
+    "c/a" -> "c/b" [label = "explicit", style = "solid"];
+    "c/b" -> "c/c" [label = "implicit", style = "dashed"];
+  }
+  "setup/a" -> "c/a" [ltail = "cluster_0", lhead = "cluster_1", style = "bold"];
+}
+`,
+		},
+		{
+			format: "mermaid",
+			want: `flowchart LR
+  subgraph c0["setup"]
+    c0s0["a"]
+  end
+  subgraph c1["c"]
+    c1s0["a<br/>First step"]
+    c1s1["b"]
+    c1s2["c"]
+    c1s0 -->|explicit| c1s1
+    c1s1 -.->|implicit| c1s2
+  end
+  c0 ==> c1
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			status, stdout, stderr := invoke(t, "graph", "-format", test.format, dir)
+			if status != exitPass {
+				t.Fatalf("got exit status %d: %s", status, stderr)
+			}
+			if stdout != test.want {
+				t.Errorf("got\n%s\nwant\n%s", stdout, test.want)
+			}
+		})
+	}
+}
+
+func TestGraphJSON(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"suite.hcl": graphSuite})
+	status, stdout, stderr := invoke(t, "graph", "-format", "json", dir)
+	if status != exitPass {
+		t.Fatalf("got exit status %d: %s", status, stderr)
+	}
+
+	var got []jsonGraphCase
+	if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+		t.Fatalf("invalid JSON output %q: %v", stdout, err)
+	}
+	want := []jsonGraphCase{
+		{
+			Name:      "setup",
+			DependsOn: []string{},
+			Nodes:     []jsonGraphNode{{ID: "a", Name: "a"}},
+			Order:     []string{"a"},
+			Edges:     []jsonGraphEdge{},
+		},
+		{
+			Name:      "c",
+			DependsOn: []string{"setup"},
+			Nodes:     []jsonGraphNode{{ID: "a", Name: "First step"}, {ID: "b", Name: "b"}, {ID: "c", Name: "c"}},
+			Order:     []string{"a", "b", "c"},
+			Edges: []jsonGraphEdge{
+				{From: "a", To: "b", Kind: "explicit"},
+				{From: "b", To: "c", Kind: "implicit"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
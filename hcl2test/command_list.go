@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+type jsonListStep struct {
+	ID   string   `json:"id"`
+	Name string   `json:"name"`
+	Type string   `json:"type"`
+	Tags []string `json:"tags"`
+}
+
+type jsonListCase struct {
+	Name    string         `json:"name"`
+	Enabled bool           `json:"enabled"`
+	Tags    []string       `json:"tags"`
+	Steps   []jsonListStep `json:"steps"`
+}
+
+func listCommand(args []string) int {
+	m := &meta{}
+	fs := m.loadFlagSet("list", "[paths...]")
+	if status, ok := m.parseFlags(fs, args); !ok {
+		return status
+	}
+
+	ts, diags := m.load(fs.Args())
+	if diags.HasErrors() {
+		return m.loadFailed(diags)
+	}
+	m.showDiagnostics(diags)
+
+	if m.format == formatJSON {
+		cases := make([]jsonListCase, 0, len(ts.TestCases))
+		for _, tc := range ts.TestCases {
+			jc := jsonListCase{
+				Name:    tc.Name,
+				Enabled: tc.Enabled,
+				Tags:    append([]string{}, tc.Tags...),
+				Steps:   make([]jsonListStep, 0, len(tc.TestSteps)),
+			}
+			for _, step := range tc.TestSteps {
+				jc.Steps = append(jc.Steps, jsonListStep{
+					ID:   step.ID(),
+					Name: step.Name,
+					Type: step.Type,
+					Tags: append([]string{}, step.Tags...),
+				})
+			}
+			cases = append(cases, jc)
+		}
+		m.writeJSON(cases)
+		return exitPass
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, tc := range ts.TestCases {
+		header := tc.Name
+		if !tc.Enabled {
+			header += " (disabled)"
+		}
+		if len(tc.Tags) > 0 {
+			header += " [" + strings.Join(tc.Tags, ", ") + "]"
+		}
+		fmt.Fprintf(tw, "%s\n", header)
+		for _, step := range tc.TestSteps {
+			fmt.Fprintf(tw, "  %s/%s\t%s\t%s", tc.Name, step.ID(), step.Name, step.Type)
+			if len(step.Tags) > 0 {
+				fmt.Fprintf(tw, "\t%s", strings.Join(step.Tags, ", "))
+			}
+			fmt.Fprintln(tw)
+		}
+	}
+	tw.Flush()
+
+	return exitPass
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/sean-/hcl2tests/suite"
+)
+
+type jsonMigrateFile struct {
+	Filename string `json:"filename"`
+	Written  bool   `json:"written,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+func migrateCommand(args []string) int {
+	m := &meta{}
+	fs := m.flagSet("migrate", "[paths...]")
+	write := fs.Bool("w", false, "Replace each HCL1 file with its HCL2 version instead of writing to stdout.")
+	if status, ok := m.parseFlags(fs, args); !ok {
+		return status
+	}
+
+	filenames, diags := suite.FindFiles(fs.Args())
+	if diags.HasErrors() {
+		return m.loadFailed(diags)
+	}
+
+	m.sources = make(map[string]*hcl.File)
+	var results []jsonMigrateFile
+	for _, filename := range filenames {
+		// HCL1 and HCL2 read JSON the same way.
+		if suite.IsJSONFile(filename) {
+			continue
+		}
+
+		// The file is HCL1, so the loader's parser cannot be used.
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to read suite file",
+				Detail:   fmt.Sprintf("The file %q could not be read: %v.", filename, err),
+			})
+			continue
+		}
+		m.sources[filename] = &hcl.File{Bytes: src}
+
+		out, d := migrate(src, filename)
+		diags = append(diags, d...)
+		if d.HasErrors() {
+			continue
+		}
+
+		result := jsonMigrateFile{Filename: filename}
+		if *write {
+			if err := writeFile(filename, out); err != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Failed to write suite file",
+					Detail:   fmt.Sprintf("The migrated file %q could not be written: %v.", filename, err),
+				})
+				continue
+			}
+			result.Written = true
+		} else {
+			result.Content = string(out)
+		}
+		results = append(results, result)
+
+		if m.format == formatJSON {
+			continue
+		}
+		if *write {
+			fmt.Println(filename)
+		} else {
+			fmt.Printf("%s", out)
+		}
+	}
+
+	if m.format == formatJSON {
+		m.writeJSON(struct {
+			Files       []jsonMigrateFile `json:"files"`
+			Diagnostics []jsonDiagnostic  `json:"diagnostics"`
+		}{results, jsonDiagnostics(diags)})
+	} else {
+		m.showDiagnostics(diags)
+	}
+
+	if diags.HasErrors() {
+		return exitConfig
+	}
+	return exitPass
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/sean-/hcl2tests/suite"
+)
+
+func runCommand(args []string) int {
+	m := &meta{}
+	fs := m.loadFlagSet("run", "[paths...]")
+	var targets stringList
+	fs.Var(&targets, "target", "Run only the step `case/step` and the steps it depends on. May be repeated.")
+	parallel := fs.Int("parallel", 1, "Run up to `n` testcases at the same time.")
+	update := fs.Bool("update", false, "Rewrite snapshot files that are missing or differ, and remove stale ones.")
+	if status, ok := m.parseFlags(fs, args); !ok {
+		return status
+	}
+
+	ts, diags := m.load(fs.Args())
+	if diags.HasErrors() {
+		return m.loadFailed(diags)
+	}
+	m.showDiagnostics(diags)
+
+	runner := &suite.Runner{
+		Suite:           ts,
+		Parallel:        *parallel,
+		UpdateSnapshots: *update,
+	}
+	for _, target := range targets {
+		step, err := resolveTarget(ts, target)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "hcl2test: %v\n", err)
+			return exitConfig
+		}
+		runner.Targets = append(runner.Targets, step)
+	}
+	if m.format == formatText {
+		runner.StepDone = m.printStepResult
+	}
+
+	result := runner.Run(context.Background())
+
+	if m.format == formatJSON {
+		m.writeJSON(newJSONSuiteResult(result, append(diags, result.Diagnostics...)))
+	} else {
+		m.printSuiteResult(result)
+	}
+
+	if result.Failed() {
+		return exitFail
+	}
+	return exitPass
+}
+
+// resolveTarget finds the step named by a case/step address.
+func resolveTarget(ts *suite.TestSuite, addr string) (*suite.TestStep, error) {
+	i := strings.Index(addr, "/")
+	if i < 0 {
+		return nil, fmt.Errorf("target %q must be given as case/step", addr)
+	}
+	caseName, stepID := addr[:i], addr[i+1:]
+
+	tc := ts.Case(caseName)
+	if tc == nil {
+		return nil, fmt.Errorf("no testcase named %q", caseName)
+	}
+	step, ok := tc.StepMap[stepID]
+	if !ok {
+		return nil, fmt.Errorf("no step %q in testcase %q", stepID, caseName)
+	}
+	return step, nil
+}
+
+func (m *meta) printStepResult(cr *suite.CaseResult, sr *suite.StepResult) {
+	name := cr.Case.Name + "/" + sr.Step.ID()
+	switch sr.Status {
+	case suite.StatusSkip:
+		fmt.Printf("--- %s: %s (%s)\n", sr.Status, name, sr.Reason)
+	default:
+		fmt.Printf("--- %s: %s (%.2fs)\n", sr.Status, name, sr.Duration.Seconds())
+	}
+	if len(sr.Diagnostics) > 0 {
+		m.writeDiagnostics(os.Stdout, sr.Diagnostics)
+	}
+}
+
+func (m *meta) printSuiteResult(result *suite.SuiteResult) {
+	var passed, failed, skipped int
+	for _, cr := range result.Cases {
+		if len(cr.Diagnostics) > 0 {
+			m.writeDiagnostics(os.Stdout, cr.Diagnostics)
+		}
+
+		switch cr.Status {
+		case suite.StatusPass:
+			passed++
+		case suite.StatusFail:
+			failed++
+		case suite.StatusSkip:
+			skipped++
+		}
+
+		if cr.Reason != "" {
+			fmt.Printf("%s %s (%s)\n", cr.Status, cr.Case.Name, cr.Reason)
+		} else {
+			fmt.Printf("%s %s (%.2fs)\n", cr.Status, cr.Case.Name, cr.Duration.Seconds())
+		}
+	}
+
+	if len(result.Diagnostics) > 0 {
+		m.writeDiagnostics(os.Stdout, result.Diagnostics)
+	}
+
+	status := suite.StatusPass
+	if result.Failed() {
+		status = suite.StatusFail
+	}
+	fmt.Printf("%s %s: %d passed, %d failed, %d skipped (%.2fs)\n",
+		status, result.Suite.Name, passed, failed, skipped, result.Duration.Seconds())
+}
+
+type jsonStepResult struct {
+	ID          string           `json:"id"`
+	Name        string           `json:"name"`
+	Type        string           `json:"type"`
+	Status      string           `json:"status"`
+	Reason      string           `json:"reason,omitempty"`
+	Duration    float64          `json:"duration"`
+	Diagnostics []jsonDiagnostic `json:"diagnostics,omitempty"`
+}
+
+type jsonCaseResult struct {
+	Name        string           `json:"name"`
+	Status      string           `json:"status"`
+	Reason      string           `json:"reason,omitempty"`
+	Duration    float64          `json:"duration"`
+	Steps       []jsonStepResult `json:"steps"`
+	Diagnostics []jsonDiagnostic `json:"diagnostics,omitempty"`
+}
+
+type jsonSuiteResult struct {
+	Name        string           `json:"name"`
+	Status      string           `json:"status"`
+	Duration    float64          `json:"duration"`
+	Cases       []jsonCaseResult `json:"cases"`
+	Diagnostics []jsonDiagnostic `json:"diagnostics,omitempty"`
+}
+
+func newJSONSuiteResult(result *suite.SuiteResult, diags hcl.Diagnostics) jsonSuiteResult {
+	ret := jsonSuiteResult{
+		Name:        result.Suite.Name,
+		Status:      suite.StatusPass.String(),
+		Duration:    result.Duration.Seconds(),
+		Cases:       make([]jsonCaseResult, 0, len(result.Cases)),
+		Diagnostics: jsonDiagnostics(diags),
+	}
+	if result.Failed() {
+		ret.Status = suite.StatusFail.String()
+	}
+
+	for _, cr := range result.Cases {
+		jcr := jsonCaseResult{
+			Name:        cr.Case.Name,
+			Status:      cr.Status.String(),
+			Reason:      cr.Reason,
+			Duration:    cr.Duration.Seconds(),
+			Steps:       make([]jsonStepResult, 0, len(cr.Steps)),
+			Diagnostics: jsonDiagnostics(cr.Diagnostics),
+		}
+		for _, sr := range cr.Steps {
+			jcr.Steps = append(jcr.Steps, jsonStepResult{
+				ID:          sr.Step.ID(),
+				Name:        sr.Step.Name,
+				Type:        sr.Step.Type,
+				Status:      sr.Status.String(),
+				Reason:      sr.Reason,
+				Duration:    sr.Duration.Seconds(),
+				Diagnostics: jsonDiagnostics(sr.Diagnostics),
+			})
+		}
+		ret.Cases = append(ret.Cases, jcr)
+	}
+
+	return ret
+}
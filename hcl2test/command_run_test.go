@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRunTargets(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"suite.hcl": `suitename = "s"
+
+testcase "c" {
+  step "a" {}
+
+  step "b" {
+    value = step.a
+  }
+
+  step "c" {}
+}
+
+testcase "other" {
+  step "a" {}
+}
+`})
+
+	status, stdout, stderr := invoke(t, "run", "-target", "c/b", dir)
+	if status != exitPass {
+		t.Fatalf("got exit status %d: %s", status, stderr)
+	}
+	for _, line := range []string{
+		"--- PASS: c/a ",
+		"--- PASS: c/b ",
+		"--- SKIP: c/c (not selected)\n",
+		"SKIP other (not selected)\n",
+		"PASS s: 1 passed, 0 failed, 1 skipped ",
+	} {
+		if !strings.Contains(stdout, line) {
+			t.Errorf("the output does not contain %q:\n%s", line, stdout)
+		}
+	}
+
+	for target, want := range map[string]string{
+		"c":       `target "c" must be given as case/step`,
+		"nope/a":  `no testcase named "nope"`,
+		"c/nope":  `no step "nope" in testcase "c"`,
+		"other/b": `no step "b" in testcase "other"`,
+	} {
+		status, _, stderr := invoke(t, "run", "-target", target, dir)
+		if status != exitConfig || stderr != "hcl2test: "+want+"\n" {
+			t.Errorf("-target %s exited with %d and printed %q, want %d and %q", target, status, stderr, exitConfig, want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+)
+
+func validateCommand(args []string) int {
+	m := &meta{}
+	fs := m.loadFlagSet("validate", "[paths...]")
+	if status, ok := m.parseFlags(fs, args); !ok {
+		return status
+	}
+
+	// No step is run: loading evaluates the variables, locals, for_each
+	// and matrix expressions, ids and dependencies the suite's structure
+	// depends on, and the step and fixture expressions are only checked
+	// statically.
+	ts, diags := m.load(fs.Args())
+	if ts != nil {
+		diags = append(diags, ts.Validate()...)
+	}
+
+	if m.format == formatJSON {
+		m.writeJSON(struct {
+			Valid       bool             `json:"valid"`
+			Diagnostics []jsonDiagnostic `json:"diagnostics"`
+		}{!diags.HasErrors(), jsonDiagnostics(diags)})
+	} else {
+		m.showDiagnostics(diags)
+		if !diags.HasErrors() {
+			steps := 0
+			for _, tc := range ts.TestCases {
+				steps += len(tc.TestSteps)
+			}
+			fmt.Printf("Suite %q is valid: %s, %s.\n", ts.Name, plural(len(ts.TestCases), "testcase"), plural(steps, "step"))
+		}
+	}
+
+	if diags.HasErrors() {
+		return exitConfig
+	}
+	return exitPass
+}
+
+// plural returns n followed by noun, made plural unless n is 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
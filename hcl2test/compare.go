@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+
+	hcl1 "github.com/hashicorp/hcl"
+	hcl1ast "github.com/hashicorp/hcl/hcl/ast"
+	hcl1parser "github.com/hashicorp/hcl/hcl/parser"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// The compare command decodes a file without a schema with both HCL1 and
+// HCL2 into trees of maps, slices and scalars, and reports where the trees
+// differ. Numbers are held as *big.Float so that HCL1's ints and floats
+// compare equal to HCL2's numbers.
+
+// compareExpr is an HCL2 expression that cannot be evaluated without the
+// suite, held as its source.
+type compareExpr string
+
+// difference is one place where the HCL1 and HCL2 trees differ. Missing is
+// 1 or 2 when the value was only decoded by the other version. Range is set
+// when HCL1 could parse but not decode the value, and points at its source.
+type difference struct {
+	Path    string
+	Summary string
+	HCL1    interface{}
+	HCL2    interface{}
+	Missing int
+	Range   *hcl.Range
+}
+
+// compare decodes src with both HCL1 and HCL2 and returns the differences
+// between the results. Nothing is compared unless both can parse the file.
+func compare(src []byte, filename string) ([]difference, hcl.Diagnostics) {
+	f1, err := hcl1parser.Parse(src)
+	if err != nil {
+		return nil, hcl.Diagnostics{hcl1Diagnostic(filename, err)}
+	}
+
+	f, diags := hclsyntax.ParseConfig(src, filename, hcl.Pos{Byte: 0, Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	new := hcl2Tree(src, f.Body.(*hclsyntax.Body))
+	old, diffs := hcl1Decode(f1, filename, new)
+
+	compareTrees("", old, new, &diffs)
+	return diffs, diags
+}
+
+// hcl1Decode decodes the top-level items of f with HCL1, one name at a time,
+// so that a name HCL1 cannot decode, such as testcase blocks written both
+// with and without labels, is reported as a difference at its source while
+// the rest of the file is still compared. Such names are removed from new.
+func hcl1Decode(f *hcl1ast.File, filename string, new map[string]interface{}) (map[string]interface{}, []difference) {
+	var names []string
+	items := make(map[string][]*hcl1ast.ObjectItem)
+	if list, ok := f.Node.(*hcl1ast.ObjectList); ok {
+		for _, item := range list.Items {
+			name := hcl1Key(item.Keys[0])
+			if items[name] == nil {
+				names = append(names, name)
+			}
+			items[name] = append(items[name], item)
+		}
+	}
+
+	old := make(map[string]interface{}, len(names))
+	var diffs []difference
+	for _, name := range names {
+		var raw map[string]interface{}
+		err := hcl1.DecodeObject(&raw, &hcl1ast.File{Node: &hcl1ast.ObjectList{Items: items[name]}})
+		if err == nil {
+			old[name] = hcl1Tree(raw[name])
+			continue
+		}
+
+		first := items[name][0].Keys[0]
+		rng := hcl1Range(filename, first.Pos())
+		rng.End.Byte += len(first.Token.Text)
+		rng.End.Column += len(first.Token.Text)
+
+		summary := fmt.Sprintf("HCL1 cannot decode this: %v", err)
+		if hcl1MixedLabels(items[name]) {
+			summary = fmt.Sprintf("HCL1 cannot decode %s blocks written both with and without labels", name)
+		}
+		diffs = append(diffs, difference{
+			Path:    joinPath("", name),
+			Summary: summary,
+			HCL2:    new[name],
+			Missing: 1,
+			Range:   rng,
+		})
+		delete(new, name)
+	}
+	return old, diffs
+}
+
+// hcl1MixedLabels reports whether items includes both blocks with labels
+// and blocks without.
+func hcl1MixedLabels(items []*hcl1ast.ObjectItem) bool {
+	labelled, unlabelled := false, false
+	for _, item := range items {
+		if _, ok := item.Val.(*hcl1ast.ObjectType); !ok {
+			continue
+		}
+		if len(item.Keys) > 1 {
+			labelled = true
+		} else {
+			unlabelled = true
+		}
+	}
+	return labelled && unlabelled
+}
+
+// hcl1Tree normalizes a value decoded by HCL1 into the generic tree.
+func hcl1Tree(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		tree := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			tree[key] = hcl1Tree(elem)
+		}
+		return tree
+	case []map[string]interface{}:
+		tree := make([]interface{}, len(v))
+		for i, elem := range v {
+			tree[i] = hcl1Tree(elem)
+		}
+		return tree
+	case []interface{}:
+		tree := make([]interface{}, len(v))
+		for i, elem := range v {
+			tree[i] = hcl1Tree(elem)
+		}
+		return tree
+	case int:
+		return new(big.Float).SetInt64(int64(v))
+	case int64:
+		return new(big.Float).SetInt64(v)
+	case float64:
+		return big.NewFloat(v)
+	}
+	return v
+}
+
+// hcl2Tree returns the generic tree of an HCL2 body: attributes hold their
+// values and each block type holds a list of its blocks, with a level of
+// maps for each label.
+func hcl2Tree(src []byte, body *hclsyntax.Body) map[string]interface{} {
+	tree := make(map[string]interface{})
+	for name, attr := range body.Attributes {
+		val, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			rng := attr.Expr.Range()
+			tree[name] = compareExpr(src[rng.Start.Byte:rng.End.Byte])
+			continue
+		}
+		tree[name] = ctyTree(val)
+	}
+
+	for _, block := range body.Blocks {
+		var v interface{} = hcl2Tree(src, block.Body)
+		for i := len(block.Labels) - 1; i >= 0; i-- {
+			v = map[string]interface{}{block.Labels[i]: v}
+		}
+		list, _ := tree[block.Type].([]interface{})
+		tree[block.Type] = append(list, v)
+	}
+	return tree
+}
+
+// ctyTree converts a value evaluated by HCL2 into the generic tree.
+func ctyTree(val cty.Value) interface{} {
+	ty := val.Type()
+	switch {
+	case val.IsNull():
+		return nil
+	case ty == cty.String:
+		return val.AsString()
+	case ty == cty.Number:
+		return val.AsBigFloat()
+	case ty == cty.Bool:
+		return val.True()
+	case ty.IsObjectType() || ty.IsMapType():
+		tree := make(map[string]interface{})
+		for it := val.ElementIterator(); it.Next(); {
+			key, elem := it.Element()
+			tree[key.AsString()] = ctyTree(elem)
+		}
+		return tree
+	case ty.IsListType() || ty.IsTupleType() || ty.IsSetType():
+		tree := make([]interface{}, 0, val.LengthInt())
+		for it := val.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			tree = append(tree, ctyTree(elem))
+		}
+		return tree
+	}
+	return compareExpr(fmt.Sprintf("%#v", val))
+}
+
+// compareTrees appends the differences between old, from HCL1, and new, from
+// HCL2, at path to diffs.
+func compareTrees(path string, old, new interface{}, diffs *[]difference) {
+	add := func(summary string, args ...interface{}) {
+		*diffs = append(*diffs, difference{
+			Path:    path,
+			Summary: fmt.Sprintf(summary, args...),
+			HCL1:    old,
+			HCL2:    new,
+		})
+	}
+
+	// HCL1 decodes every object, whether written as a block or an
+	// attribute, into a list holding that one object.
+	if list, ok := old.([]interface{}); ok && len(list) == 1 {
+		if _, isMap := list[0].(map[string]interface{}); isMap {
+			if _, isMap := new.(map[string]interface{}); isMap {
+				add("HCL1 wraps the object in a list")
+				compareTrees(path, list[0], new, diffs)
+				return
+			}
+		}
+	}
+
+	switch old := old.(type) {
+	case map[string]interface{}:
+		newMap, ok := new.(map[string]interface{})
+		if !ok {
+			add("HCL1 decodes an object, HCL2 %s", treeKind(new))
+			return
+		}
+		for _, key := range mergedKeys(old, newMap) {
+			oldElem, inOld := old[key]
+			newElem, inNew := newMap[key]
+			elemPath := joinPath(path, key)
+			switch {
+			case !inNew:
+				*diffs = append(*diffs, difference{Path: elemPath, Summary: "Only decoded by HCL1", HCL1: oldElem, Missing: 2})
+			case !inOld:
+				*diffs = append(*diffs, difference{Path: elemPath, Summary: "Only decoded by HCL2", HCL2: newElem, Missing: 1})
+			default:
+				compareTrees(elemPath, oldElem, newElem, diffs)
+			}
+		}
+
+	case []interface{}:
+		newList, ok := new.([]interface{})
+		if !ok {
+			add("HCL1 decodes a list, HCL2 %s", treeKind(new))
+			return
+		}
+		if len(old) != len(newList) {
+			add("HCL1 decodes %d elements, HCL2 %d", len(old), len(newList))
+		}
+		for i := 0; i < len(old) && i < len(newList); i++ {
+			compareTrees(fmt.Sprintf("%s[%d]", path, i), old[i], newList[i], diffs)
+		}
+
+	default:
+		if _, ok := new.(compareExpr); ok {
+			add("HCL2 evaluates an expression that HCL1 decodes as %s", treeKind(old))
+			return
+		}
+		if treeKind(old) != treeKind(new) {
+			add("HCL1 decodes %s, HCL2 %s", treeKind(old), treeKind(new))
+			return
+		}
+		if !scalarsEqual(old, new) {
+			add("The values differ")
+		}
+	}
+}
+
+// treeKind describes the kind of a tree value for a difference summary.
+func treeKind(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "a list"
+	case string:
+		return "a string"
+	case *big.Float:
+		return "a number"
+	case bool:
+		return "a bool"
+	case compareExpr:
+		return "an expression"
+	}
+	return fmt.Sprintf("a %T", v)
+}
+
+func scalarsEqual(old, new interface{}) bool {
+	if oldNum, ok := old.(*big.Float); ok {
+		return oldNum.Cmp(new.(*big.Float)) == 0
+	}
+	return old == new
+}
+
+func mergedKeys(a, b map[string]interface{}) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// joinPath appends key to path, quoting keys that are not identifiers.
+func joinPath(path, key string) string {
+	switch {
+	case !isIdentifier(key):
+		return fmt.Sprintf("%s[%s]", path, strconv.Quote(key))
+	case path == "":
+		return key
+	}
+	return path + "." + key
+}
+
+// renderTree returns v on a single line in JSON syntax, except that HCL2
+// expressions are shown as their source in angle brackets.
+func renderTree(v interface{}) string {
+	var buf bytes.Buffer
+	writeTree(&buf, v)
+	return buf.String()
+}
+
+func writeTree(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case compareExpr:
+		buf.WriteString("<expression " + string(v) + ">")
+	case map[string]interface{}:
+		keys := mergedKeys(v, nil)
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(strconv.Quote(key) + ": ")
+			writeTree(buf, v[key])
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, elem := range v {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			writeTree(buf, elem)
+		}
+		buf.WriteByte(']')
+	default:
+		b, _ := json.Marshal(jsonTree(v))
+		buf.Write(b)
+	}
+}
+
+// jsonTree returns v with its numbers and expressions in a form that
+// encoding/json writes as they are shown in text.
+func jsonTree(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *big.Float:
+		return json.Number(v.Text('g', -1))
+	case compareExpr:
+		return string(v)
+	case map[string]interface{}:
+		tree := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			tree[key] = jsonTree(elem)
+		}
+		return tree
+	case []interface{}:
+		tree := make([]interface{}, len(v))
+		for i, elem := range v {
+			tree[i] = jsonTree(elem)
+		}
+		return tree
+	}
+	return v
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCompareMixedLabels(t *testing.T) {
+	src := []byte(`suitename = "s"
+
+testcase {
+  casename = "a"
+}
+
+testcase "b" {
+  value = 1
+}
+`)
+	diffs, diags := compare(src, "suite.hcl")
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	if len(diffs) != 1 {
+		t.Fatalf("got %d differences, want 1: %#v", len(diffs), diffs)
+	}
+
+	diff := diffs[0]
+	if want := "HCL1 cannot decode testcase blocks written both with and without labels"; diff.Summary != want {
+		t.Errorf("got summary %q, want %q", diff.Summary, want)
+	}
+	if diff.Path != "testcase" || diff.Missing != 1 {
+		t.Errorf("got path %q and missing %d, want testcase and 1", diff.Path, diff.Missing)
+	}
+	if diff.Range == nil || diff.Range.Start.Line != 3 || diff.Range.Start.Column != 1 {
+		t.Errorf("got range %v, want one starting at 3,1", diff.Range)
+	}
+}
+
+func TestCompareSyntaxError(t *testing.T) {
+	_, diags := compare([]byte("testcase {\n"), "suite.hcl")
+	if !diags.HasErrors() || diags[0].Summary != "Invalid HCL1 syntax" || diags[0].Subject == nil || diags[0].Subject.Start.Line == 0 {
+		t.Errorf("got %v, want an HCL1 syntax error with a range", diags)
+	}
+}
@@ -0,0 +1,899 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/hashicorp/hcl2/hclwrite"
+	"github.com/sean-/hcl2tests/suite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// jsonValue is a JSON value that keeps the order of object properties, which
+// encoding/json does not, so that converted suites read in the same order as
+// their source.
+type jsonValue struct {
+	// raw is the encoded form of a scalar. Objects and arrays leave it
+	// empty and hold their members in keys and values; arrays have no keys.
+	raw    string
+	object bool
+	keys   []string
+	values []*jsonValue
+
+	// offset is the position in the source of a value decoded from JSON.
+	offset int
+}
+
+func jsonString(s string) *jsonValue {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return &jsonValue{raw: strings.TrimSuffix(buf.String(), "\n")}
+}
+
+func jsonObject() *jsonValue {
+	return &jsonValue{object: true}
+}
+
+func jsonArray() *jsonValue {
+	return &jsonValue{values: []*jsonValue{}}
+}
+
+func (v *jsonValue) set(key string, val *jsonValue) {
+	v.keys = append(v.keys, key)
+	v.values = append(v.values, val)
+}
+
+// get returns the value of the named property of an object, or nil.
+func (v *jsonValue) get(key string) *jsonValue {
+	for i, k := range v.keys {
+		if k == key {
+			return v.values[i]
+		}
+	}
+	return nil
+}
+
+// write encodes v indented like json.MarshalIndent with two spaces.
+func (v *jsonValue) write(buf *bytes.Buffer, indent string) {
+	if v.raw != "" {
+		buf.WriteString(v.raw)
+		return
+	}
+
+	open, close := "[", "]"
+	if v.object {
+		open, close = "{", "}"
+	}
+	if len(v.values) == 0 {
+		buf.WriteString(open + close)
+		return
+	}
+
+	buf.WriteString(open + "\n")
+	for i, val := range v.values {
+		buf.WriteString(indent + "  ")
+		if v.object {
+			buf.WriteString(jsonString(v.keys[i]).raw + ": ")
+		}
+		val.write(buf, indent+"  ")
+		if i < len(v.values)-1 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(indent + close)
+}
+
+// toJSON converts a native syntax suite file into the JSON syntax. Comments
+// become "//" properties of the body that contains them. Expressions other
+// than literals are written as "${...}" templates, which evaluate to the
+// same value.
+func toJSON(src []byte, filename string) ([]byte, hcl.Diagnostics) {
+	start := hcl.Pos{Byte: 0, Line: 1, Column: 1}
+	f, diags := hclsyntax.ParseConfig(src, filename, start)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	tokens, diags := hclsyntax.LexConfig(src, filename, start)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	c := &jsonConverter{src: src, tokens: tokens}
+	for _, tok := range tokens {
+		if tok.Type == hclsyntax.TokenComment {
+			c.comments = append(c.comments, tok)
+		}
+	}
+
+	out := c.body(f.Body.(*hclsyntax.Body), true)
+	if c.diags.HasErrors() {
+		return nil, c.diags
+	}
+
+	var buf bytes.Buffer
+	out.write(&buf, "")
+	buf.WriteByte('\n')
+	return buf.Bytes(), c.diags
+}
+
+type jsonConverter struct {
+	src      []byte
+	tokens   hclsyntax.Tokens
+	comments hclsyntax.Tokens
+	diags    hcl.Diagnostics
+}
+
+// body converts a block body. The attributes of literal bodies are
+// evaluated without a context, so their strings are not templates.
+func (c *jsonConverter) body(body *hclsyntax.Body, literal bool) *jsonValue {
+	out := jsonObject()
+	if comment := c.bodyComments(body); comment != "" {
+		out.set("//", jsonString(comment))
+	}
+
+	items := make([]hclsyntax.Node, 0, len(body.Attributes)+len(body.Blocks))
+	for _, attr := range body.Attributes {
+		items = append(items, attr)
+	}
+	for _, block := range body.Blocks {
+		items = append(items, block)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Range().Start.Byte < items[j].Range().Start.Byte
+	})
+
+	// Blocks of a type are grouped into a single property at the position
+	// of the first of them, since a JSON object has one property per name.
+	done := make(map[string]bool)
+	for _, item := range items {
+		switch item := item.(type) {
+		case *hclsyntax.Attribute:
+			out.set(item.Name, c.expr(item.Expr, literal))
+		case *hclsyntax.Block:
+			if done[item.Type] {
+				continue
+			}
+			done[item.Type] = true
+			out.set(item.Type, c.blocks(body.Blocks, item.Type))
+		}
+	}
+
+	return out
+}
+
+// blocks converts every block of the given type: an object for a single
+// unlabelled block, an array for several, and objects keyed by label for
+// labelled blocks.
+func (c *jsonConverter) blocks(all hclsyntax.Blocks, blockType string) *jsonValue {
+	var blocks hclsyntax.Blocks
+	for _, block := range all {
+		if block.Type == blockType {
+			blocks = append(blocks, block)
+		}
+	}
+
+	literal := blockType == "variable"
+	labels := len(blocks[0].Labels)
+	for _, block := range blocks[1:] {
+		if len(block.Labels) != labels {
+			c.diags = append(c.diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Cannot convert block",
+				Detail:   fmt.Sprintf("Every %s block must have the same number of labels to be written in JSON, which groups them into a single property. The fmt -upgrade command labels unlabelled testcases, steps and fixtures.", blockType),
+				Subject:  block.TypeRange.Ptr(),
+			})
+			return jsonObject()
+		}
+	}
+
+	if labels == 0 {
+		if len(blocks) == 1 {
+			return c.body(blocks[0].Body, literal)
+		}
+		out := jsonArray()
+		for _, block := range blocks {
+			out.values = append(out.values, c.body(block.Body, literal))
+		}
+		return out
+	}
+
+	// Blocks with the same labels become an array under them.
+	out := jsonObject()
+	for _, block := range blocks {
+		parent := out
+		for i, label := range block.Labels {
+			child := parent.get(label)
+			if child == nil {
+				if i < labels-1 {
+					child = jsonObject()
+				} else {
+					child = jsonArray()
+				}
+				parent.set(label, child)
+			}
+			parent = child
+		}
+		parent.values = append(parent.values, c.body(block.Body, literal))
+	}
+	unwrapSingleBlocks(out, labels)
+	return out
+}
+
+// unwrapSingleBlocks replaces the arrays holding a single block body, depth
+// levels of labels below v, with the body itself.
+func unwrapSingleBlocks(v *jsonValue, depth int) {
+	for i, child := range v.values {
+		if depth > 1 {
+			unwrapSingleBlocks(child, depth-1)
+		} else if len(child.values) == 1 {
+			v.values[i] = child.values[0]
+		}
+	}
+}
+
+// bodyComments returns the text of the comments directly within body, that
+// is not within one of its blocks, one per line.
+func (c *jsonConverter) bodyComments(body *hclsyntax.Body) string {
+	var lines []string
+	for _, tok := range c.comments {
+		if !rangeContains(body.SrcRange, tok.Range) {
+			continue
+		}
+		nested := false
+		for _, block := range body.Blocks {
+			if rangeContains(block.Body.SrcRange, tok.Range) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			lines = append(lines, commentText(tok.Bytes)...)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func rangeContains(outer, inner hcl.Range) bool {
+	return inner.Start.Byte >= outer.Start.Byte && inner.End.Byte <= outer.End.Byte
+}
+
+// commentText strips the comment markers from a comment token.
+func commentText(comment []byte) []string {
+	text := strings.TrimSpace(string(comment))
+	switch {
+	case strings.HasPrefix(text, "#"):
+		text = text[1:]
+	case strings.HasPrefix(text, "//"):
+		text = text[2:]
+	case strings.HasPrefix(text, "/*"):
+		text = strings.TrimSuffix(text[2:], "*/")
+	}
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	return lines
+}
+
+func (c *jsonConverter) expr(expr hclsyntax.Expression, literal bool) *jsonValue {
+	if literal {
+		return c.literal(expr)
+	}
+
+	switch e := expr.(type) {
+	case *hclsyntax.TupleConsExpr:
+		out := jsonArray()
+		for _, item := range e.Exprs {
+			out.values = append(out.values, c.expr(item, false))
+		}
+		return out
+
+	case *hclsyntax.ObjectConsExpr:
+		out := jsonObject()
+		for _, item := range e.Items {
+			key, ok := objectKey(item.KeyExpr)
+			if !ok {
+				c.diags = append(c.diags, &hcl.Diagnostic{
+					Severity: hcl.DiagWarning,
+					Summary:  "Expression cannot be represented in JSON",
+					Detail:   "JSON object keys cannot be expressions, so the key is written as a template string that will not be evaluated.",
+					Subject:  item.KeyExpr.Range().Ptr(),
+				})
+				key = "${" + c.source(item.KeyExpr) + "}"
+			}
+			out.set(key, c.expr(item.ValueExpr, false))
+		}
+		return out
+
+	case *hclsyntax.TemplateExpr:
+		return jsonString(c.template(e))
+
+	case *hclsyntax.TemplateWrapExpr:
+		return jsonString("${" + c.source(e.Wrapped) + "}")
+	}
+
+	// Literals, including negative numbers, are written as themselves and
+	// everything else as a template of its source.
+	constant := false
+	switch e := expr.(type) {
+	case *hclsyntax.LiteralValueExpr:
+		constant = true
+	case *hclsyntax.UnaryOpExpr:
+		_, constant = e.Val.(*hclsyntax.LiteralValueExpr)
+	}
+	if constant {
+		if val, diags := expr.Value(nil); !diags.HasErrors() {
+			if out := jsonScalar(val, true); out != nil {
+				return out
+			}
+		}
+	}
+	return jsonString("${" + c.source(expr) + "}")
+}
+
+// literal converts an expression that is evaluated without a context.
+func (c *jsonConverter) literal(expr hclsyntax.Expression) *jsonValue {
+	val, diags := expr.Value(nil)
+	if !diags.HasErrors() {
+		if out := jsonValueOf(val); out != nil {
+			return out
+		}
+	}
+	c.diags = append(c.diags, &hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary:  "Expression cannot be represented in JSON",
+		Detail:   "This attribute is not evaluated as a template in JSON, so its expression is written as a literal string.",
+		Subject:  expr.Range().Ptr(),
+	})
+	return jsonString(c.source(expr))
+}
+
+// jsonValueOf converts a constant value, or returns nil if it is not wholly
+// known.
+func jsonValueOf(val cty.Value) *jsonValue {
+	if out := jsonScalar(val, false); out != nil || !val.IsKnown() || val.Type().IsPrimitiveType() {
+		return out
+	}
+
+	ty := val.Type()
+	object := ty.IsObjectType() || ty.IsMapType()
+	if !object && !ty.IsTupleType() && !ty.IsListType() && !ty.IsSetType() {
+		return nil
+	}
+	out := jsonArray()
+	if object {
+		out = jsonObject()
+	}
+	for it := val.ElementIterator(); it.Next(); {
+		k, v := it.Element()
+		elem := jsonValueOf(v)
+		if elem == nil {
+			return nil
+		}
+		if object {
+			out.set(k.AsString(), elem)
+		} else {
+			out.values = append(out.values, elem)
+		}
+	}
+	return out
+}
+
+// jsonScalar converts a known primitive value, escaping template sequences
+// in strings if template is set. It returns nil for other values.
+func jsonScalar(val cty.Value, template bool) *jsonValue {
+	switch {
+	case !val.IsKnown():
+		return nil
+	case val.IsNull():
+		return &jsonValue{raw: "null"}
+	case val.Type() == cty.String && template:
+		return jsonString(escapeTemplate(val.AsString()))
+	case val.Type() == cty.String:
+		return jsonString(val.AsString())
+	case val.Type() == cty.Number:
+		return &jsonValue{raw: val.AsBigFloat().Text('f', -1)}
+	case val.Type() == cty.Bool && val.True():
+		return &jsonValue{raw: "true"}
+	case val.Type() == cty.Bool:
+		return &jsonValue{raw: "false"}
+	}
+	return nil
+}
+
+// template converts a quoted or heredoc template into the text of a JSON
+// string, which the JSON syntax parses as a template in turn.
+func (c *jsonConverter) template(e *hclsyntax.TemplateExpr) string {
+	var buf bytes.Buffer
+	for _, part := range e.Parts {
+		if lit, ok := part.(*hclsyntax.LiteralValueExpr); ok && lit.Val.Type() == cty.String {
+			buf.WriteString(escapeTemplate(lit.Val.AsString()))
+			continue
+		}
+
+		open := bytes.TrimRight(c.src[:part.Range().Start.Byte], " \t~")
+		if !bytes.HasSuffix(open, []byte("${")) {
+			// A %{ if } or %{ for } directive. Its source is only
+			// usable as it stands when it holds no escape sequences.
+			src := c.source(e)
+			if e.SrcRange.Start.Byte < len(c.src) && c.src[e.SrcRange.Start.Byte] == '"' {
+				src = src[1 : len(src)-1]
+			}
+			if strings.Contains(src, `\`) {
+				c.diags = append(c.diags, &hcl.Diagnostic{
+					Severity: hcl.DiagWarning,
+					Summary:  "Expression cannot be represented in JSON",
+					Detail:   "The template has both directives and escape sequences, so its escape sequences are written as they appear in the source.",
+					Subject:  e.SrcRange.Ptr(),
+				})
+			}
+			return src
+		}
+		buf.WriteString("${" + c.source(part) + "}")
+	}
+	return buf.String()
+}
+
+func (c *jsonConverter) source(expr hclsyntax.Expression) string {
+	return string(exprSource(c.src, c.tokens, expr.Range()))
+}
+
+// exprSource returns the source of the expression at rng. The vendored parser
+// leaves parentheses out of the ranges of expressions, so those that rng
+// leaves unbalanced, as in the range "a) + (b" of (a) + (b), are added back
+// from tokens.
+func exprSource(src []byte, tokens hclsyntax.Tokens, rng hcl.Range) []byte {
+	from := sort.Search(len(tokens), func(i int) bool {
+		return tokens[i].Range.Start.Byte >= rng.Start.Byte
+	})
+	to := sort.Search(len(tokens), func(i int) bool {
+		return tokens[i].Range.End.Byte > rng.End.Byte
+	})
+
+	depth, lowest := 0, 0
+	for _, tok := range tokens[from:to] {
+		switch tok.Type {
+		case hclsyntax.TokenOParen:
+			depth++
+		case hclsyntax.TokenCParen:
+			depth--
+			if depth < lowest {
+				lowest = depth
+			}
+		}
+	}
+	for ; lowest < 0 && from > 0 && tokens[from-1].Type == hclsyntax.TokenOParen; lowest++ {
+		from--
+		depth++
+	}
+	for ; depth > 0 && to < len(tokens) && tokens[to].Type == hclsyntax.TokenCParen; depth-- {
+		to++
+	}
+
+	start, end := rng.Start.Byte, rng.End.Byte
+	if from < len(tokens) && tokens[from].Range.Start.Byte < start {
+		start = tokens[from].Range.Start.Byte
+	}
+	if to > 0 && tokens[to-1].Range.End.Byte > end {
+		end = tokens[to-1].Range.End.Byte
+	}
+	return src[start:end]
+}
+
+// objectKey returns the literal key of an object constructor item. The
+// parser turns bare identifier keys into literal strings.
+func objectKey(expr hclsyntax.Expression) (string, bool) {
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() || !val.IsKnown() || val.IsNull() || val.Type() != cty.String {
+		return "", false
+	}
+	return val.AsString(), true
+}
+
+// escapeTemplate escapes the template sequences in a literal string.
+func escapeTemplate(s string) string {
+	s = strings.Replace(s, "${", "$${", -1)
+	return strings.Replace(s, "%{", "%%{", -1)
+}
+
+// hclBlockSpec describes a block type of the suite schema for converting
+// from JSON, where blocks and attributes look alike.
+type hclBlockSpec struct {
+	labels int
+
+	// optionalLabel allows the single label to be left out.
+	optionalLabel bool
+
+	// literal means that the block's attributes are evaluated without a
+	// context, so their strings are not templates.
+	literal bool
+
+	blocks map[string]*hclBlockSpec
+
+	// step means the nested blocks depend on the step's type.
+	step bool
+}
+
+// dynamicSpec is the spec of the dynamic blocks of step and fixture bodies,
+// labelled with the type of the blocks they generate.
+var dynamicSpec = &hclBlockSpec{
+	labels: 1,
+	blocks: map[string]*hclBlockSpec{"content": {}},
+}
+
+// fixtureSpec is the spec of fixture blocks, at the top level and within
+// testcases.
+var fixtureSpec = &hclBlockSpec{
+	labels:        1,
+	optionalLabel: true,
+	blocks:        map[string]*hclBlockSpec{"dynamic": dynamicSpec},
+}
+
+var suiteSpec = &hclBlockSpec{
+	literal: true,
+	blocks: map[string]*hclBlockSpec{
+		"include":       {labels: 1, literal: true},
+		"variable":      {labels: 1, literal: true},
+		"locals":        {},
+		"fixture":       fixtureSpec,
+		"step_template": {labels: 1, step: true},
+
+		// The files of a module directory hold inputs, outputs and
+		// steps at the top level.
+		"input":  {labels: 1},
+		"output": {labels: 1},
+		"step":   {labels: 1, optionalLabel: true, step: true},
+
+		"testcase": {
+			labels:        1,
+			optionalLabel: true,
+			blocks: map[string]*hclBlockSpec{
+				"matrix":  {},
+				"step":    {labels: 1, optionalLabel: true, step: true},
+				"fixture": fixtureSpec,
+				"module":  {labels: 1},
+			},
+		},
+	},
+}
+
+// stepSpec returns the spec of a step body with the given type attribute.
+// Steps of every type may have snapshot and dynamic blocks.
+func stepSpec(typeName string) *hclBlockSpec {
+	spec := &hclBlockSpec{blocks: map[string]*hclBlockSpec{
+		"snapshot": {},
+		"dynamic":  dynamicSpec,
+	}}
+	if schema := suite.StepSchema(typeName); schema != nil {
+		for _, block := range schema.Blocks {
+			spec.blocks[block.Type] = &hclBlockSpec{labels: len(block.LabelNames)}
+		}
+	}
+	return spec
+}
+
+// toHCL converts a JSON syntax suite file into the native syntax. "//"
+// properties of bodies become comments.
+func toHCL(src []byte, filename string) ([]byte, hcl.Diagnostics) {
+	dec := json.NewDecoder(bytes.NewReader(src))
+	dec.UseNumber()
+	root, err := decodeJSONValue(dec, src)
+	if err != nil {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid JSON",
+			Detail:   fmt.Sprintf("The file %q could not be read as JSON: %v.", filename, err),
+		}}
+	}
+
+	c := &hclConverter{src: src, filename: filename}
+	if !root.object {
+		c.errorAt(root, "Invalid suite file", "The root of a JSON suite file must be an object.")
+		return nil, c.diags
+	}
+
+	c.body(root, suiteSpec, "")
+	if c.diags.HasErrors() {
+		return nil, c.diags
+	}
+	return hclwrite.Format(c.buf.Bytes()), c.diags
+}
+
+type hclConverter struct {
+	src      []byte
+	filename string
+	buf      bytes.Buffer
+	diags    hcl.Diagnostics
+}
+
+func (c *hclConverter) body(obj *jsonValue, spec *hclBlockSpec, indent string) {
+	if spec.step {
+		var name string
+		if typ := obj.get("type"); typ != nil {
+			json.Unmarshal([]byte(typ.raw), &name)
+		}
+		spec = stepSpec(name)
+	}
+
+	for i, key := range obj.keys {
+		val := obj.values[i]
+		if key == "//" {
+			c.comment(val, indent)
+			continue
+		}
+
+		if blockSpec, ok := spec.blocks[key]; ok {
+			c.blocks(key, val, blockSpec, indent)
+			continue
+		}
+		if bytes.HasSuffix(c.buf.Bytes(), []byte("}\n")) {
+			c.buf.WriteByte('\n')
+		}
+
+		if !isIdentifier(key) {
+			c.errorAt(val, "Cannot convert attribute", fmt.Sprintf("The property %q is not a valid attribute name in the native syntax.", key))
+			continue
+		}
+		fmt.Fprintf(&c.buf, "%s%s = %s\n", indent, key, c.expr(val, spec.literal, indent))
+	}
+}
+
+func (c *hclConverter) comment(val *jsonValue, indent string) {
+	var text string
+	if err := json.Unmarshal([]byte(val.raw), &text); err != nil {
+		c.errorAt(val, "Cannot convert comment", `A "//" property must be a string to become a comment.`)
+		return
+	}
+	for _, line := range strings.Split(text, "\n") {
+		c.buf.WriteString(strings.TrimRight(indent+"# "+line, " ") + "\n")
+	}
+}
+
+// blocks writes the blocks held by a JSON property, peeling off one level of
+// objects per label.
+func (c *hclConverter) blocks(blockType string, val *jsonValue, spec *hclBlockSpec, indent string) {
+	labels := spec.labels
+	if spec.optionalLabel && !isLabelledJSON(val, spec) {
+		labels = 0
+	}
+	c.labelledBlocks(blockType, nil, val, labels, spec, indent)
+}
+
+func (c *hclConverter) labelledBlocks(blockType string, labels []string, val *jsonValue, remaining int, spec *hclBlockSpec, indent string) {
+	if remaining > 0 {
+		if !val.object {
+			c.errorAt(val, "Cannot convert block", fmt.Sprintf("The %s blocks must be an object keyed by their labels.", blockType))
+			return
+		}
+		for i, label := range val.keys {
+			c.labelledBlocks(blockType, append(labels, label), val.values[i], remaining-1, spec, indent)
+		}
+		return
+	}
+
+	bodies := []*jsonValue{val}
+	if !val.object {
+		bodies = val.values
+	}
+	for _, body := range bodies {
+		if !body.object {
+			c.errorAt(body, "Cannot convert block", fmt.Sprintf("The body of a %s block must be an object.", blockType))
+			continue
+		}
+		// Blocks are separated from whatever precedes them in their body.
+		if c.buf.Len() > 0 && !bytes.HasSuffix(c.buf.Bytes(), []byte("{\n")) {
+			c.buf.WriteByte('\n')
+		}
+		c.buf.WriteString(indent + blockType)
+		for _, label := range labels {
+			c.buf.WriteString(" " + jsonString(label).raw)
+		}
+		c.buf.WriteString(" {\n")
+		c.body(body, spec, indent+"  ")
+		c.buf.WriteString(indent + "}\n")
+	}
+}
+
+// isLabelledJSON reports whether the JSON value of a block type that may or
+// may not be labelled holds labelled blocks: an object whose properties all
+// hold block bodies, rather than an unlabelled block body or an array of
+// them.
+func isLabelledJSON(val *jsonValue, spec *hclBlockSpec) bool {
+	if !val.object || len(val.keys) == 0 {
+		return false
+	}
+	for i, key := range val.keys {
+		if key == "//" || spec.blocks[key] != nil {
+			return false
+		}
+		if child := val.values[i]; child.raw != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// expr returns the native syntax for a JSON value. Strings are templates
+// unless literal is set.
+func (c *hclConverter) expr(val *jsonValue, literal bool, indent string) string {
+	switch {
+	case val.raw != "" && val.raw[0] == '"':
+		var s string
+		json.Unmarshal([]byte(val.raw), &s)
+		if literal {
+			return hclQuote(escapeTemplate(s))
+		}
+		return c.template(val, s)
+
+	case val.raw != "":
+		return val.raw
+
+	case val.object:
+		if len(val.keys) == 0 {
+			return "{}"
+		}
+		var buf bytes.Buffer
+		buf.WriteString("{\n")
+		for i, key := range val.keys {
+			name := key
+			if !isIdentifier(key) {
+				name = hclQuote(escapeTemplate(key))
+			}
+			fmt.Fprintf(&buf, "%s  %s = %s\n", indent, name, c.expr(val.values[i], literal, indent+"  "))
+		}
+		buf.WriteString(indent + "}")
+		return buf.String()
+	}
+
+	items := make([]string, 0, len(val.values))
+	for _, item := range val.values {
+		items = append(items, c.expr(item, literal, indent))
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+// template returns the native syntax for a JSON string, which is a template.
+// A string that is a single interpolation becomes the bare expression.
+func (c *hclConverter) template(val *jsonValue, s string) string {
+	expr, diags := hclsyntax.ParseTemplate([]byte(s), c.filename, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		c.warnAt(val, "Expression cannot be represented in the native syntax", "The string is not a valid template, so it is written as a literal string.")
+		return hclQuote(escapeTemplate(s))
+	}
+	if wrap, ok := expr.(*hclsyntax.TemplateWrapExpr); ok {
+		tokens, _ := hclsyntax.LexTemplate([]byte(s), c.filename, hcl.Pos{Line: 1, Column: 1})
+		return strings.TrimSpace(string(exprSource([]byte(s), tokens, wrap.Wrapped.Range())))
+	}
+	return hclQuote(s)
+}
+
+// hclQuote quotes s as a native syntax string, leaving any template
+// sequences in place.
+func hclQuote(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(&buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// isIdentifier reports whether s is a valid attribute name in the native
+// syntax.
+func isIdentifier(s string) bool {
+	for i, r := range s {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+		case i > 0 && (r == '-' || unicode.IsDigit(r)):
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+func (c *hclConverter) errorAt(val *jsonValue, summary, detail string) {
+	c.diags = append(c.diags, c.diagnosticAt(hcl.DiagError, val, summary, detail))
+}
+
+func (c *hclConverter) warnAt(val *jsonValue, summary, detail string) {
+	c.diags = append(c.diags, c.diagnosticAt(hcl.DiagWarning, val, summary, detail))
+}
+
+func (c *hclConverter) diagnosticAt(severity hcl.DiagnosticSeverity, val *jsonValue, summary, detail string) *hcl.Diagnostic {
+	pos := hcl.Pos{Byte: val.offset, Line: 1, Column: 1}
+	for _, b := range c.src[:val.offset] {
+		if b == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+	return &hcl.Diagnostic{
+		Severity: severity,
+		Summary:  summary,
+		Detail:   detail,
+		Subject:  &hcl.Range{Filename: c.filename, Start: pos, End: pos},
+	}
+}
+
+// decodeJSONValue decodes the next value from dec, keeping the order of
+// object properties and the offset of each value.
+func decodeJSONValue(dec *json.Decoder, src []byte) (*jsonValue, error) {
+	// The decoder's offset is after the previous token, so skip the
+	// separators that come before this one.
+	offset := int(dec.InputOffset())
+	for offset < len(src) && strings.IndexByte(" \t\r\n,:", src[offset]) >= 0 {
+		offset++
+	}
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		val := jsonArray()
+		if tok == '{' {
+			val = jsonObject()
+		}
+		val.offset = offset
+		for dec.More() {
+			if val.object {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				val.keys = append(val.keys, key.(string))
+			}
+			child, err := decodeJSONValue(dec, src)
+			if err != nil {
+				return nil, err
+			}
+			val.values = append(val.values, child)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return val, nil
+	case string:
+		val := jsonString(tok)
+		val.offset = offset
+		return val, nil
+	case json.Number:
+		return &jsonValue{raw: tok.String(), offset: offset}, nil
+	case bool:
+		return &jsonValue{raw: fmt.Sprint(tok), offset: offset}, nil
+	default:
+		return &jsonValue{raw: "null", offset: offset}, nil
+	}
+}
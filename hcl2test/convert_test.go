@@ -0,0 +1,378 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConvertRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+
+		// src converts to json, which converts back to out, or to src
+		// itself if out is empty.
+		src, json, out string
+	}{
+		{
+			name: "labelled blocks",
+			src: `suitename = "s"
+
+testcase "c" {
+  tags = ["x", "y"]
+
+  step "a" {
+    type = "http"
+    url  = "http://localhost"
+
+    assert {
+      condition = self.status == 200
+    }
+
+    assert {
+      condition = true
+    }
+  }
+
+  step "b" {
+    after = ["a"]
+  }
+}
+`,
+			json: `{
+  "suitename": "s",
+  "testcase": {
+    "c": {
+      "tags": [
+        "x",
+        "y"
+      ],
+      "step": {
+        "a": {
+          "type": "http",
+          "url": "http://localhost",
+          "assert": [
+            {
+              "condition": "${self.status == 200}"
+            },
+            {
+              "condition": true
+            }
+          ]
+        },
+        "b": {
+          "after": [
+            "a"
+          ]
+        }
+      }
+    }
+  }
+}
+`,
+		},
+		{
+			name: "unlabelled blocks",
+			src: `suitename = "s"
+
+testcase {
+  casename = "c"
+
+  step {
+    stepname = "first"
+  }
+
+  step {
+    stepname = "second"
+  }
+}
+`,
+			json: `{
+  "suitename": "s",
+  "testcase": {
+    "casename": "c",
+    "step": [
+      {
+        "stepname": "first"
+      },
+      {
+        "stepname": "second"
+      }
+    ]
+  }
+}
+`,
+		},
+		{
+			name: "templates and escapes",
+			src: `suitename = "s"
+
+variable "name" {
+  default = "a $${b}"
+}
+
+testcase "c" {
+  step "a" {
+    args = ["${name}-$${not}", 1 + 2, -3, name, upper(name)]
+    env = {
+      HOME = "/root"
+    }
+  }
+}
+`,
+			json: `{
+  "suitename": "s",
+  "variable": {
+    "name": {
+      "default": "a ${b}"
+    }
+  },
+  "testcase": {
+    "c": {
+      "step": {
+        "a": {
+          "args": [
+            "${name}-$${not}",
+            "${1 + 2}",
+            -3,
+            "${name}",
+            "${upper(name)}"
+          ],
+          "env": {
+            "HOME": "/root"
+          }
+        }
+      }
+    }
+  }
+}
+`,
+		},
+		{
+			name: "parentheses",
+			src: `testcase "c" {
+  step "a" {
+    x = a == (b == 1)
+    y = (a) + (b)
+    z = "${(a + b) * 2}"
+  }
+}
+`,
+			json: `{
+  "testcase": {
+    "c": {
+      "step": {
+        "a": {
+          "x": "${a == (b == 1)}",
+          "y": "${(a) + (b)}",
+          "z": "${(a + b) * 2}"
+        }
+      }
+    }
+  }
+}
+`,
+			out: `testcase "c" {
+  step "a" {
+    x = a == (b == 1)
+    y = (a) + (b)
+    z = (a + b) * 2
+  }
+}
+`,
+		},
+		{
+			name: "dynamic blocks",
+			src: `suitename = "s"
+
+fixture "f" {
+  dynamic "file" {
+    for_each = ["a", "b"]
+
+    content {
+      path = file.value
+    }
+  }
+}
+
+step_template "t" {
+  type = "http"
+  url  = "http://localhost"
+
+  dynamic "assert" {
+    for_each = [200]
+
+    content {
+      condition = self.status == assert.value
+    }
+  }
+}
+
+testcase "c" {
+  step "a" {
+    dynamic "snapshot" {
+      for_each = ["x"]
+
+      content {
+        name  = snapshot.value
+        value = 1
+      }
+    }
+  }
+}
+`,
+			json: `{
+  "suitename": "s",
+  "fixture": {
+    "f": {
+      "dynamic": {
+        "file": {
+          "for_each": [
+            "a",
+            "b"
+          ],
+          "content": {
+            "path": "${file.value}"
+          }
+        }
+      }
+    }
+  },
+  "step_template": {
+    "t": {
+      "type": "http",
+      "url": "http://localhost",
+      "dynamic": {
+        "assert": {
+          "for_each": [
+            200
+          ],
+          "content": {
+            "condition": "${self.status == assert.value}"
+          }
+        }
+      }
+    }
+  },
+  "testcase": {
+    "c": {
+      "step": {
+        "a": {
+          "dynamic": {
+            "snapshot": {
+              "for_each": [
+                "x"
+              ],
+              "content": {
+                "name": "${snapshot.value}",
+                "value": 1
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}
+`,
+		},
+		{
+			name: "comments",
+			src: `# Suite header.
+suitename = "s"
+
+testcase "c" {
+  // Case comment.
+  step "a" {
+    command = "true" # trailing
+  }
+}
+`,
+			json: `{
+  "//": "Suite header.",
+  "suitename": "s",
+  "testcase": {
+    "c": {
+      "//": "Case comment.",
+      "step": {
+        "a": {
+          "//": "trailing",
+          "command": "true"
+        }
+      }
+    }
+  }
+}
+`,
+			out: `# Suite header.
+suitename = "s"
+
+testcase "c" {
+  # Case comment.
+
+  step "a" {
+    # trailing
+    command = "true"
+  }
+}
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			json, diags := toJSON([]byte(test.src), "suite.hcl")
+			if len(diags) > 0 {
+				t.Fatalf("unexpected diagnostics converting to JSON: %s", diags.Error())
+			}
+			if string(json) != test.json {
+				t.Errorf("got JSON\n%s\nwant\n%s", json, test.json)
+			}
+
+			out, diags := toHCL(json, "suite.hcl.json")
+			if len(diags) > 0 {
+				t.Fatalf("unexpected diagnostics converting back: %s", diags.Error())
+			}
+			want := test.out
+			if want == "" {
+				want = test.src
+			}
+			if string(out) != want {
+				t.Errorf("got\n%s\nwant\n%s", out, want)
+			}
+		})
+	}
+}
+
+func TestConvertWarnings(t *testing.T) {
+	src := `suitename = "s"
+
+variable "v" {
+  default = "${upper("a")}"
+}
+
+testcase "c" {
+  step "a" {
+    env = {
+      (v) = "x"
+    }
+  }
+}
+`
+	_, diags := toJSON([]byte(src), "suite.hcl")
+	var got []string
+	for _, diag := range diags {
+		got = append(got, diag.Summary+" at "+diag.Subject.String())
+	}
+	want := []string{
+		"Expression cannot be represented in JSON at suite.hcl:4,13-28",
+		"Expression cannot be represented in JSON at suite.hcl:10,8-9",
+	}
+	if !reflect.DeepEqual(got, want) || diags.HasErrors() {
+		t.Errorf("got %q, want warnings %q", got, want)
+	}
+
+	_, diags = toHCL([]byte(`{"suitename": "s", "testcase": {"c": {"value": "${"}}}`), "suite.hcl.json")
+	if len(diags) != 1 || diags[0].Summary != "Expression cannot be represented in the native syntax" || diags.HasErrors() {
+		t.Errorf("got %v, want a warning for the invalid template", diags)
+	}
+}
@@ -0,0 +1,110 @@
+// Command hcl2test loads, checks and runs HCL2 test suites.
+//
+// Usage:
+//
+//	hcl2test <command> [flags] [paths...]
+//
+// Every command accepts -format to choose between text and json output, and
+// the commands that load a suite accept -var name=value to set suite
+// variables along with the -strict and filter flags. The exit status is 0
+// when everything passed, 1 when a test failed and 2 when the suite or the
+// command line could not be used.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+const (
+	exitPass   = 0
+	exitFail   = 1
+	exitConfig = 2
+)
+
+type command struct {
+	synopsis string
+	run      func(args []string) int
+}
+
+var commands = map[string]*command{
+	"compare": {
+		synopsis: "Show how HCL1 and HCL2 decode suite files differently",
+		run:      compareCommand,
+	},
+	"convert": {
+		synopsis: "Convert suite files between the native and JSON syntax",
+		run:      convertCommand,
+	},
+	"explain": {
+		synopsis: "Describe how a testcase or step will be executed",
+		run:      explainCommand,
+	},
+	"fmt": {
+		synopsis: "Format suite files, or check that they are formatted",
+		run:      fmtCommand,
+	},
+	"graph": {
+		synopsis: "Show the step dependency graph of each testcase",
+		run:      graphCommand,
+	},
+	"list": {
+		synopsis: "List the testcases and steps in a suite",
+		run:      listCommand,
+	},
+	"migrate": {
+		synopsis: "Rewrite HCL1 suite files as HCL2",
+		run:      migrateCommand,
+	},
+	"run": {
+		synopsis: "Run the testcases in a suite",
+		run:      runCommand,
+	},
+	"validate": {
+		synopsis: "Check a suite for errors without running it",
+		run:      validateCommand,
+	},
+}
+
+func main() {
+	os.Exit(realMain(os.Args[1:]))
+}
+
+func realMain(args []string) int {
+	if len(args) < 1 {
+		usage()
+		return exitConfig
+	}
+
+	switch args[0] {
+	case "-h", "-help", "--help", "help":
+		usage()
+		return exitPass
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "hcl2test: unknown command %q\n\n", args[0])
+		usage()
+		return exitConfig
+	}
+
+	return cmd.run(args[1:])
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: hcl2test <command> [flags] [paths...]\n\nCommands:\n")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].synopsis)
+	}
+
+	fmt.Fprintf(os.Stderr, "\nRun \"hcl2test <command> -h\" for the flags of a command.\n")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFiles writes files, keyed by slash-separated name, to a new temporary
+// directory and returns the directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "hcl2test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for name, src := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// invoke runs hcl2test with args and returns its exit status and what it
+// wrote to stdout and stderr.
+func invoke(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	stdout, stderr := os.Stdout, os.Stderr
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var outBuf, errBuf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		io.Copy(&outBuf, outR)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(&errBuf, errR)
+		done <- struct{}{}
+	}()
+
+	os.Stdout, os.Stderr = outW, errW
+	status := realMain(args)
+	outW.Close()
+	errW.Close()
+	<-done
+	<-done
+	return status, outBuf.String(), errBuf.String()
+}
+
+func TestExitStatus(t *testing.T) {
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"-h"}, exitPass},
+		{[]string{"run", "-h"}, exitPass},
+		{[]string{"validate", "-help"}, exitPass},
+		{[]string{"fmt", "-h"}, exitPass},
+		{[]string{"run", "-no-such-flag"}, exitConfig},
+		{[]string{"list", "-format", "yaml"}, exitConfig},
+		{[]string{"frobnicate"}, exitConfig},
+	}
+	for _, test := range tests {
+		if got, _, _ := invoke(t, test.args...); got != test.want {
+			t.Errorf("hcl2test %q exited with %d, want %d", test.args, got, test.want)
+		}
+	}
+}
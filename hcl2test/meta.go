@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/sean-/hcl2tests/suite"
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	formatText    = "text"
+	formatJSON    = "json"
+	formatDOT     = "dot"
+	formatMermaid = "mermaid"
+)
+
+// meta holds the flags and helpers shared by every command.
+type meta struct {
+	vars   varFlags
+	format string
+	strict bool
+
+	run      string
+	tags     string
+	skipTags string
+	filter   *suite.Filter
+
+	// extraFormats are the output formats a command supports in addition
+	// to text and json.
+	extraFormats []string
+
+	loader *suite.Loader
+
+	// sources are files a command read without the loader, such as HCL1
+	// suites, so that diagnostics can still show their snippets.
+	sources map[string]*hcl.File
+}
+
+// varFlags collects repeated -var name=value flags.
+type varFlags []string
+
+func (v *varFlags) String() string {
+	return strings.Join(*v, ",")
+}
+
+func (v *varFlags) Set(s string) error {
+	if !strings.Contains(s, "=") {
+		return fmt.Errorf("variable %q must be given as name=value", s)
+	}
+	*v = append(*v, s)
+	return nil
+}
+
+// stringList collects the values of a repeated flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// flagSet returns a FlagSet for the named command with the -format flag
+// already registered.
+func (m *meta) flagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	formats := append([]string{formatText, formatJSON}, m.extraFormats...)
+	fs.StringVar(&m.format, "format", formatText, fmt.Sprintf("Output `format`: %s or %s.", strings.Join(formats[:len(formats)-1], ", "), formats[len(formats)-1]))
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: hcl2test %s [flags] %s\n\nFlags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// loadFlagSet returns a FlagSet like flagSet for a command that loads the
+// suite with load, with the flags that affect loading also registered.
+func (m *meta) loadFlagSet(name, args string) *flag.FlagSet {
+	fs := m.flagSet(name, args)
+	fs.Var(&m.vars, "var", "Set a suite variable as `name=value`. May be repeated.")
+	fs.BoolVar(&m.strict, "strict", false, "Reject step and fixture attributes not declared by the step type.")
+	fs.StringVar(&m.run, "run", "", "Only load testcases and steps matching the `regexp` case/step.")
+	fs.StringVar(&m.tags, "tags", "", "Only load steps matching the tag `expression`, such as \"slow,db\" or \"slow and not db\".")
+	fs.StringVar(&m.skipTags, "skip-tags", "", "Do not load steps matching the tag `expression`.")
+	return fs
+}
+
+// parseFlags parses args with fs and validates the shared flags. It returns
+// false, with the status to exit with, if the command should not go on:
+// exitPass if only -h was asked for, and exitConfig otherwise.
+func (m *meta) parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	switch err := fs.Parse(args); {
+	case err == flag.ErrHelp:
+		return exitPass, false
+	case err != nil:
+		return exitConfig, false
+	}
+
+	if m.run != "" || m.tags != "" || m.skipTags != "" {
+		filter, err := suite.NewFilter(m.run, m.tags, m.skipTags)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "hcl2test: %v\n", err)
+			return exitConfig, false
+		}
+		m.filter = filter
+	}
+
+	for _, format := range append([]string{formatText, formatJSON}, m.extraFormats...) {
+		if m.format == format {
+			return exitPass, true
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "hcl2test: unsupported format %q\n", m.format)
+	return exitConfig, false
+}
+
+// load loads the suite at paths with the variables given on the command
+// line.
+func (m *meta) load(paths []string) (*suite.TestSuite, hcl.Diagnostics) {
+	m.loader = suite.NewLoader()
+	m.loader.Strict = m.strict
+	m.loader.Filter = m.filter
+	for _, v := range m.vars {
+		parts := strings.SplitN(v, "=", 2)
+		m.loader.SetVariable(parts[0], cty.StringVal(parts[1]))
+	}
+
+	return m.loader.Load(paths...)
+}
+
+// files returns the sources known to the loader and the command, for
+// rendering diagnostics.
+func (m *meta) files() map[string]*hcl.File {
+	if m.loader == nil {
+		return m.sources
+	}
+	files := make(map[string]*hcl.File)
+	for name, f := range m.loader.Files() {
+		files[name] = f
+	}
+	for name, f := range m.sources {
+		files[name] = f
+	}
+	return files
+}
+
+// showDiagnostics writes diags as text to stderr. In json mode diagnostics
+// are instead included in the command's own output.
+func (m *meta) showDiagnostics(diags hcl.Diagnostics) {
+	if len(diags) == 0 || m.format == formatJSON {
+		return
+	}
+	m.writeDiagnostics(os.Stderr, diags)
+}
+
+func (m *meta) writeDiagnostics(wr io.Writer, diags hcl.Diagnostics) {
+	color := false
+	width := 80
+	if f, ok := wr.(*os.File); ok && terminal.IsTerminal(int(f.Fd())) {
+		color = true
+		if w, _, err := terminal.GetSize(int(f.Fd())); err == nil {
+			width = w
+		}
+	}
+
+	diagWr := hcl.NewDiagnosticTextWriter(wr, m.files(), uint(width), color)
+	diagWr.WriteDiagnostics(diags)
+}
+
+// writeJSON writes v to stdout as indented JSON.
+func (m *meta) writeJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		panic(fmt.Sprintf("bad encode: %v", err))
+	}
+}
+
+type jsonPos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Byte   int `json:"byte"`
+}
+
+type jsonRange struct {
+	Filename string  `json:"filename"`
+	Start    jsonPos `json:"start"`
+	End      jsonPos `json:"end"`
+}
+
+type jsonDiagnostic struct {
+	Severity string     `json:"severity"`
+	Summary  string     `json:"summary"`
+	Detail   string     `json:"detail,omitempty"`
+	Range    *jsonRange `json:"range,omitempty"`
+}
+
+func newJSONRange(rng *hcl.Range) *jsonRange {
+	if rng == nil {
+		return nil
+	}
+	return &jsonRange{
+		Filename: rng.Filename,
+		Start:    jsonPos{Line: rng.Start.Line, Column: rng.Start.Column, Byte: rng.Start.Byte},
+		End:      jsonPos{Line: rng.End.Line, Column: rng.End.Column, Byte: rng.End.Byte},
+	}
+}
+
+func jsonDiagnostics(diags hcl.Diagnostics) []jsonDiagnostic {
+	ret := make([]jsonDiagnostic, 0, len(diags))
+	for _, diag := range diags {
+		severity := "error"
+		if diag.Severity == hcl.DiagWarning {
+			severity = "warning"
+		}
+		ret = append(ret, jsonDiagnostic{
+			Severity: severity,
+			Summary:  diag.Summary,
+			Detail:   diag.Detail,
+			Range:    newJSONRange(diag.Subject),
+		})
+	}
+	return ret
+}
+
+// loadFailed reports a suite that could not be loaded and returns the exit
+// status for it.
+func (m *meta) loadFailed(diags hcl.Diagnostics) int {
+	if m.format == formatJSON {
+		m.writeJSON(struct {
+			Diagnostics []jsonDiagnostic `json:"diagnostics"`
+		}{jsonDiagnostics(diags)})
+	} else {
+		m.showDiagnostics(diags)
+	}
+	return exitConfig
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	hcl1ast "github.com/hashicorp/hcl/hcl/ast"
+	hcl1parser "github.com/hashicorp/hcl/hcl/parser"
+	hcl1token "github.com/hashicorp/hcl/hcl/token"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hclwrite"
+)
+
+// migrate converts an HCL1 suite file into the equivalent HCL2. The HCL1
+// AST does not say which items are blocks, so the suite schema decides, as
+// it does when converting from JSON. Constructs that HCL2 would read
+// differently are reported with warnings, or errors where there is no
+// equivalent.
+//
+// The hclwrite package in the vendored HCL2 can only format, not build,
+// files, so the result is written as text and then formatted.
+func migrate(src []byte, filename string) ([]byte, hcl.Diagnostics) {
+	f, err := hcl1parser.Parse(src)
+	if err != nil {
+		return nil, hcl.Diagnostics{hcl1Diagnostic(filename, err)}
+	}
+
+	m := &migrator{filename: filename, src: src}
+	list, ok := f.Node.(*hcl1ast.ObjectList)
+	if !ok {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid suite file",
+			Detail:   "The root of an HCL1 suite file must be a list of items.",
+		}}
+	}
+	m.body(list, suiteSpec, "")
+	if m.diags.HasErrors() {
+		return nil, m.diags
+	}
+	return hclwrite.Format(m.buf.Bytes()), m.diags
+}
+
+type migrator struct {
+	filename string
+	src      []byte
+	buf      bytes.Buffer
+	diags    hcl.Diagnostics
+
+	// afterBlock is set when the last thing written was a block.
+	afterBlock bool
+}
+
+func (m *migrator) body(list *hcl1ast.ObjectList, spec *hclBlockSpec, indent string) {
+	if spec.step {
+		spec = stepSpec(hcl1StepType(list))
+	}
+
+	// HCL1 lets an attribute be repeated, leaving it to the decoder to
+	// combine the values, while HCL2 rejects it. Only the last is kept.
+	last := make(map[string]*hcl1ast.ObjectItem)
+	for _, item := range list.Items {
+		if spec.blocks[hcl1Key(item.Keys[0])] == nil && len(item.Keys) == 1 {
+			last[hcl1Key(item.Keys[0])] = item
+		}
+	}
+
+	blocks := make(map[string]hcl1token.Pos)
+	for _, item := range list.Items {
+		name := hcl1Key(item.Keys[0])
+		blockSpec := spec.blocks[name]
+		m.separate(item, blockSpec != nil)
+		m.comment(item.LeadComment, indent)
+
+		if blockSpec != nil {
+			m.blocks(item, blockSpec, blocks, indent)
+			continue
+		}
+
+		if !isIdentifier(name) {
+			m.errorAt(item.Keys[0].Pos(), "Cannot migrate attribute", fmt.Sprintf("%q is not a valid attribute name in HCL2.", name))
+			continue
+		}
+		if len(item.Keys) == 1 && last[name] != item {
+			m.warnAt(item.Keys[0].Pos(), "Repeated attribute", fmt.Sprintf("The attribute %q is set more than once. HCL1 combines the values when decoding, but HCL2 does not allow it, so only the last is kept.", name))
+			continue
+		}
+
+		m.buf.WriteString(indent + name + " = " + m.itemValue(item, indent))
+		m.lineComment(item.LineComment)
+	}
+}
+
+// blocks writes the blocks of an item whose key is a block type: an object,
+// or in HCL1 also a list of objects for several blocks.
+func (m *migrator) blocks(item *hcl1ast.ObjectItem, spec *hclBlockSpec, seen map[string]hcl1token.Pos, indent string) {
+	blockType := hcl1Key(item.Keys[0])
+	labels := make([]string, 0, len(item.Keys)-1)
+	for _, key := range item.Keys[1:] {
+		labels = append(labels, hcl1Key(key))
+	}
+
+	switch {
+	case len(labels) > spec.labels:
+		m.errorAt(item.Keys[spec.labels+1].Pos(), "Cannot migrate block", fmt.Sprintf("A %s block can have at most %d labels in HCL2.", blockType, spec.labels))
+		return
+	case len(labels) < spec.labels && !spec.optionalLabel:
+		m.errorAt(item.Keys[0].Pos(), "Cannot migrate block", fmt.Sprintf("A %s block needs %d labels in HCL2.", blockType, spec.labels))
+		return
+	}
+
+	// HCL1 decodes labelled blocks into maps keyed by their labels, so a
+	// repeated block replaces the earlier one, while HCL2 keeps both.
+	if len(labels) > 0 {
+		key := blockType + " " + strings.Join(labels, " ")
+		if prev, exists := seen[key]; exists {
+			m.warnAt(item.Keys[0].Pos(), "Repeated block", fmt.Sprintf("A %s block with the same labels was declared at line %d. HCL1 decodes them into one map entry, so only one of them took effect, but HCL2 keeps both and reports them as duplicates.", blockType, prev.Line))
+		} else {
+			seen[key] = item.Keys[0].Pos()
+		}
+	}
+
+	// The HCL1 decoder of the older suites took the label of a step as its
+	// stepname, but in HCL2 it is the step's id.
+	if blockType == "step" && len(labels) > 0 {
+		m.warnAt(item.Keys[1].Pos(), "Step label becomes its id", fmt.Sprintf("HCL1 decodes the label of a step block into its stepname, but in HCL2 the label %q is the step's id, which before, after and step.<id> references use. Set stepname to keep the step's name.", labels[0]))
+	}
+
+	var bodies []*hcl1ast.ObjectType
+	switch val := item.Val.(type) {
+	case *hcl1ast.ObjectType:
+		bodies = append(bodies, val)
+	case *hcl1ast.ListType:
+		for _, elem := range val.List {
+			obj, ok := elem.(*hcl1ast.ObjectType)
+			if !ok {
+				m.errorAt(elem.Pos(), "Cannot migrate block", fmt.Sprintf("A list of %s blocks must contain only objects.", blockType))
+				return
+			}
+			bodies = append(bodies, obj)
+		}
+	default:
+		m.errorAt(item.Val.Pos(), "Cannot migrate block", fmt.Sprintf("The value of a %s block must be an object.", blockType))
+		return
+	}
+
+	for i, body := range bodies {
+		if len(labels) == 0 {
+			pos := body.Pos()
+			if i == 0 {
+				pos = item.Keys[0].Pos()
+			}
+			m.unlabelled(seen, blockType, pos)
+		}
+		if i > 0 {
+			m.buf.WriteByte('\n')
+		}
+		m.buf.WriteString(indent + blockType)
+		for _, label := range labels {
+			m.buf.WriteString(" " + strconv.Quote(label))
+		}
+		m.buf.WriteString(" {\n")
+		m.body(body.List, spec, indent+"  ")
+		m.buf.WriteString(indent + "}\n")
+	}
+	m.afterBlock = true
+}
+
+// unlabelled records an unlabelled block at pos in seen and warns, once per
+// body, when its type already has an unlabelled block there.
+func (m *migrator) unlabelled(seen map[string]hcl1token.Pos, blockType string, pos hcl1token.Pos) {
+	prev, repeated := seen[blockType]
+	if !repeated {
+		seen[blockType] = pos
+		return
+	}
+	// Keys of labelled blocks start with their type, so a leading space
+	// cannot clash with them.
+	if _, warned := seen[" "+blockType]; warned {
+		return
+	}
+	seen[" "+blockType] = pos
+
+	detail := fmt.Sprintf("A %s block without labels was declared at line %d. HCL1 merges repeated unlabelled blocks when it decodes them into one object, but HCL2 keeps them apart, and reports them as duplicates where only one is allowed.", blockType, prev.Line)
+	if blockType == "step" {
+		detail = fmt.Sprintf("A step block without labels was declared at line %d. HCL2 identifies unlabelled steps by their position, so inserting a step changes the ids that other steps refer to. Label each step, or run fmt -upgrade on the result, to give it a fixed id.", prev.Line)
+	}
+	m.warnAt(pos, "Repeated unlabelled block", detail)
+}
+
+// itemValue returns the HCL2 expression for the value of an attribute item.
+// Extra keys, as in foo "bar" { ... }, are HCL1's shorthand for nested
+// objects.
+func (m *migrator) itemValue(item *hcl1ast.ObjectItem, indent string) string {
+	val := item.Val
+	for i := len(item.Keys) - 1; i > 0; i-- {
+		val = &hcl1ast.ObjectType{
+			List: &hcl1ast.ObjectList{
+				Items: []*hcl1ast.ObjectItem{{Keys: item.Keys[i : i+1], Assign: item.Keys[i].Pos(), Val: val}},
+			},
+		}
+	}
+	if _, isObject := val.(*hcl1ast.ObjectType); isObject && !item.Assign.IsValid() {
+		m.warnAt(item.Keys[0].Pos(), "Block migrated to attribute", fmt.Sprintf("%q is not a block type of the suite, so it becomes an attribute with an object value, which is how HCL1 decodes it.", hcl1Key(item.Keys[0])))
+	}
+	return m.value(val, indent)
+}
+
+func (m *migrator) value(node hcl1ast.Node, indent string) string {
+	switch node := node.(type) {
+	case *hcl1ast.LiteralType:
+		return m.literal(node.Token, indent)
+
+	case *hcl1ast.ListType:
+		items := make([]string, 0, len(node.List))
+		multiline := false
+		for _, elem := range node.List {
+			if _, ok := elem.(*hcl1ast.ObjectType); ok {
+				multiline = true
+			}
+		}
+		for _, elem := range node.List {
+			if multiline {
+				items = append(items, indent+"  "+m.value(elem, indent+"  "))
+			} else {
+				items = append(items, m.value(elem, indent))
+			}
+		}
+		if multiline {
+			return "[\n" + strings.Join(items, ",\n") + ",\n" + indent + "]"
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+
+	case *hcl1ast.ObjectType:
+		if len(node.List.Items) == 0 {
+			return "{}"
+		}
+		last := make(map[string]*hcl1ast.ObjectItem)
+		for _, item := range node.List.Items {
+			last[hcl1Key(item.Keys[0])] = item
+		}
+		var buf bytes.Buffer
+		buf.WriteString("{\n")
+		for _, item := range node.List.Items {
+			name := hcl1Key(item.Keys[0])
+			if last[name] != item {
+				m.warnAt(item.Keys[0].Pos(), "Repeated attribute", fmt.Sprintf("The key %q is set more than once. HCL1 combines the values when decoding, but HCL2 does not allow it, so only the last is kept.", name))
+				continue
+			}
+			if !isIdentifier(name) {
+				name = hclQuote(name)
+			}
+			fmt.Fprintf(&buf, "%s  %s = %s\n", indent, name, m.itemValue(item, indent+"  "))
+		}
+		buf.WriteString(indent + "}")
+		return buf.String()
+	}
+
+	m.errorAt(node.Pos(), "Cannot migrate value", "The value has no HCL2 equivalent.")
+	return "null"
+}
+
+// literal converts a literal token. HCL1 leaves "${...}" sequences in
+// strings alone, but HCL2 evaluates them, so they are escaped to keep their
+// meaning.
+func (m *migrator) literal(tok hcl1token.Token, indent string) string {
+	switch tok.Type {
+	case hcl1token.NUMBER:
+		// HCL1 also accepts hexadecimal and octal numbers.
+		return strconv.FormatInt(tok.Value().(int64), 10)
+	case hcl1token.FLOAT, hcl1token.BOOL:
+		return tok.Text
+	case hcl1token.STRING, hcl1token.HEREDOC:
+	default:
+		m.errorAt(tok.Pos, "Cannot migrate value", fmt.Sprintf("The literal %s has no HCL2 equivalent.", tok.Text))
+		return "null"
+	}
+
+	s := tok.Value().(string)
+	if escaped := escapeTemplate(s); escaped != s {
+		m.warnAt(tok.Pos, "Interpolation escaped", "HCL1 does not evaluate \"${...}\" or \"%{...}\" sequences, but HCL2 does, so they are escaped to keep the string as it was. Remove the extra $ or % to evaluate them.")
+		s = escaped
+	}
+
+	if tok.Type == hcl1token.STRING {
+		return hclQuote(s)
+	}
+
+	marker := strings.TrimLeft(strings.SplitN(tok.Text, "\n", 2)[0], "<-")
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	// The vendored HCL2 parser needs a newline after the closing marker in
+	// addition to the one that ends the attribute.
+	return "<<" + marker + "\n" + s + marker + "\n"
+}
+
+// separate starts a new item with a blank line when it is a block, follows a
+// block, or was preceded by a blank line in the source. The first item of a
+// body is never separated.
+func (m *migrator) separate(item *hcl1ast.ObjectItem, block bool) {
+	if m.buf.Len() == 0 || bytes.HasSuffix(m.buf.Bytes(), []byte("{\n")) {
+		return
+	}
+
+	start := item.Keys[0].Pos().Offset
+	if item.LeadComment != nil {
+		start = item.LeadComment.List[0].Start.Offset
+	}
+	lineStart := bytes.LastIndexByte(m.src[:start], '\n')
+	blank := lineStart >= 0 && bytes.HasSuffix(bytes.TrimRight(m.src[:lineStart], " \t"), []byte("\n"))
+
+	if block || m.afterBlock || blank {
+		m.buf.WriteByte('\n')
+	}
+	m.afterBlock = false
+}
+
+// comment writes a lead comment. HCL1 comments are also valid in HCL2.
+func (m *migrator) comment(group *hcl1ast.CommentGroup, indent string) {
+	if group == nil {
+		return
+	}
+	for _, c := range group.List {
+		m.buf.WriteString(indent + strings.TrimRight(c.Text, "\n") + "\n")
+	}
+}
+
+// lineComment ends the current line, with the comment if there is one.
+func (m *migrator) lineComment(group *hcl1ast.CommentGroup) {
+	if group != nil {
+		for _, c := range group.List {
+			m.buf.WriteString(" " + strings.TrimRight(c.Text, "\n"))
+		}
+	}
+	m.buf.WriteByte('\n')
+}
+
+// hcl1StepType returns the value of the type attribute of a step body.
+func hcl1StepType(list *hcl1ast.ObjectList) string {
+	for _, item := range list.Items {
+		if hcl1Key(item.Keys[0]) != "type" {
+			continue
+		}
+		if lit, ok := item.Val.(*hcl1ast.LiteralType); ok && lit.Token.Type == hcl1token.STRING {
+			return lit.Token.Value().(string)
+		}
+	}
+	return ""
+}
+
+// hcl1Key returns the name held by an object key, which may be quoted.
+func hcl1Key(key *hcl1ast.ObjectKey) string {
+	if key.Token.Type == hcl1token.STRING {
+		return key.Token.Value().(string)
+	}
+	return key.Token.Text
+}
+
+// hcl1Diagnostic returns the diagnostic for an error from the HCL1 parser
+// or decoder.
+func hcl1Diagnostic(filename string, err error) *hcl.Diagnostic {
+	diag := &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid HCL1 syntax",
+		Detail:   fmt.Sprintf("The file %q could not be parsed as HCL1: %v.", filename, err),
+	}
+	if perr, ok := err.(*hcl1parser.PosError); ok {
+		diag.Detail = fmt.Sprintf("The file %q could not be parsed as HCL1: %v.", filename, perr.Err)
+		diag.Subject = hcl1Range(filename, perr.Pos)
+	}
+	return diag
+}
+
+func hcl1Range(filename string, pos hcl1token.Pos) *hcl.Range {
+	p := hcl.Pos{Byte: pos.Offset, Line: pos.Line, Column: pos.Column}
+	return &hcl.Range{Filename: filename, Start: p, End: p}
+}
+
+func (m *migrator) errorAt(pos hcl1token.Pos, summary, detail string) {
+	m.diags = append(m.diags, &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  summary,
+		Detail:   detail,
+		Subject:  hcl1Range(m.filename, pos),
+	})
+}
+
+func (m *migrator) warnAt(pos hcl1token.Pos, summary, detail string) {
+	m.diags = append(m.diags, &hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary:  summary,
+		Detail:   detail,
+		Subject:  hcl1Range(m.filename, pos),
+	})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/hcl2/hcl"
+)
+
+func TestMigrate(t *testing.T) {
+	src := `# Suite header.
+suitename = "s"
+
+variable "name" {
+  default = "${not}"
+}
+
+testcase {
+  casename = "c"
+  tags = ["a"]
+
+  step {
+    stepname = "first" // trailing
+    env {
+      HOME = "/root"
+    }
+  }
+}
+`
+	want := `# Suite header.
+suitename = "s"
+
+variable "name" {
+  default = "$${not}"
+}
+
+testcase {
+  casename = "c"
+  tags     = ["a"]
+
+  step {
+    stepname = "first" // trailing
+    env = {
+      HOME = "/root"
+    }
+  }
+}
+`
+	out, diags := migrate([]byte(src), "suite.hcl")
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	if string(out) != want {
+		t.Errorf("got\n%s\nwant\n%s", out, want)
+	}
+
+	var got []string
+	for _, diag := range diags {
+		got = append(got, fmt.Sprintf("%s at %d", diag.Summary, diag.Subject.Start.Line))
+	}
+	if want := []string{"Interpolation escaped at 5", "Block migrated to attribute at 14"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got warnings %q, want %q", got, want)
+	}
+}
+
+func TestMigrateWarnings(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "labelled step",
+			src: `testcase "c" {
+  step "named" {
+    command = "true"
+  }
+}
+`,
+			want: []string{"Step label becomes its id at 2"},
+		},
+		{
+			name: "repeated unlabelled steps",
+			src: `testcase "c" {
+  step {
+    stepname = "a"
+  }
+  step {
+    stepname = "b"
+  }
+  step {
+    stepname = "c"
+  }
+}
+`,
+			want: []string{"Repeated unlabelled block at 5"},
+		},
+		{
+			name: "list of unlabelled blocks",
+			src: `testcase "c" {
+  step = [
+    { stepname = "a" },
+    { stepname = "b" },
+  ]
+}
+`,
+			want: []string{"Repeated unlabelled block at 4"},
+		},
+		{
+			name: "repeated unlabelled testcases",
+			src: `testcase {
+  casename = "a"
+}
+testcase {
+  casename = "b"
+}
+`,
+			want: []string{"Repeated unlabelled block at 4"},
+		},
+		{
+			name: "repeated labelled blocks",
+			src: `variable "v" {}
+variable "v" {}
+`,
+			want: []string{"Repeated block at 2"},
+		},
+		{
+			name: "single blocks",
+			src: `testcase {
+  casename = "a"
+
+  step {
+    stepname = "a"
+  }
+}
+testcase "b" {}
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, diags := migrate([]byte(test.src), "suite.hcl")
+			var got []string
+			for _, diag := range diags {
+				if diag.Severity != hcl.DiagWarning {
+					t.Errorf("unexpected error: %s", diag.Error())
+				}
+				got = append(got, fmt.Sprintf("%s at %d", diag.Summary, diag.Subject.Start.Line))
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got warnings %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/hashicorp/hcl2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// upgradeNames maps the block types that can be labelled to the attribute
+// that names them in the older, unlabelled style.
+var upgradeNames = map[string]string{
+	"testcase": "casename",
+	"step":     "id",
+	"fixture":  "fixturename",
+}
+
+// sourceEdit replaces the source bytes [start, end) with text.
+type sourceEdit struct {
+	start, end int
+	text       string
+}
+
+// upgrade rewrites unlabelled testcase, step and fixture blocks into labelled
+// blocks, moving the name from its attribute into the label, and then
+// formats the result.
+//
+// A step without an id attribute is labelled with its position so that
+// references to it keep working, which also means that inserting a step
+// later no longer renumbers it. Blocks whose name is not a literal string
+// are left unchanged with a warning.
+func upgrade(src []byte, filename string) ([]byte, hcl.Diagnostics) {
+	f, diags := hclsyntax.ParseConfig(src, filename, hcl.Pos{Byte: 0, Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	var edits []sourceEdit
+	var walk func(body *hclsyntax.Body, parent string)
+	walk = func(body *hclsyntax.Body, parent string) {
+		steps := 0
+		for _, block := range body.Blocks {
+			if block.Type == "step" {
+				steps++
+			}
+			if !upgradable(parent, block.Type) {
+				continue
+			}
+			walk(block.Body, block.Type)
+			if len(block.Labels) > 0 {
+				continue
+			}
+
+			attrName := upgradeNames[block.Type]
+			attr, ok := block.Body.Attributes[attrName]
+			if !ok {
+				if block.Type == "step" {
+					edits = append(edits, labelEdit(block, strconv.Itoa(steps)))
+				}
+				continue
+			}
+
+			val, d := attr.Expr.Value(nil)
+			if d.HasErrors() || val.Type() != cty.String || val.IsNull() || !val.IsKnown() {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagWarning,
+					Summary:  "Cannot upgrade block",
+					Detail:   fmt.Sprintf("The %s attribute is not a literal string, so it cannot become the label of the %s.", attrName, block.Type),
+					Subject:  attr.Expr.Range().Ptr(),
+				})
+				continue
+			}
+
+			// The loader treats a blank id like a missing one.
+			label := val.AsString()
+			if block.Type == "step" && strings.TrimSpace(label) == "" {
+				label = strconv.Itoa(steps)
+			}
+			edits = append(edits, labelEdit(block, label), removeLineEdit(src, attr.SrcRange))
+		}
+	}
+	walk(f.Body.(*hclsyntax.Body), "")
+
+	// Apply the edits back to front so that the offsets of the remaining
+	// edits stay valid.
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+	out := append([]byte(nil), src...)
+	for _, edit := range edits {
+		out = append(out[:edit.start], append([]byte(edit.text), out[edit.end:]...)...)
+	}
+
+	return hclwrite.Format(out), diags
+}
+
+// upgradable reports whether a block of type blockType within a block of type
+// parent, or at the top level when parent is empty, is one that upgrade
+// labels.
+func upgradable(parent, blockType string) bool {
+	switch blockType {
+	case "testcase":
+		return parent == ""
+	case "fixture":
+		return parent == "" || parent == "testcase"
+	case "step":
+		// Top-level steps are those of module directories.
+		return parent == "" || parent == "testcase"
+	}
+	return false
+}
+
+// labelEdit inserts label after the type of block.
+func labelEdit(block *hclsyntax.Block, label string) sourceEdit {
+	end := block.TypeRange.End.Byte
+	return sourceEdit{start: end, end: end, text: " " + strconv.Quote(label)}
+}
+
+// removeLineEdit removes the line holding the attribute at rng, including any
+// comment that follows it on the same line. When the attribute opens its
+// block, a blank line that separated it from the rest of the block goes too.
+func removeLineEdit(src []byte, rng hcl.Range) sourceEdit {
+	start := bytes.LastIndexByte(src[:rng.Start.Byte], '\n') + 1
+	end := len(src)
+	if i := bytes.IndexByte(src[rng.End.Byte:], '\n'); i >= 0 {
+		end = rng.End.Byte + i + 1
+	}
+	if bytes.HasSuffix(bytes.TrimRight(src[:start], " \t\n"), []byte("{")) && end < len(src) && src[end] == '\n' {
+		end++
+	}
+	return sourceEdit{start: start, end: end}
+}
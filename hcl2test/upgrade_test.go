@@ -0,0 +1,179 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUpgrade(t *testing.T) {
+	tests := []struct {
+		name     string
+		src, out string
+	}{
+		{
+			name: "named blocks",
+			src: `suitename = "s"
+
+testcase {
+  casename = "c"
+
+  fixture {
+    fixturename = "f"
+    path        = "f"
+  }
+
+  step {
+    id       = "a" # the first step
+    stepname = "first"
+  }
+}
+`,
+			out: `suitename = "s"
+
+testcase "c" {
+  fixture "f" {
+    path = "f"
+  }
+
+  step "a" {
+    stepname = "first"
+  }
+}
+`,
+		},
+		{
+			name: "positional step ids",
+			src: `testcase "c" {
+  step {
+    stepname = "first"
+  }
+
+  step {
+    id       = " "
+    stepname = "second"
+  }
+
+  step "labelled" {}
+
+  step {
+    stepname = "fourth"
+    after    = ["1", "4"]
+  }
+}
+`,
+			out: `testcase "c" {
+  step "1" {
+    stepname = "first"
+  }
+
+  step "2" {
+    stepname = "second"
+  }
+
+  step "labelled" {}
+
+  step "4" {
+    stepname = "fourth"
+    after    = ["1", "4"]
+  }
+}
+`,
+		},
+		{
+			name: "module steps",
+			src: `step {
+  id      = "a"
+  command = "true"
+}
+`,
+			out: `step "a" {
+  command = "true"
+}
+`,
+		},
+		{
+			name: "other blocks",
+			src: `testcase "c" {
+  step "a" {
+    assert {
+      id = "x"
+    }
+  }
+}
+`,
+			out: `testcase "c" {
+  step "a" {
+    assert {
+      id = "x"
+    }
+  }
+}
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, diags := upgrade([]byte(test.src), "suite.hcl")
+			if len(diags) > 0 {
+				t.Fatalf("unexpected diagnostics: %s", diags.Error())
+			}
+			if string(out) != test.out {
+				t.Errorf("got\n%s\nwant\n%s", out, test.out)
+			}
+
+			again, _ := upgrade(out, "suite.hcl")
+			if string(again) != string(out) {
+				t.Errorf("upgrading the output changed it to\n%s", again)
+			}
+		})
+	}
+}
+
+func TestUpgradeNotLiteral(t *testing.T) {
+	src := `testcase {
+  casename = "${upper("c")}"
+}
+`
+	out, diags := upgrade([]byte(src), "suite.hcl")
+	if len(diags) != 1 || diags[0].Summary != "Cannot upgrade block" || diags.HasErrors() {
+		t.Fatalf("got diagnostics %v, want a warning", diags)
+	}
+	if got := diags[0].Subject.String(); got != "suite.hcl:2,14-29" {
+		t.Errorf("the warning is at %s", got)
+	}
+	if string(out) != src {
+		t.Errorf("the block was changed to\n%s", out)
+	}
+}
+
+func TestFmtUpgrade(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"suite.hcl": `suitename = "s"
+testcase {
+  casename = "c"
+  step {
+    stepname = "first"
+  }
+}
+`})
+
+	status, stdout, stderr := invoke(t, "fmt", "-upgrade", dir+"/suite.hcl")
+	if status != exitPass {
+		t.Fatalf("got exit status %d: %s", status, stderr)
+	}
+	want := `suitename = "s"
+testcase "c" {
+  step "1" {
+    stepname = "first"
+  }
+}
+`
+	if stdout != want {
+		t.Errorf("got\n%s\nwant\n%s", stdout, want)
+	}
+
+	status, stdout, _ = invoke(t, "fmt", "-upgrade", "-check", dir+"/suite.hcl")
+	if status != exitFail || !strings.Contains(stdout, "suite.hcl") {
+		t.Errorf("-check exited with %d and printed %q for a file that needs upgrading", status, stdout)
+	}
+}
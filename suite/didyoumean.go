@@ -0,0 +1,36 @@
+package suite
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/agext/levenshtein"
+)
+
+// nameSuggestion tries to find a name from the given slice of suggested names
+// that is close to the given name and returns it if found. If no suggestion
+// is close enough, returns the empty string.
+//
+// This is the same approach as the unexported helper of the same name in
+// hcl2, so our suggestions agree with the ones HCL itself produces.
+func nameSuggestion(given string, suggestions []string) string {
+	for _, suggestion := range suggestions {
+		dist := levenshtein.Distance(given, suggestion, nil)
+		if dist < 3 { // threshold determined experimentally
+			return suggestion
+		}
+	}
+	return ""
+}
+
+// didYouMean returns a sentence suggesting the closest of the given names, or
+// the empty string if none of them are close. The names are sorted first so
+// that the suggestion does not depend on map iteration order.
+func didYouMean(given string, names []string) string {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	if suggestion := nameSuggestion(given, sorted); suggestion != "" {
+		return fmt.Sprintf(" Did you mean %q?", suggestion)
+	}
+	return ""
+}
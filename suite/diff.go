@@ -0,0 +1,244 @@
+package suite
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// diffOp is one line of an edit script: ' ' for a line kept from both
+// inputs, '-' for a line only in the old input and '+' for a line only in the
+// new one.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// UnifiedDiff returns a unified diff turning old, named oldName, into new,
+// named newName, or nil if they are equal.
+func UnifiedDiff(oldName, newName string, old, new []byte) []byte {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+
+	ops := diffLines(splitLines(old), splitLines(new))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldName, newName)
+
+	// oldLine and newLine are the 1-based line numbers of ops[i].
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		// Grow the hunk until it is followed by more than twice the
+		// context of unchanged lines, so that nearby changes share a hunk.
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind == ' ' {
+				if j-end >= 2*diffContext {
+					break
+				}
+				continue
+			}
+			end = j + 1
+		}
+		stop := end + diffContext
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		hunkOld, hunkNew := oldLine-(i-start), newLine-(i-start)
+		var oldCount, newCount int
+		var body bytes.Buffer
+		for _, op := range ops[start:stop] {
+			switch op.kind {
+			case ' ':
+				oldCount++
+				newCount++
+			case '-':
+				oldCount++
+			case '+':
+				newCount++
+			}
+			body.WriteByte(op.kind)
+			body.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				body.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(hunkOld, oldCount), hunkRange(hunkNew, newCount))
+		buf.Write(body.Bytes())
+
+		for _, op := range ops[i:stop] {
+			if op.kind != '+' {
+				oldLine++
+			}
+			if op.kind != '-' {
+				newLine++
+			}
+		}
+		i = stop
+	}
+
+	return buf.Bytes()
+}
+
+// hunkRange formats the start and length of one side of a hunk. An empty
+// side is numbered from the line before it, as diff(1) does.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprintf("%d", start)
+	default:
+		return fmt.Sprintf("%d,%d", start, count)
+	}
+}
+
+// splitLines splits src after each newline, keeping the newlines.
+func splitLines(src []byte) []string {
+	lines := strings.SplitAfter(string(src), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns an edit script turning a into b.
+func diffLines(a, b []string) []diffOp {
+	d := &differ{a: a, b: b, ops: make([]diffOp, 0, len(a)+len(b))}
+	d.diff(0, len(a), 0, len(b))
+	return d.ops
+}
+
+// diffCostLimit bounds the number of edits the middle snake search looks
+// through from each end. Past it, the lines in between are reported as all
+// removed and then all added rather than as a minimal script, which keeps
+// the diff of very different inputs fast.
+const diffCostLimit = 4096
+
+// differ computes a shortest edit script with the linear space variant of
+// Myers' algorithm, from "An O(ND) Difference Algorithm and Its Variations".
+type differ struct {
+	a, b   []string
+	ops    []diffOp
+	vf, vb []int
+}
+
+// diff appends the edit script turning a[a0:a1] into b[b0:b1].
+func (d *differ) diff(a0, a1, b0, b1 int) {
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.ops = append(d.ops, diffOp{' ', d.a[a0]})
+		a0++
+		b0++
+	}
+	suffix := 0
+	for a0 < a1-suffix && b0 < b1-suffix && d.a[a1-suffix-1] == d.b[b1-suffix-1] {
+		suffix++
+	}
+	a1 -= suffix
+	b1 -= suffix
+
+	switch x, y, u, v, ok := d.middleSnake(a0, a1, b0, b1); {
+	case a0 == a1 || b0 == b1 || !ok:
+		for _, line := range d.a[a0:a1] {
+			d.ops = append(d.ops, diffOp{'-', line})
+		}
+		for _, line := range d.b[b0:b1] {
+			d.ops = append(d.ops, diffOp{'+', line})
+		}
+	default:
+		d.diff(a0, x, b0, y)
+		for _, line := range d.a[x:u] {
+			d.ops = append(d.ops, diffOp{' ', line})
+		}
+		d.diff(u, a1, v, b1)
+	}
+
+	for _, line := range d.a[a1 : a1+suffix] {
+		d.ops = append(d.ops, diffOp{' ', line})
+	}
+}
+
+// middleSnake returns the middle snake of a shortest edit script turning
+// a[a0:a1] into b[b0:b1], the run of equal lines from a[x], b[y] up to a[u],
+// b[v] that splits the script into two halves of at most half its length.
+// It reports false if the script needs more than 2*diffCostLimit edits, or
+// if either side is empty.
+func (d *differ) middleSnake(a0, a1, b0, b1 int) (x, y, u, v int, ok bool) {
+	n, m := a1-a0, b1-b0
+	if n == 0 || m == 0 {
+		return 0, 0, 0, 0, false
+	}
+	maxD := (n + m + 1) / 2
+	if maxD > diffCostLimit {
+		maxD = diffCostLimit
+	}
+
+	// vf[off+k] is the furthest x reached from the start on diagonal
+	// k = x-y, and vb[off+c] the furthest distance reached back from the
+	// end on diagonal c = (n-x)-(m-y), both relative to a0 and b0.
+	off := maxD + 1
+	if size := 2*maxD + 3; cap(d.vf) < size {
+		d.vf = make([]int, size)
+		d.vb = make([]int, size)
+	}
+	vf, vb := d.vf[:2*maxD+3], d.vb[:2*maxD+3]
+	vf[off+1], vb[off+1] = 0, 0
+
+	delta := n - m
+	odd := delta%2 != 0
+	for e := 0; e <= maxD; e++ {
+		for k := -e; k <= e; k += 2 {
+			var px int
+			if k == -e || (k != e && vf[off+k-1] < vf[off+k+1]) {
+				px = vf[off+k+1]
+			} else {
+				px = vf[off+k-1] + 1
+			}
+			py := px - k
+			sx, sy := px, py
+			for px < n && py < m && d.a[a0+px] == d.b[b0+py] {
+				px++
+				py++
+			}
+			vf[off+k] = px
+			if c := delta - k; odd && c >= -(e-1) && c <= e-1 && px+vb[off+c] >= n {
+				return a0 + sx, b0 + sy, a0 + px, b0 + py, true
+			}
+		}
+		for c := -e; c <= e; c += 2 {
+			var px int
+			if c == -e || (c != e && vb[off+c-1] < vb[off+c+1]) {
+				px = vb[off+c+1]
+			} else {
+				px = vb[off+c-1] + 1
+			}
+			py := px - c
+			sx, sy := px, py
+			for px < n && py < m && d.a[a1-px-1] == d.b[b1-py-1] {
+				px++
+				py++
+			}
+			vb[off+c] = px
+			if k := delta - c; !odd && k >= -e && k <= e && vf[off+k]+px >= n {
+				return a1 - px, b1 - py, a1 - sx, b1 - sy, true
+			}
+		}
+	}
+	return 0, 0, 0, 0, false
+}
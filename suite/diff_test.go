@@ -0,0 +1,136 @@
+package suite
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{
+			name: "equal",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: "",
+		},
+		{
+			name: "changed line",
+			old:  "a\nb\nc\n",
+			new:  "a\nx\nc\n",
+			want: "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+		},
+		{
+			name: "added to empty",
+			old:  "",
+			new:  "a\n",
+			want: "--- old\n+++ new\n@@ -0,0 +1 @@\n+a\n",
+		},
+		{
+			name: "missing newline",
+			old:  "a\nb\n",
+			new:  "a\nb",
+			want: "--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n+b\n\\ No newline at end of file\n",
+		},
+		{
+			name: "separate hunks",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			new:  "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n",
+			want: "--- old\n+++ new\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -9,4 +10,3 @@\n 9\n 10\n 11\n-12\n",
+		},
+		{
+			name: "nearby changes share a hunk",
+			old:  "a\nb\nc\nd\ne\nf\ng\n",
+			new:  "a\nB\nc\nd\ne\nF\ng\n",
+			want: "--- old\n+++ new\n@@ -1,7 +1,7 @@\n a\n-b\n+B\n c\n d\n e\n-f\n+F\n g\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := string(UnifiedDiff("old", "new", []byte(test.old), []byte(test.new)))
+			if got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+// lcsLength returns the length of the longest common subsequence of a and b.
+func lcsLength(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] >= cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func TestDiffLinesShortest(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rnd.Intn(40))
+		for i := range lines {
+			lines[i] = string(rune('a' + rnd.Intn(4)))
+		}
+		return lines
+	}
+
+	for i := 0; i < 500; i++ {
+		a, b := randomLines(), randomLines()
+		ops := diffLines(a, b)
+
+		var gotA, gotB []string
+		kept := 0
+		for _, op := range ops {
+			if op.kind != '+' {
+				gotA = append(gotA, op.line)
+			}
+			if op.kind != '-' {
+				gotB = append(gotB, op.line)
+			}
+			if op.kind == ' ' {
+				kept++
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("the script for %q and %q does not turn one into the other: %v", a, b, ops)
+		}
+		if want := lcsLength(a, b); kept != want {
+			t.Fatalf("the script for %q and %q keeps %d lines, want %d", a, b, kept, want)
+		}
+	}
+}
+
+func TestUnifiedDiffLarge(t *testing.T) {
+	var old, new strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&old, "old line %d\n", i)
+		fmt.Fprintf(&new, "new line %d\n", i)
+	}
+
+	start := time.Now()
+	diff := UnifiedDiff("old", "new", []byte(old.String()), []byte(new.String()))
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("the diff of 20000 changed lines took %s", elapsed)
+	}
+	if !strings.HasPrefix(string(diff), "--- old\n+++ new\n@@ -1,20000 +1,20000 @@\n-old line 0\n") {
+		t.Errorf("unexpected diff start %q", diff[:60])
+	}
+}
@@ -0,0 +1,388 @@
+package suite
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl2/gohcl"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+var dynamicBlockHeader = hcl.BlockHeaderSchema{Type: "dynamic", LabelNames: []string{"type"}}
+
+var dynamicBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "for_each", Required: true},
+		{Name: "iterator"},
+		{Name: "labels"},
+	},
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "content"},
+	},
+}
+
+// dynamicBody expands the dynamic blocks of a step or fixture body into the
+// blocks they generate, in the manner of the dynblock extension of HCL:
+//
+//	dynamic "assert" {
+//	  for_each = ["a.txt", "b.txt"]
+//	  content {
+//	    path = assert.value
+//	  }
+//	}
+//
+// generates an assert block for each element of for_each. Within content the
+// element is available as <iterator>.key and <iterator>.value, where the
+// iterator is the block type unless the iterator attribute names another.
+// Dynamic blocks can only generate the block types of the schema the body is
+// decoded with, or of the body itself for free-form bodies.
+type dynamicBody struct {
+	body hcl.Body
+
+	// ctx evaluates for_each and labels, and iteration holds the
+	// iterators of the dynamic blocks that generated the body, if any.
+	ctx       *hcl.EvalContext
+	iteration *iteration
+}
+
+// expandDynamic returns body with its dynamic blocks expanded using ctx.
+func expandDynamic(body hcl.Body, ctx *hcl.EvalContext) hcl.Body {
+	return &dynamicBody{body: body, ctx: ctx}
+}
+
+// expanded returns a copy of the step for its type to run, whose Config has
+// its dynamic blocks expanded using ctx.
+func (s *TestStep) expanded(ctx *hcl.EvalContext) *TestStep {
+	step := *s
+	step.Config = expandDynamic(s.Config, ctx)
+	return &step
+}
+
+func (b *dynamicBody) Content(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	content, diags := b.body.Content(extendedSchema(schema))
+	return b.expand(schema, content, diags)
+}
+
+func (b *dynamicBody) PartialContent(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Body, hcl.Diagnostics) {
+	content, remain, diags := b.body.PartialContent(extendedSchema(schema))
+	content, diags = b.expand(schema, content, diags)
+	return content, &dynamicBody{body: remain, ctx: b.ctx, iteration: b.iteration}, diags
+}
+
+func (b *dynamicBody) JustAttributes() (hcl.Attributes, hcl.Diagnostics) {
+	attrs, diags := b.body.JustAttributes()
+	return b.wrapAttributes(attrs), diags
+}
+
+func (b *dynamicBody) MissingItemRange() hcl.Range {
+	return b.body.MissingItemRange()
+}
+
+// extendedSchema adds dynamic blocks to schemas that accept any blocks.
+func extendedSchema(schema *hcl.BodySchema) *hcl.BodySchema {
+	if len(schema.Blocks) == 0 {
+		return schema
+	}
+	return &hcl.BodySchema{
+		Attributes: schema.Attributes,
+		Blocks:     append(append([]hcl.BlockHeaderSchema(nil), schema.Blocks...), dynamicBlockHeader),
+	}
+}
+
+func (b *dynamicBody) expand(schema *hcl.BodySchema, content *hcl.BodyContent, diags hcl.Diagnostics) (*hcl.BodyContent, hcl.Diagnostics) {
+	expanded := &hcl.BodyContent{
+		Attributes:       b.wrapAttributes(content.Attributes),
+		MissingItemRange: content.MissingItemRange,
+	}
+	for _, block := range content.Blocks {
+		if block.Type != "dynamic" {
+			wrapped := *block
+			wrapped.Body = &dynamicBody{body: block.Body, ctx: b.ctx, iteration: b.iteration}
+			expanded.Blocks = append(expanded.Blocks, &wrapped)
+			continue
+		}
+		blocks, d := b.expandBlock(schema, block)
+		diags = append(diags, d...)
+		expanded.Blocks = append(expanded.Blocks, blocks...)
+	}
+	return expanded, diags
+}
+
+// expandBlock returns the blocks generated by a dynamic block.
+func (b *dynamicBody) expandBlock(schema *hcl.BodySchema, block *hcl.Block) (hcl.Blocks, hcl.Diagnostics) {
+	blockType := block.Labels[0]
+	var blockS *hcl.BlockHeaderSchema
+	names := make([]string, 0, len(schema.Blocks))
+	for i := range schema.Blocks {
+		names = append(names, schema.Blocks[i].Type)
+		if schema.Blocks[i].Type == blockType {
+			blockS = &schema.Blocks[i]
+		}
+	}
+	if blockS == nil {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Unsupported block type",
+			Detail:   fmt.Sprintf("Blocks of type %q are not expected here, so a dynamic block cannot generate them.%s", blockType, didYouMean(blockType, names)),
+			Subject:  block.LabelRanges[0].Ptr(),
+		}}
+	}
+
+	spec, diags := block.Body.Content(dynamicBlockSchema)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	contents := spec.Blocks.OfType("content")
+	if len(contents) != 1 {
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid dynamic block",
+			Detail:   fmt.Sprintf("A dynamic block must have exactly one content block, but this one has %d.", len(contents)),
+			Subject:  block.DefRange.Ptr(),
+		})
+	}
+
+	iterName, d := dynamicIterator(block, spec)
+	diags = append(diags, d...)
+	if d.HasErrors() {
+		return nil, diags
+	}
+
+	forEachAttr := spec.Attributes["for_each"]
+	forEach, d := forEachAttr.Expr.Value(b.iteration.evalContext(b.ctx))
+	diags = append(diags, d...)
+	if d.HasErrors() {
+		return nil, diags
+	}
+	if forEach.IsNull() || !forEach.IsKnown() || !forEach.CanIterateElements() {
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid dynamic for_each value",
+			Detail:   fmt.Sprintf("The for_each argument must be a map, set, list or tuple, but is %s.", forEach.Type().FriendlyName()),
+			Subject:  forEachAttr.Expr.Range().Ptr(),
+		})
+	}
+
+	var blocks hcl.Blocks
+	for it := forEach.ElementIterator(); it.Next(); {
+		key, val := it.Element()
+		iter := &iteration{
+			name:   iterName,
+			value:  cty.ObjectVal(map[string]cty.Value{"key": key, "value": val}),
+			parent: b.iteration,
+		}
+
+		generated := &hcl.Block{
+			Type:      blockType,
+			Body:      &dynamicBody{body: contents[0].Body, ctx: b.ctx, iteration: iter},
+			DefRange:  block.DefRange,
+			TypeRange: block.TypeRange,
+		}
+		if attr, ok := spec.Attributes["labels"]; ok {
+			d := gohcl.DecodeExpression(attr.Expr, iter.evalContext(b.ctx), &generated.Labels)
+			diags = append(diags, d...)
+			if d.HasErrors() {
+				return nil, diags
+			}
+			for range generated.Labels {
+				generated.LabelRanges = append(generated.LabelRanges, attr.Expr.Range())
+			}
+		}
+		if len(generated.Labels) != len(blockS.LabelNames) {
+			return nil, append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Wrong number of block labels",
+				Detail:   fmt.Sprintf("Blocks of type %q have %d labels, but the dynamic block generates %d.", blockType, len(blockS.LabelNames), len(generated.Labels)),
+				Subject:  block.DefRange.Ptr(),
+			})
+		}
+		blocks = append(blocks, generated)
+	}
+	return blocks, diags
+}
+
+// dynamicIterator returns the name of the iterator of a dynamic block.
+func dynamicIterator(block *hcl.Block, spec *hcl.BodyContent) (string, hcl.Diagnostics) {
+	attr, ok := spec.Attributes["iterator"]
+	if !ok {
+		return block.Labels[0], nil
+	}
+	traversal, diags := hcl.AbsTraversalForExpr(attr.Expr)
+	if diags.HasErrors() || len(traversal) != 1 {
+		return "", hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid dynamic iterator name",
+			Detail:   "The iterator must be a single identifier.",
+			Subject:  attr.Expr.Range().Ptr(),
+		}}
+	}
+	return traversal.RootName(), nil
+}
+
+func (b *dynamicBody) wrapAttributes(attrs hcl.Attributes) hcl.Attributes {
+	if b.iteration == nil {
+		return attrs
+	}
+	wrapped := make(hcl.Attributes, len(attrs))
+	for name, attr := range attrs {
+		a := *attr
+		a.Expr = &iterationExpr{Expression: attr.Expr, iteration: b.iteration}
+		wrapped[name] = &a
+	}
+	return wrapped
+}
+
+// iteration is the iterator of a dynamic block for one of the blocks it
+// generates, within those of any enclosing dynamic blocks.
+type iteration struct {
+	name   string
+	value  cty.Value
+	parent *iteration
+}
+
+// evalContext returns ctx with the iterators of it added.
+func (it *iteration) evalContext(ctx *hcl.EvalContext) *hcl.EvalContext {
+	if it == nil {
+		return ctx
+	}
+	child := it.parent.evalContext(ctx).NewChild()
+	child.Variables = map[string]cty.Value{it.name: it.value}
+	return child
+}
+
+func (it *iteration) declares(name string) bool {
+	for ; it != nil; it = it.parent {
+		if it.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// iterationExpr is an expression within the content of a dynamic block,
+// which is evaluated with the iterators of the block it belongs to.
+type iterationExpr struct {
+	hcl.Expression
+	iteration *iteration
+}
+
+func (e *iterationExpr) Value(ctx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	return e.Expression.Value(e.iteration.evalContext(ctx))
+}
+
+func (e *iterationExpr) Variables() []hcl.Traversal {
+	var traversals []hcl.Traversal
+	for _, traversal := range e.Expression.Variables() {
+		if !e.iteration.declares(traversal.RootName()) {
+			traversals = append(traversals, traversal)
+		}
+	}
+	return traversals
+}
+
+// dynamicIterators returns the names of the iterators of the dynamic blocks
+// within body, whose references are not to variables of the suite.
+func dynamicIterators(body hcl.Body, names map[string]bool) map[string]bool {
+	if names == nil {
+		names = make(map[string]bool)
+	}
+	switch body := body.(type) {
+	case *templateBody:
+		dynamicIterators(body.template, names)
+		dynamicIterators(body.step, names)
+	case *dynamicBody:
+		dynamicIterators(body.body, names)
+	case *hclsyntax.Body:
+		// Dynamic blocks may be nested within any other blocks.
+		for _, block := range body.Blocks {
+			if block.Type == "dynamic" && len(block.Labels) == 1 {
+				spec, _, _ := block.Body.PartialContent(dynamicBlockSchema)
+				if name, d := dynamicIterator(block.AsHCLBlock(), spec); !d.HasErrors() {
+					names[name] = true
+				}
+			}
+			dynamicIterators(block.Body, names)
+		}
+	default:
+		content, _, _ := body.PartialContent(&hcl.BodySchema{Blocks: []hcl.BlockHeaderSchema{dynamicBlockHeader}})
+		for _, block := range content.Blocks {
+			spec, _, _ := block.Body.PartialContent(dynamicBlockSchema)
+			if name, d := dynamicIterator(block, spec); !d.HasErrors() {
+				names[name] = true
+			}
+			for _, content := range spec.Blocks {
+				dynamicIterators(content.Body, names)
+			}
+		}
+	}
+	return names
+}
+
+// freeFormSchema returns a schema that accepts exactly the content of a
+// body whose steps or fixtures have no schema, with the blocks of its
+// dynamic blocks, or nil if the body is in the JSON syntax, which cannot
+// tell blocks from object attributes without a schema.
+func freeFormSchema(body hcl.Body) *hcl.BodySchema {
+	switch body := body.(type) {
+	case *hclsyntax.Body:
+		schema := &hcl.BodySchema{}
+		for name := range body.Attributes {
+			schema.Attributes = append(schema.Attributes, hcl.AttributeSchema{Name: name})
+		}
+		for _, block := range body.Blocks {
+			schema.Blocks = appendBlockHeader(schema.Blocks, hcl.BlockHeaderSchema{
+				Type:       block.Type,
+				LabelNames: make([]string, len(block.Labels)),
+			})
+		}
+		return schema
+	case *templateBody:
+		template, step := freeFormSchema(body.template), freeFormSchema(body.step)
+		if template == nil || step == nil {
+			return nil
+		}
+		schema := &hcl.BodySchema{Attributes: append(template.Attributes, step.Attributes...)}
+		for _, blockS := range append(template.Blocks, step.Blocks...) {
+			schema.Blocks = appendBlockHeader(schema.Blocks, blockS)
+		}
+		return schema
+	case *dynamicBody:
+		inner := freeFormSchema(body.body)
+		if inner == nil {
+			return nil
+		}
+		schema := &hcl.BodySchema{Attributes: inner.Attributes}
+		for _, blockS := range inner.Blocks {
+			if blockS.Type != "dynamic" {
+				schema.Blocks = appendBlockHeader(schema.Blocks, blockS)
+			}
+		}
+		content, _, _ := body.body.PartialContent(&hcl.BodySchema{Blocks: []hcl.BlockHeaderSchema{dynamicBlockHeader}})
+		for _, block := range content.Blocks {
+			schema.Blocks = appendBlockHeader(schema.Blocks, hcl.BlockHeaderSchema{Type: block.Labels[0]})
+		}
+		return schema
+	}
+	return nil
+}
+
+func appendBlockHeader(blocks []hcl.BlockHeaderSchema, blockS hcl.BlockHeaderSchema) []hcl.BlockHeaderSchema {
+	for _, existing := range blocks {
+		if existing.Type == blockS.Type {
+			return blocks
+		}
+	}
+	return append(blocks, blockS)
+}
+
+// freeFormContent returns the attributes and blocks of a body without a
+// schema. Bodies in the JSON syntax only have attributes.
+func freeFormContent(body hcl.Body) (*hcl.BodyContent, hcl.Diagnostics) {
+	schema := freeFormSchema(body)
+	if schema == nil {
+		attrs, diags := body.JustAttributes()
+		return &hcl.BodyContent{Attributes: attrs, MissingItemRange: body.MissingItemRange()}, diags
+	}
+	return body.Content(schema)
+}
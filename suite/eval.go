@@ -0,0 +1,61 @@
+package suite
+
+import (
+	"sort"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+// Functions is the table of functions available to every expression in a
+// suite.
+var Functions = map[string]function.Function{
+	"abs":        stdlib.AbsoluteFunc,
+	"coalesce":   stdlib.CoalesceFunc,
+	"concat":     stdlib.ConcatFunc,
+	"hasindex":   stdlib.HasIndexFunc,
+	"int":        stdlib.IntFunc,
+	"jsondecode": stdlib.JSONDecodeFunc,
+	"jsonencode": stdlib.JSONEncodeFunc,
+	"length":     stdlib.LengthFunc,
+	"lower":      stdlib.LowerFunc,
+	"max":        stdlib.MaxFunc,
+	"min":        stdlib.MinFunc,
+	"reverse":    stdlib.ReverseFunc,
+	"strlen":     stdlib.StrlenFunc,
+	"substr":     stdlib.SubstrFunc,
+	"upper":      stdlib.UpperFunc,
+}
+
+// EvalContext returns the evaluation context shared by every expression in
+// the suite: the suite variables, the locals and the function table. Runtime
+// values such as fixtures and step outputs are layered on top in child
+// contexts.
+func (ts *TestSuite) EvalContext() *hcl.EvalContext {
+	vars := make(map[string]cty.Value, len(ts.Variables)+1)
+	for name, v := range ts.Variables {
+		vars[name] = v.Value
+	}
+	locals := make(map[string]cty.Value, len(ts.Locals))
+	for name, local := range ts.Locals {
+		locals[name] = local.Value
+	}
+	vars["local"] = cty.ObjectVal(locals)
+
+	return &hcl.EvalContext{
+		Variables: vars,
+		Functions: Functions,
+	}
+}
+
+// VariableNames returns the names of the suite variables in lexical order.
+func (ts *TestSuite) VariableNames() []string {
+	names := make([]string, 0, len(ts.Variables))
+	for name := range ts.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
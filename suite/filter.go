@@ -0,0 +1,87 @@
+package suite
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Filter selects the testcases and steps that a Loader keeps. Filtering
+// happens before the dependency graphs are built: steps that are filtered
+// out are left out of their testcase entirely, and before or after
+// references to them are ignored.
+type Filter struct {
+	// run holds one pattern per slash-separated element of the -run
+	// expression. A nil pattern matches everything.
+	run      []*regexp.Regexp
+	tags     tagExpr
+	skipTags tagExpr
+}
+
+// NewFilter returns a Filter for the given command line expressions, any of
+// which may be empty.
+//
+// run is a regular expression split on slashes as with go test -run: the
+// first element must match the testcase name and the second, if present,
+// the step id. tags and skipTags are tag expressions such as "slow,db" or
+// "slow and not db": a step is kept if it matches tags, when tags is given,
+// and does not match skipTags. A step has the tags of its testcase in
+// addition to its own.
+func NewFilter(run, tags, skipTags string) (*Filter, error) {
+	f := &Filter{}
+	var err error
+	if f.tags, err = parseTagExpr(tags); err != nil {
+		return nil, fmt.Errorf("invalid -tags expression %q: %v", tags, err)
+	}
+	if f.skipTags, err = parseTagExpr(skipTags); err != nil {
+		return nil, fmt.Errorf("invalid -skip-tags expression %q: %v", skipTags, err)
+	}
+
+	if run != "" {
+		for _, elem := range strings.Split(run, "/") {
+			if elem == "" {
+				f.run = append(f.run, nil)
+				continue
+			}
+			re, err := regexp.Compile(elem)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -run expression %q: %v", run, err)
+			}
+			f.run = append(f.run, re)
+		}
+		if len(f.run) > 2 {
+			return nil, fmt.Errorf("invalid -run expression %q: expected at most case/step", run)
+		}
+	}
+
+	return f, nil
+}
+
+// matchCase reports whether a testcase with the given name can be kept.
+func (f *Filter) matchCase(name string) bool {
+	return f.matchRun(0, name)
+}
+
+// matchStep reports whether step, in a testcase with the given tags, is
+// kept.
+func (f *Filter) matchStep(caseTags []string, step *TestStep) bool {
+	if !f.matchRun(1, step.id) {
+		return false
+	}
+	return f.matchTags(append(append([]string(nil), caseTags...), step.Tags...))
+}
+
+// matchTags reports whether an item with the given tags is kept.
+func (f *Filter) matchTags(tags []string) bool {
+	if f.tags != nil && !f.tags.match(tags) {
+		return false
+	}
+	return f.skipTags == nil || !f.skipTags.match(tags)
+}
+
+func (f *Filter) matchRun(elem int, s string) bool {
+	if elem >= len(f.run) || f.run[elem] == nil {
+		return true
+	}
+	return f.run[elem].MatchString(s)
+}
@@ -0,0 +1,322 @@
+package suite
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+var caseParamSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "for_each"},
+	},
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "matrix"},
+	},
+}
+
+// caseInstance is one of the testcases a testcase block expands into. The
+// key is empty and each is cty.NilVal for a block without for_each or a
+// matrix, which expands into a single testcase.
+type caseInstance struct {
+	key  string
+	each cty.Value
+}
+
+// evalContext returns ctx with each added for an expanded testcase.
+func (inst caseInstance) evalContext(ctx *hcl.EvalContext) *hcl.EvalContext {
+	if inst.each == cty.NilVal {
+		return ctx
+	}
+	child := ctx.NewChild()
+	child.Variables = map[string]cty.Value{"each": inst.each}
+	return child
+}
+
+// expandTestCase returns the instances of a testcase block: one for each
+// element of its for_each, one for each combination of the values in its
+// matrix block, or just one when it has neither.
+func expandTestCase(block *hcl.Block, ctx *hcl.EvalContext) ([]caseInstance, hcl.Diagnostics) {
+	content, _, diags := block.Body.PartialContent(caseParamSchema)
+	diags = relocateJSONDiagnostics(block.Body, diags)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	forEach := content.Attributes["for_each"]
+	matrices := content.Blocks.OfType("matrix")
+	switch {
+	case forEach != nil && len(matrices) > 0:
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Conflicting testcase parameters",
+			Detail:   "A testcase can be expanded by for_each or by a matrix block, but not both.",
+			Subject:  matrices[0].DefRange.Ptr(),
+		}}
+	case len(matrices) > 1:
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Duplicate matrix block",
+			Detail:   fmt.Sprintf("A testcase can have only one matrix block, and one was already declared at %s.", matrices[0].DefRange),
+			Subject:  matrices[1].DefRange.Ptr(),
+		}}
+	case forEach != nil:
+		return forEachInstances(block.Body, forEach, ctx)
+	case len(matrices) == 1:
+		return matrixInstances(matrices[0], ctx)
+	}
+	return []caseInstance{{}}, diags
+}
+
+// forEachInstances expands a map or object into one instance per element,
+// keyed by the element's key, and a set or list of strings into one instance
+// per string, keyed by the string itself.
+func forEachInstances(body hcl.Body, attr *hcl.Attribute, ctx *hcl.EvalContext) ([]caseInstance, hcl.Diagnostics) {
+	val, diags := attr.Expr.Value(ctx)
+	diags = relocateJSONDiagnostics(body, diags)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	invalid := func(detail string, args ...interface{}) ([]caseInstance, hcl.Diagnostics) {
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid for_each argument",
+			Detail:   fmt.Sprintf(detail, args...),
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+	}
+
+	ty := val.Type()
+	if val.IsNull() {
+		return invalid("The for_each argument must be a map, or a set or list of strings, but is null.")
+	}
+
+	var instances []caseInstance
+	switch {
+	case ty.IsMapType() || ty.IsObjectType():
+		for it := val.ElementIterator(); it.Next(); {
+			key, elem := it.Element()
+			if strings.Contains(key.AsString(), "/") {
+				return invalid("The for_each key %q contains a slash, which cannot be used in a testcase name since -run and -target split names at slashes.", key.AsString())
+			}
+			instances = append(instances, newCaseInstance(key.AsString(), elem))
+		}
+	case ty.IsSetType() || ty.IsListType() || ty.IsTupleType():
+		seen := make(map[string]bool, val.LengthInt())
+		for it := val.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			str, err := convert.Convert(elem, cty.String)
+			if err != nil || str.IsNull() {
+				return invalid("Every element of a for_each list must be a string, but one is %s.", elem.Type().FriendlyName())
+			}
+			key := str.AsString()
+			if strings.Contains(key, "/") {
+				return invalid("The for_each element %q contains a slash, which cannot be used in a testcase name since -run and -target split names at slashes.", key)
+			}
+			if seen[key] {
+				return invalid("The for_each list contains %q more than once, but each element names a testcase.", key)
+			}
+			seen[key] = true
+			instances = append(instances, newCaseInstance(key, str))
+		}
+	default:
+		return invalid("The for_each argument must be a map, or a set or list of strings, but is %s.", ty.FriendlyName())
+	}
+	return instances, diags
+}
+
+// matrixInstances expands a matrix block into one instance per combination
+// of the values of its attributes, each of which is a list. The instance is
+// keyed by the combination, such as os=linux,mode=fast, and each.value is an
+// object holding it. Earlier attributes vary slowest.
+func matrixInstances(block *hcl.Block, ctx *hcl.EvalContext) ([]caseInstance, hcl.Diagnostics) {
+	attrs, diags := block.Body.JustAttributes()
+	diags = relocateJSONDiagnostics(block.Body, diags)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	sorted := make([]*hcl.Attribute, 0, len(attrs))
+	for _, attr := range attrs {
+		sorted = append(sorted, attr)
+	}
+	sorted = sortedAttributes(sorted)
+	if len(sorted) == 0 {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Empty matrix block",
+			Detail:   "A matrix block must set at least one attribute to a list of values.",
+			Subject:  block.DefRange.Ptr(),
+		}}
+	}
+
+	type dimension struct {
+		name   string
+		values []cty.Value
+		labels []string
+	}
+	dims := make([]dimension, 0, len(sorted))
+	for _, attr := range sorted {
+		val, d := attr.Expr.Value(ctx)
+		diags = append(diags, relocateJSONDiagnostics(block.Body, d)...)
+		if d.HasErrors() {
+			continue
+		}
+
+		ty := val.Type()
+		if val.IsNull() || !(ty.IsListType() || ty.IsTupleType() || ty.IsSetType()) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid matrix values",
+				Detail:   fmt.Sprintf("The matrix attribute %q must be a list of values.", attr.Name),
+				Subject:  attr.Expr.Range().Ptr(),
+			})
+			continue
+		}
+
+		dim := dimension{name: attr.Name}
+		for it := val.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			str, err := convert.Convert(elem, cty.String)
+			if err != nil || str.IsNull() {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid matrix values",
+					Detail:   fmt.Sprintf("The values of the matrix attribute %q must be strings, numbers or bools, but one is %s.", attr.Name, elem.Type().FriendlyName()),
+					Subject:  attr.Expr.Range().Ptr(),
+				})
+				break
+			}
+			if strings.Contains(str.AsString(), "/") {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid matrix values",
+					Detail:   fmt.Sprintf("The value %q of the matrix attribute %q contains a slash, which cannot be used in a testcase name since -run and -target split names at slashes.", str.AsString(), attr.Name),
+					Subject:  attr.Expr.Range().Ptr(),
+				})
+				break
+			}
+			dim.values = append(dim.values, elem)
+			dim.labels = append(dim.labels, attr.Name+"="+str.AsString())
+		}
+		if len(dim.values) == 0 && !diags.HasErrors() {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagWarning,
+				Summary:  "Empty matrix values",
+				Detail:   fmt.Sprintf("The matrix attribute %q has no values, so the testcase expands into no testcases at all.", attr.Name),
+				Subject:  attr.Expr.Range().Ptr(),
+			})
+		}
+		dims = append(dims, dim)
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	instances := []caseInstance{{}}
+	combos := []map[string]cty.Value{{}}
+	for _, dim := range dims {
+		var nextInstances []caseInstance
+		var nextCombos []map[string]cty.Value
+		for i, inst := range instances {
+			for j, val := range dim.values {
+				combo := make(map[string]cty.Value, len(combos[i])+1)
+				for name, v := range combos[i] {
+					combo[name] = v
+				}
+				combo[dim.name] = val
+
+				key := dim.labels[j]
+				if inst.key != "" {
+					key = inst.key + "," + key
+				}
+				nextInstances = append(nextInstances, caseInstance{key: key})
+				nextCombos = append(nextCombos, combo)
+			}
+		}
+		instances, combos = nextInstances, nextCombos
+	}
+
+	for i := range instances {
+		instances[i] = newCaseInstance(instances[i].key, cty.ObjectVal(combos[i]))
+	}
+	return instances, diags
+}
+
+func newCaseInstance(key string, value cty.Value) caseInstance {
+	return caseInstance{
+		key: key,
+		each: cty.ObjectVal(map[string]cty.Value{
+			"key":   cty.StringVal(key),
+			"value": value,
+		}),
+	}
+}
+
+// evalContext returns ctx with each added if tc was expanded by for_each or
+// a matrix.
+func (tc *TestCase) evalContext(ctx *hcl.EvalContext) *hcl.EvalContext {
+	return caseInstance{each: tc.each}.evalContext(ctx)
+}
+
+// instanceName returns the name of the instance of the testcase name, such
+// as case1[os=linux,mode=fast].
+func (inst caseInstance) instanceName(name string) string {
+	if inst.each == cty.NilVal {
+		return name
+	}
+	return name + "[" + inst.key + "]"
+}
+
+// uniqueDiagnostics returns the diagnostics of diags not already in seen,
+// keyed by summary and subject, and adds them to seen. Every instance of a
+// testcase block is decoded from the same body, so the diagnostics that do
+// not depend on each are only reported for the first.
+func uniqueDiagnostics(diags hcl.Diagnostics, seen map[string]bool) hcl.Diagnostics {
+	var unique hcl.Diagnostics
+	for _, diag := range diags {
+		key := diag.Summary
+		if diag.Subject != nil {
+			key += "\x00" + diag.Subject.String()
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, diag)
+	}
+	return unique
+}
+
+// caseInstanceNames returns the names of the testcases expanded from the
+// testcase block name, in lexical order.
+func (ts *TestSuite) caseInstanceNames(name string) []string {
+	var names []string
+	for _, tc := range ts.TestCases {
+		if tc.baseName == name && tc.Name != name {
+			names = append(names, tc.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// splitCaseRef splits a reference to a step of another testcase, written as
+// <case>.<id>, at the dot after the testcase name. The name of an expanded
+// testcase may itself contain dots between its brackets.
+func splitCaseRef(ref string) (caseName, stepID string, ok bool) {
+	start := 0
+	if i := strings.Index(ref, "]."); i >= 0 {
+		start = i + 1
+	}
+	i := strings.Index(ref[start:], ".")
+	if i < 0 {
+		return "", "", false
+	}
+	return ref[:start+i], ref[start+i+1:], true
+}
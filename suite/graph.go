@@ -0,0 +1,638 @@
+package suite
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/simple"
+	"gonum.org/v1/gonum/graph/topo"
+	"gonum.org/v1/gonum/graph/traverse"
+)
+
+// DependencyKind describes why one step depends on another.
+type DependencyKind int
+
+const (
+	// DependencyExplicit is a dependency declared with before or after.
+	DependencyExplicit DependencyKind = iota
+
+	// DependencyImplicit is a dependency inferred from a reference to
+	// another step's results, such as step.s2.stdout.
+	DependencyImplicit
+)
+
+func (k DependencyKind) String() string {
+	switch k {
+	case DependencyExplicit:
+		return "explicit"
+	case DependencyImplicit:
+		return "implicit"
+	default:
+		return fmt.Sprintf("DependencyKind(%d)", int(k))
+	}
+}
+
+// Dependency is an edge in a testcase's step graph.
+type Dependency struct {
+	From *TestStep
+	To   *TestStep
+	Kind DependencyKind
+}
+
+type stepDepEdge struct {
+	from, to int64
+}
+
+// buildDepGraph registers the dependencies between the steps of the case,
+// attaches every step without a predecessor to the synthetic root node, and
+// computes the execution order. Dependencies on steps of other testcases are
+// registered with the suite as dependencies between the testcases.
+func (tc *TestCase) buildDepGraph(ts *TestSuite) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	// Register dependencies
+	for _, step := range tc.TestSteps {
+		for _, before := range step.runBefore {
+			s, d := tc.resolveStepRef(ts, step, "before", before)
+			diags = append(diags, step.annotateTemplate(d)...)
+			switch {
+			case s == nil:
+			case s == step:
+				diags = append(diags, step.annotateTemplate(selfDependency(step, "before", before))...)
+			case s.testCase != tc:
+				s.crossDeps = append(s.crossDeps, step)
+				ts.addCaseDependency(tc, s.testCase)
+			default:
+				tc.addDependency(step, s, DependencyExplicit)
+			}
+		}
+
+		for _, after := range step.runAfter {
+			s, d := tc.resolveStepRef(ts, step, "after", after)
+			diags = append(diags, step.annotateTemplate(d)...)
+			switch {
+			case s == nil:
+			case s == step:
+				diags = append(diags, step.annotateTemplate(selfDependency(step, "after", after))...)
+			case s.testCase != tc:
+				step.crossDeps = append(step.crossDeps, s)
+				ts.addCaseDependency(s.testCase, tc)
+			default:
+				tc.addDependency(s, step, DependencyExplicit)
+			}
+		}
+
+		for _, ref := range stepReferences(step.Config) {
+			// The steps of a module refer to each other by their ids
+			// within the module.
+			if step.module != nil {
+				ref.id = step.module.Name + "." + ref.id
+			}
+			s, d := tc.resolveStepRef(ts, step, "reference", ref)
+			diags = append(diags, step.annotateTemplate(d)...)
+			switch {
+			case s == nil:
+			case s == step:
+				diags = append(diags, step.annotateTemplate(selfDependency(step, "reference", ref))...)
+			default:
+				tc.addDependency(s, step, DependencyImplicit)
+			}
+		}
+
+		if step.module == nil {
+			deps, d := tc.moduleDependencies(step, step.Config)
+			diags = append(diags, step.annotateTemplate(d)...)
+			for _, dep := range deps {
+				tc.addDependency(dep, step, DependencyImplicit)
+			}
+		}
+	}
+
+	// Every step of a module depends on the steps its inputs refer to.
+	for _, m := range tc.Modules {
+		if len(m.Steps) == 0 {
+			continue
+		}
+		var deps []*TestStep
+		for _, ref := range stepReferences(m.body) {
+			s, d := tc.resolveStepRef(ts, m.Steps[0], "reference", ref)
+			diags = append(diags, d...)
+			if s != nil {
+				deps = append(deps, s)
+			}
+		}
+		moduleDeps, d := tc.moduleDependencies(m.Steps[0], m.body)
+		diags = append(diags, d...)
+		deps = append(deps, moduleDeps...)
+		for _, step := range m.Steps {
+			for _, dep := range deps {
+				tc.addDependency(dep, step, DependencyImplicit)
+			}
+		}
+	}
+
+	// Ensure every node is part of the graph, otherwise add it to the nop
+	// root node.
+	for _, step := range tc.TestSteps {
+		if len(tc.stepDepGraph.To(step.caseNode)) == 0 {
+			e := tc.stepDepGraph.NewEdge(tc.stepDepRoot, step.caseNode)
+			tc.stepDepGraph.SetEdge(e)
+		}
+	}
+
+	nodeCycles := topo.DirectedCyclesIn(tc.stepDepGraph)
+	if len(nodeCycles) > 0 {
+		for _, cycle := range nodeCycles {
+			ids := make([]string, 0, len(cycle))
+			for _, n := range cycle {
+				ids = append(ids, tc.stepDepGraphMap[n].id)
+			}
+			first := tc.stepDepGraphMap[cycle[0]]
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Dependency cycle between steps",
+				Detail:   fmt.Sprintf("The steps of testcase %q depend on each other in a cycle: %s.", tc.Name, strings.Join(ids, " -> ")),
+				Subject:  first.DeclRange.Ptr(),
+			})
+		}
+		return diags
+	}
+
+	orderedNodes, err := topo.SortStabilized(tc.stepDepGraph, nil)
+	if err != nil {
+		// Cycles are reported above, so this can only be a bug.
+		panic(fmt.Sprintf("bad: %v", err))
+	}
+
+	tc.orderedSteps = make([]*TestStep, 0, len(tc.TestSteps))
+	for _, n := range orderedNodes {
+		if s := tc.stepDepGraphMap[n]; s != nil {
+			tc.orderedSteps = append(tc.orderedSteps, s)
+		}
+	}
+
+	return diags
+}
+
+// addDependency records that the step to cannot start until from has
+// completed. A step cannot depend on itself, which selfDependency reports
+// where the dependency is declared.
+func (tc *TestCase) addDependency(from, to *TestStep, kind DependencyKind) {
+	if from == to {
+		return
+	}
+	edge := stepDepEdge{from.caseNode.ID(), to.caseNode.ID()}
+	if existing, exists := tc.stepDepKinds[edge]; exists && existing == DependencyExplicit {
+		return
+	}
+
+	tc.stepDepGraph.SetEdge(tc.stepDepGraph.NewEdge(from.caseNode, to.caseNode))
+	tc.stepDepKinds[edge] = kind
+}
+
+// selfDependency reports that step names itself in a dependency of the given
+// kind.
+func selfDependency(step *TestStep, kind string, ref stepRef) hcl.Diagnostics {
+	detail := fmt.Sprintf("step.id=%q lists itself as its own %s dependency.", step.id, kind)
+	if kind == "reference" {
+		detail = fmt.Sprintf("step.id=%q refers to its own results, which do not exist until it has run. Its assert and snapshot blocks can refer to them as self.", step.id)
+	}
+	return hcl.Diagnostics{
+		{
+			Severity: hcl.DiagError,
+			Summary:  "Step depends on itself",
+			Detail:   detail,
+			Subject:  ref.rng.Ptr(),
+		},
+	}
+}
+
+// resolveStepRef finds the step named by ref. Before and after references may
+// also name a step of another testcase as <case>.<id>.
+func (tc *TestCase) resolveStepRef(ts *TestSuite, step *TestStep, kind string, ref stepRef) (*TestStep, hcl.Diagnostics) {
+	if s, found := tc.StepMap[ref.id]; found {
+		return s, nil
+	}
+
+	// Ordering constraints on a filtered step no longer apply, but a step
+	// that uses another step's results cannot run without it.
+	if tc.filteredSteps[ref.id] {
+		if kind != "reference" {
+			return nil, nil
+		}
+		return nil, hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  "Step dependency filtered out",
+				Detail:   fmt.Sprintf("step.id=%q refers to the results of step %q in testcase %q, which is excluded by the -run or tag filters.", step.id, ref.id, tc.Name),
+				Subject:  ref.rng.Ptr(),
+			},
+		}
+	}
+
+	if caseName, stepID, ok := splitCaseRef(ref.id); ok && kind != "reference" {
+		if other := ts.Case(caseName); other != nil {
+			if s, found := other.StepMap[stepID]; found {
+				return s, nil
+			}
+			if other.filteredSteps[stepID] {
+				return nil, nil
+			}
+			return nil, hcl.Diagnostics{
+				{
+					Severity: hcl.DiagError,
+					Summary:  "Step dependency not found",
+					Detail:   fmt.Sprintf("step.id=%q's %s dependency %q not found in testcase %q.", step.id, kind, stepID, other.Name),
+					Subject:  ref.rng.Ptr(),
+				},
+			}
+		}
+		if ts.filteredCases[caseName] {
+			return nil, nil
+		}
+	}
+
+	detail := fmt.Sprintf("step.id=%q's %s dependency %q not found in testcase %q.", step.id, kind, ref.id, tc.Name)
+	if kind == "reference" && (tc.Module(ref.id) != nil || tc.brokenModules[ref.id]) {
+		detail += fmt.Sprintf(" The results of the steps of module %q are available through its outputs, as module.%s.<output>.", ref.id, ref.id)
+	}
+	return nil, hcl.Diagnostics{
+		{
+			Severity: hcl.DiagError,
+			Summary:  "Step dependency not found",
+			Detail:   detail,
+			Subject:  ref.rng.Ptr(),
+		},
+	}
+}
+
+// buildCaseGraph registers the depends_on dependencies between testcases,
+// checks the suite's testcase graph for cycles and computes the order in
+// which the testcases run.
+func (ts *TestSuite) buildCaseGraph() hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	names := make([]string, 0, len(ts.TestCases))
+	for _, tc := range ts.TestCases {
+		names = append(names, tc.Name)
+	}
+
+	for _, tc := range ts.TestCases {
+		for _, ref := range tc.dependsOn {
+			// Depending on a testcase block that was expanded by
+			// for_each or a matrix means depending on every instance.
+			if instances := ts.caseInstanceNames(ref.id); len(instances) > 0 {
+				for _, name := range instances {
+					if dep := ts.Case(name); dep != tc {
+						ts.addCaseDependency(dep, tc)
+					}
+				}
+				continue
+			}
+
+			dep := ts.Case(ref.id)
+			switch {
+			case dep == tc:
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Testcase depends on itself",
+					Detail:   fmt.Sprintf("Testcase %q lists itself in depends_on.", tc.Name),
+					Subject:  ref.rng.Ptr(),
+				})
+			case dep != nil:
+				ts.addCaseDependency(dep, tc)
+			case ts.filteredCases[ref.id]:
+				// Ordering against a filtered testcase no longer applies.
+			default:
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Testcase dependency not found",
+					Detail:   fmt.Sprintf("Testcase %q depends on %q, but there is no testcase of that name.%s", tc.Name, ref.id, didYouMean(ref.id, names)),
+					Subject:  ref.rng.Ptr(),
+				})
+			}
+		}
+	}
+
+	nodeCycles := topo.DirectedCyclesIn(ts.caseDepGraph)
+	if len(nodeCycles) > 0 {
+		for _, cycle := range nodeCycles {
+			names := make([]string, 0, len(cycle))
+			for _, n := range cycle {
+				names = append(names, ts.caseDepGraphMap[n].Name)
+			}
+			first := ts.caseDepGraphMap[cycle[0]]
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Dependency cycle between testcases",
+				Detail:   fmt.Sprintf("The testcases of suite %q depend on each other in a cycle: %s.", ts.Name, strings.Join(names, " -> ")),
+				Subject:  first.DeclRange.Ptr(),
+			})
+		}
+		return diags
+	}
+
+	orderedNodes, err := topo.SortStabilized(ts.caseDepGraph, nil)
+	if err != nil {
+		// Cycles are reported above, so this can only be a bug.
+		panic(fmt.Sprintf("bad: %v", err))
+	}
+
+	ts.orderedCases = make([]*TestCase, 0, len(ts.TestCases))
+	for _, n := range orderedNodes {
+		ts.orderedCases = append(ts.orderedCases, ts.caseDepGraphMap[n])
+	}
+
+	return diags
+}
+
+// addCaseDependency records that the testcase to cannot start until from
+// has completed.
+func (ts *TestSuite) addCaseDependency(from, to *TestCase) {
+	if from == to {
+		return
+	}
+	ts.caseDepGraph.SetEdge(ts.caseDepGraph.NewEdge(from.suiteNode, to.suiteNode))
+}
+
+// OrderedCases returns the testcases of the suite in execution order. The
+// result is nil if the testcase graph contains a cycle.
+func (ts *TestSuite) OrderedCases() []*TestCase {
+	return ts.orderedCases
+}
+
+// CaseDependencies returns the testcases that must complete before tc can
+// start, whether listed in depends_on or implied by step dependencies, in
+// execution order.
+func (ts *TestSuite) CaseDependencies(tc *TestCase) []*TestCase {
+	deps := make(map[*TestCase]bool)
+	for _, n := range ts.caseDepGraph.To(tc.suiteNode) {
+		deps[ts.caseDepGraphMap[n]] = true
+	}
+	return ts.orderCases(deps)
+}
+
+// caseAncestors returns the testcases that must complete before tc can
+// start, directly or transitively, in execution order.
+func (ts *TestSuite) caseAncestors(tc *TestCase) []*TestCase {
+	found := make(map[*TestCase]bool)
+	var bf traverse.BreadthFirst
+	bf.Walk(reversedGraph{ts.caseDepGraph}, tc.suiteNode, func(n graph.Node, _ int) bool {
+		if c := ts.caseDepGraphMap[n]; c != tc {
+			found[c] = true
+		}
+		return false
+	})
+	return ts.orderCases(found)
+}
+
+func (ts *TestSuite) orderCases(set map[*TestCase]bool) []*TestCase {
+	cases := make([]*TestCase, 0, len(set))
+	for _, tc := range ts.orderedCases {
+		if set[tc] {
+			cases = append(cases, tc)
+		}
+	}
+	return cases
+}
+
+// OrderedSteps returns the steps of the case in execution order. The result
+// is nil if the step graph contains a cycle.
+func (tc *TestCase) OrderedSteps() []*TestStep {
+	return tc.orderedSteps
+}
+
+// Dependencies returns the steps that must complete before the given step
+// can run, in execution order.
+func (tc *TestCase) Dependencies(step *TestStep) []Dependency {
+	var deps []Dependency
+	for _, n := range tc.stepDepGraph.To(step.caseNode) {
+		from := tc.stepDepGraphMap[n]
+		if from == nil {
+			continue
+		}
+		deps = append(deps, Dependency{
+			From: from,
+			To:   step,
+			Kind: tc.stepDepKinds[stepDepEdge{n.ID(), step.caseNode.ID()}],
+		})
+	}
+	sortDependencies(deps, func(d Dependency) *TestStep { return d.From })
+	return deps
+}
+
+// Dependents returns the steps that wait for the given step to complete, in
+// execution order.
+func (tc *TestCase) Dependents(step *TestStep) []Dependency {
+	var deps []Dependency
+	for _, n := range tc.stepDepGraph.From(step.caseNode) {
+		deps = append(deps, Dependency{
+			From: step,
+			To:   tc.stepDepGraphMap[n],
+			Kind: tc.stepDepKinds[stepDepEdge{step.caseNode.ID(), n.ID()}],
+		})
+	}
+	sortDependencies(deps, func(d Dependency) *TestStep { return d.To })
+	return deps
+}
+
+// Ancestors returns the steps that must complete before the given step can
+// run, directly or transitively, in execution order.
+func (tc *TestCase) Ancestors(step *TestStep) []*TestStep {
+	found := make(map[*TestStep]bool)
+	var bf traverse.BreadthFirst
+	bf.Walk(reversedGraph{tc.stepDepGraph}, step.caseNode, func(n graph.Node, _ int) bool {
+		if s := tc.stepDepGraphMap[n]; s != nil && s != step {
+			found[s] = true
+		}
+		return false
+	})
+
+	ancestors := make([]*TestStep, 0, len(found))
+	for _, s := range tc.orderedSteps {
+		if found[s] {
+			ancestors = append(ancestors, s)
+		}
+	}
+	return ancestors
+}
+
+// reversedGraph is a view of a directed graph with every edge reversed, so
+// that traversals from a node visit its ancestors.
+type reversedGraph struct {
+	graph.Directed
+}
+
+func (g reversedGraph) From(n graph.Node) []graph.Node {
+	return g.Directed.To(n)
+}
+
+func (g reversedGraph) To(n graph.Node) []graph.Node {
+	return g.Directed.From(n)
+}
+
+func (g reversedGraph) HasEdgeFromTo(u, v graph.Node) bool {
+	return g.Directed.HasEdgeFromTo(v, u)
+}
+
+func (g reversedGraph) Edge(u, v graph.Node) graph.Edge {
+	if !g.Directed.HasEdgeFromTo(v, u) {
+		return nil
+	}
+	return simple.Edge{F: u, T: v}
+}
+
+// Edges returns every dependency in the case, ordered by the execution order
+// of the dependent step.
+func (tc *TestCase) Edges() []Dependency {
+	var edges []Dependency
+	for _, step := range tc.orderedSteps {
+		edges = append(edges, tc.Dependencies(step)...)
+	}
+	return edges
+}
+
+func sortDependencies(deps []Dependency, key func(Dependency) *TestStep) {
+	// Insertion sort by step number; dependency lists are short.
+	for i := 1; i < len(deps); i++ {
+		for j := i; j > 0 && key(deps[j]).StepNum < key(deps[j-1]).StepNum; j-- {
+			deps[j], deps[j-1] = deps[j-1], deps[j]
+		}
+	}
+}
+
+// stepReferences returns a reference for every traversal of the step
+// variable within the given body, such as step.s2.stdout or step["1"].
+func stepReferences(body hcl.Body) []stepRef {
+	var refs []stepRef
+	for _, traversal := range bodyTraversals(body) {
+		if traversal.RootName() != "step" || len(traversal) < 2 {
+			continue
+		}
+
+		var id string
+		switch tt := traversal[1].(type) {
+		case hcl.TraverseAttr:
+			id = tt.Name
+		case hcl.TraverseIndex:
+			if !tt.Key.Type().Equals(cty.String) || !tt.Key.IsKnown() || tt.Key.IsNull() {
+				continue
+			}
+			id = tt.Key.AsString()
+		default:
+			continue
+		}
+
+		refs = append(refs, stepRef{
+			id:  id,
+			rng: hcl.RangeBetween(traversal[0].SourceRange(), traversal[1].SourceRange()),
+		})
+	}
+	return refs
+}
+
+// moduleDependencies returns the steps of the modules whose outputs the
+// expressions of body refer to, which are every step of each module.
+func (tc *TestCase) moduleDependencies(step *TestStep, body hcl.Body) ([]*TestStep, hcl.Diagnostics) {
+	var deps []*TestStep
+	var diags hcl.Diagnostics
+	for _, ref := range moduleReferences(body) {
+		m := tc.Module(ref.id)
+		if m == nil && tc.brokenModules[ref.id] {
+			continue
+		}
+		if m == nil {
+			names := make([]string, 0, len(tc.Modules))
+			for _, m := range tc.Modules {
+				names = append(names, m.Name)
+			}
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Module not found",
+				Detail:   fmt.Sprintf("step.id=%q refers to module %q, but testcase %q has no module of that name.%s", step.id, ref.id, tc.Name, didYouMean(ref.id, names)),
+				Subject:  ref.rng.Ptr(),
+			})
+			continue
+		}
+		deps = append(deps, m.Steps...)
+	}
+	return deps, diags
+}
+
+// moduleReferences returns a reference for every traversal of the module
+// variable within the given body, such as module.login_flow.token, naming
+// the module.
+func moduleReferences(body hcl.Body) []stepRef {
+	var refs []stepRef
+	for _, traversal := range bodyTraversals(body) {
+		if traversal.RootName() != "module" || len(traversal) < 2 {
+			continue
+		}
+		nameStep, ok := traversal[1].(hcl.TraverseAttr)
+		if !ok {
+			continue
+		}
+		refs = append(refs, stepRef{
+			id:  nameStep.Name,
+			rng: hcl.RangeBetween(traversal[0].SourceRange(), nameStep.SrcRange),
+		})
+	}
+	return refs
+}
+
+// bodyTraversals returns every variable traversal made by the expressions
+// within body, including those in nested blocks.
+func bodyTraversals(body hcl.Body) []hcl.Traversal {
+	if body == nil {
+		return nil
+	}
+	if tb, ok := body.(*templateBody); ok {
+		var traversals []hcl.Traversal
+		for _, traversal := range bodyTraversals(tb.template) {
+			if !tb.overrides(traversal.SourceRange()) {
+				traversals = append(traversals, traversal)
+			}
+		}
+		return append(traversals, bodyTraversals(tb.step)...)
+	}
+
+	var traversals []hcl.Traversal
+	if sb, ok := body.(*hclsyntax.Body); ok {
+		hclsyntax.VisitAll(sb, func(n hclsyntax.Node) hcl.Diagnostics {
+			if attr, ok := n.(*hclsyntax.Attribute); ok {
+				traversals = append(traversals, hclsyntax.Variables(attr.Expr)...)
+			}
+			return nil
+		})
+	} else {
+		attrs, _ := body.JustAttributes()
+		for _, attr := range attrs {
+			for _, traversal := range attr.Expr.Variables() {
+				traversals = append(traversals, relocateJSONTraversal(traversal, attr.Expr.Range()))
+			}
+		}
+	}
+
+	// The iterators of dynamic blocks are not variables.
+	if iterators := dynamicIterators(body, nil); len(iterators) > 0 {
+		filtered := traversals[:0]
+		for _, traversal := range traversals {
+			if !iterators[traversal.RootName()] {
+				filtered = append(filtered, traversal)
+			}
+		}
+		traversals = filtered
+	}
+
+	// Attributes are held in maps, so sort by position to keep diagnostics
+	// in a stable order.
+	sort.SliceStable(traversals, func(i, j int) bool {
+		return traversals[i].SourceRange().Start.Byte < traversals[j].SourceRange().Start.Byte
+	})
+	return traversals
+}
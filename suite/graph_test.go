@@ -0,0 +1,42 @@
+package suite
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEdges(t *testing.T) {
+	ts := loadSuite(t, NewLoader(), `
+suitename = "s"
+
+testcase "c" {
+  step "a" {}
+
+  step "b" {
+    after = ["a"]
+    value = step.a
+  }
+
+  step "c" {
+    value = step.a
+  }
+
+  step "d" {
+    before = ["c"]
+  }
+}
+`)
+
+	var got []string
+	for _, dep := range ts.Case("c").Edges() {
+		got = append(got, dep.From.ID()+" -> "+dep.To.ID()+" ("+dep.Kind.String()+")")
+	}
+	want := []string{
+		"a -> b (explicit)",
+		"a -> c (implicit)",
+		"d -> c (explicit)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got edges %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,150 @@
+package suite
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl2/hcl"
+)
+
+var includeSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "include", LabelNames: []string{"path"}},
+	},
+}
+
+// includes is the result of resolving the include blocks of a suite.
+type includes struct {
+	// files holds every file of the suite: each file named when loading,
+	// followed by the files it includes that are not already loaded.
+	files []*hcl.File
+
+	// filenames holds the names of files, in the same order.
+	filenames []string
+
+	// includedFrom maps the name of each included file to the include
+	// block that first included it. Files named when loading are absent.
+	includedFrom map[string]hcl.Range
+}
+
+// resolveIncludes loads the files included by the given files, and the files
+// they include in turn, with each path relative to the directory of the file
+// including it. A file is only loaded once however many times it is
+// included, and a file that includes itself, directly or not, is an error.
+func (l *Loader) resolveIncludes(filenames []string, files []*hcl.File) (*includes, hcl.Diagnostics) {
+	inc := &includes{includedFrom: make(map[string]hcl.Range)}
+	var diags hcl.Diagnostics
+
+	// The state of a file is absent until it is visited, false while its
+	// includes are being resolved and true once they have been.
+	state := make(map[string]bool)
+	topLevel := make(map[string]int, len(files))
+	for i, filename := range filenames {
+		topLevel[filepath.Clean(filename)] = i
+	}
+
+	var chain []string
+	var visit func(filename string, f *hcl.File)
+	visit = func(filename string, f *hcl.File) {
+		key := filepath.Clean(filename)
+		state[key] = false
+		chain = append(chain, filename)
+		inc.files = append(inc.files, f)
+		inc.filenames = append(inc.filenames, filename)
+
+		content, _, _ := f.Body.PartialContent(includeSchema)
+		for _, block := range content.Blocks {
+			path := block.Labels[0]
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(filepath.Dir(filename), path)
+			}
+			target := filepath.Clean(path)
+
+			done, visited := state[target]
+			switch {
+			case visited && !done:
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Include cycle",
+					Detail:   fmt.Sprintf("The file %q includes itself through %s.", path, strings.Join(append(chainFrom(chain, target), path), " -> ")),
+					Subject:  block.DefRange.Ptr(),
+				})
+				continue
+			case visited:
+				continue
+			}
+
+			if i, ok := topLevel[target]; ok {
+				visit(filenames[i], files[i])
+				continue
+			}
+
+			if _, err := os.Stat(path); err != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Failed to read included file",
+					Detail:   fmt.Sprintf("The included file %q could not be read: %v.", path, err),
+					Subject:  block.LabelRanges[0].Ptr(),
+				})
+				continue
+			}
+			inc.includedFrom[path] = block.DefRange
+
+			included, d := l.ParseFile(path)
+			diags = append(diags, d...)
+			if d.HasErrors() {
+				state[target] = true
+				continue
+			}
+			visit(path, included)
+		}
+
+		chain = chain[:len(chain)-1]
+		state[key] = true
+	}
+
+	for i, filename := range filenames {
+		if _, visited := state[filepath.Clean(filename)]; !visited {
+			visit(filename, files[i])
+		}
+	}
+
+	return inc, annotateIncludes(inc.includedFrom, diags)
+}
+
+// chainFrom returns the part of chain starting with the file target.
+func chainFrom(chain []string, target string) []string {
+	for i, filename := range chain {
+		if filepath.Clean(filename) == target {
+			return chain[i:]
+		}
+	}
+	return chain
+}
+
+// annotateIncludes adds the include chain of the file of each diagnostic to
+// its detail, for the diagnostics within included files.
+func annotateIncludes(includedFrom map[string]hcl.Range, diags hcl.Diagnostics) hcl.Diagnostics {
+	if len(includedFrom) == 0 {
+		return diags
+	}
+	for _, diag := range diags {
+		if diag.Subject == nil {
+			continue
+		}
+		rng, included := includedFrom[diag.Subject.Filename]
+		if !included {
+			continue
+		}
+
+		var via []string
+		for included {
+			via = append(via, rng.String())
+			rng, included = includedFrom[rng.Filename]
+		}
+		diag.Detail += fmt.Sprintf("\n\nThe file %s is included from %s.", diag.Subject.Filename, strings.Join(via, ", which is included from "))
+	}
+	return diags
+}
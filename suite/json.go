@@ -0,0 +1,131 @@
+package suite
+
+import (
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// The vendored JSON parser evaluates strings as templates, but positions the
+// template's tokens relative to the start of the string instead of the file.
+// The ranges of diagnostics and traversals within such templates keep the
+// right line but are otherwise wrong, so they are moved to the range of the
+// whole JSON string, which is correct.
+
+// relocateJSONDiagnostics moves the diagnostics raised within the JSON
+// strings of body onto the strings themselves. Diagnostics for native syntax
+// bodies are returned unchanged.
+func relocateJSONDiagnostics(body hcl.Body, diags hcl.Diagnostics) hcl.Diagnostics {
+	switch body := body.(type) {
+	case *templateBody:
+		return relocateJSONDiagnostics(body.step, relocateJSONDiagnostics(body.template, diags))
+	case *dynamicBody:
+		return relocateJSONDiagnostics(body.body, diags)
+	}
+	if _, native := body.(*hclsyntax.Body); native || body == nil || len(diags) == 0 {
+		return diags
+	}
+
+	attrs, _ := body.JustAttributes()
+	exprs := make([]*hcl.Attribute, 0, len(attrs))
+	for _, attr := range attrs {
+		exprs = append(exprs, attr)
+	}
+	exprs = sortedAttributes(exprs)
+
+	for _, diag := range diags {
+		if diag.Subject == nil {
+			continue
+		}
+		for _, attr := range exprs {
+			rng := attr.Expr.Range()
+			if !misplacedIn(*diag.Subject, rng) {
+				continue
+			}
+			diag.Subject = rng.Ptr()
+			diag.Context = nil
+			break
+		}
+	}
+
+	return diags
+}
+
+// relocateJSONTraversal returns traversal with every step positioned at rng,
+// the range of the JSON string holding it.
+func relocateJSONTraversal(traversal hcl.Traversal, rng hcl.Range) hcl.Traversal {
+	relocated := make(hcl.Traversal, len(traversal))
+	for i, step := range traversal {
+		switch step := step.(type) {
+		case hcl.TraverseRoot:
+			step.SrcRange = rng
+			relocated[i] = step
+		case hcl.TraverseAttr:
+			step.SrcRange = rng
+			relocated[i] = step
+		case hcl.TraverseIndex:
+			step.SrcRange = rng
+			relocated[i] = step
+		case hcl.TraverseSplat:
+			step.SrcRange = rng
+			relocated[i] = step
+		default:
+			relocated[i] = step
+		}
+	}
+	return relocated
+}
+
+// jsonFunctionCalls returns every function call made by the string templates
+// within the JSON expression expr, each positioned at expr.
+func jsonFunctionCalls(expr hcl.Expression) []*hclsyntax.FunctionCallExpr {
+	// Without an evaluation context, JSON strings evaluate to their
+	// verbatim source, templates included.
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return nil
+	}
+
+	rng := expr.Range()
+	var calls []*hclsyntax.FunctionCallExpr
+	var walk func(v cty.Value)
+	walk = func(v cty.Value) {
+		switch {
+		case v.IsNull() || !v.IsKnown():
+		case v.CanIterateElements():
+			for it := v.ElementIterator(); it.Next(); {
+				_, elem := it.Element()
+				walk(elem)
+			}
+		case v.Type() == cty.String:
+			tmpl, diags := hclsyntax.ParseTemplate([]byte(v.AsString()), rng.Filename, rng.Start)
+			if diags.HasErrors() {
+				return
+			}
+			hclsyntax.VisitAll(tmpl, func(n hclsyntax.Node) hcl.Diagnostics {
+				if call, ok := n.(*hclsyntax.FunctionCallExpr); ok {
+					call.NameRange = rng
+					call.OpenParenRange = rng
+					call.CloseParenRange = rng
+					calls = append(calls, call)
+				}
+				return nil
+			})
+		}
+	}
+	walk(val)
+	return calls
+}
+
+// misplacedIn reports whether subject looks like a range within a template
+// in the JSON string at rng: it is on one of the string's lines but does not
+// lie within the string's bytes.
+func misplacedIn(subject, rng hcl.Range) bool {
+	if subject.Filename != rng.Filename {
+		return false
+	}
+	if subject.Start.Line < rng.Start.Line || subject.Start.Line > rng.End.Line {
+		return false
+	}
+	return subject.Start.Byte < rng.Start.Byte || subject.End.Byte > rng.End.Byte
+}
@@ -0,0 +1,983 @@
+package suite
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl2/gohcl"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/hashicorp/hcl2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+// DefaultStepType is the step type used when a step has no type attribute.
+const DefaultStepType = "noop"
+
+type rawVariable struct {
+	Name    string         `hcl:"name,label"`
+	Default hcl.Expression `hcl:"default,attr"`
+}
+
+type rawTestStep struct {
+	Name      *string        `hcl:"stepname,attr"`
+	ID        *hcl.Attribute `hcl:"id,attr"`
+	Type      *hcl.Attribute `hcl:"type,attr"`
+	Tags      *[]string      `hcl:"tags,attr"`
+	RunBefore *hcl.Attribute `hcl:"before,attr"`
+	RunAfter  *hcl.Attribute `hcl:"after,attr"`
+	Snapshots []*rawSnapshot `hcl:"snapshot,block"`
+	Config    hcl.Body       `hcl:",remain"`
+}
+
+type rawTestCaseFixture struct {
+	Name   *string  `hcl:"fixturename,attr"`
+	Config hcl.Body `hcl:",remain"`
+}
+
+type rawMatrix struct {
+	Config hcl.Body `hcl:",remain"`
+}
+
+type rawTestCase struct {
+	Name      *string        `hcl:"casename,attr"`
+	Enabled   *bool          `hcl:"enabled,attr"`
+	Tags      *[]string      `hcl:"tags,attr"`
+	DependsOn *hcl.Attribute `hcl:"depends_on,attr"`
+
+	// ForEach and Matrix are decoded by expandTestCase.
+	ForEach *hcl.Attribute `hcl:"for_each,attr"`
+	Matrix  *rawMatrix     `hcl:"matrix,block"`
+}
+
+type rawInclude struct {
+	Path string `hcl:"path,label"`
+}
+
+type rawLocals struct {
+	Config hcl.Body `hcl:",remain"`
+}
+
+type rawTestSuite struct {
+	Name      *string        `hcl:"suitename,attr"`
+	Variables []*rawVariable `hcl:"variable,block"`
+	Locals    []*rawLocals   `hcl:"locals,block"`
+
+	// Includes are resolved before the suite is decoded.
+	Includes []*rawInclude `hcl:"include,block"`
+}
+
+// The testcase, step and fixture blocks are extracted with explicit schemas
+// rather than through gohcl so that their declaration ranges are kept for
+// diagnostics. Each is named by its label, or in the older style by an
+// attribute of an unlabelled block; see optionalLabelContent.
+var suiteBlockSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "testcase", LabelNames: []string{"name"}},
+		{Type: "fixture", LabelNames: []string{"name"}},
+		{Type: "step_template", LabelNames: []string{"name"}},
+	},
+}
+
+var testCaseBlockSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "step", LabelNames: []string{"id"}},
+		{Type: "fixture", LabelNames: []string{"name"}},
+		{Type: "module", LabelNames: []string{"name"}},
+	},
+}
+
+// Loader reads suite files from disk and decodes them into a TestSuite. A
+// Loader keeps every file it has parsed so that diagnostics can be rendered
+// with source context after loading.
+type Loader struct {
+	// Strict rejects step and fixture content that the step type does not
+	// declare, instead of passing it through in Config.
+	Strict bool
+
+	// Filter, if set, selects the testcases and steps to load.
+	Filter *Filter
+
+	parser    *hclparse.Parser
+	variables map[string]cty.Value
+}
+
+// NewLoader returns a Loader with no variable overrides.
+func NewLoader() *Loader {
+	return &Loader{
+		parser:    hclparse.NewParser(),
+		variables: map[string]cty.Value{},
+	}
+}
+
+// SetVariable overrides the value of the named suite variable.
+func (l *Loader) SetVariable(name string, val cty.Value) {
+	l.variables[name] = val
+}
+
+// Files returns the parsed files, keyed by filename, for use with
+// hcl.NewDiagnosticTextWriter.
+func (l *Loader) Files() map[string]*hcl.File {
+	return l.parser.Files()
+}
+
+// ParseFile parses a single suite file without decoding it, using the JSON
+// syntax for files ending in .json and the native syntax otherwise. The file
+// is remembered for diagnostics like those from Load.
+func (l *Loader) ParseFile(filename string) (*hcl.File, hcl.Diagnostics) {
+	if IsJSONFile(filename) {
+		return l.parser.ParseJSONFile(filename)
+	}
+	return l.parser.ParseHCLFile(filename)
+}
+
+// FindFiles expands the given paths into the list of suite files they name.
+// Directories are expanded to the suite files they directly contain, in
+// lexical order. If no paths are given the current directory is used.
+func FindFiles(paths []string) ([]string, hcl.Diagnostics) {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	var files []string
+	var diags hcl.Diagnostics
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to read suite path",
+				Detail:   fmt.Sprintf("The path %q could not be read: %v.", path, err),
+			})
+			continue
+		}
+
+		if !fi.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		infos, err := ioutil.ReadDir(path)
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to read suite directory",
+				Detail:   fmt.Sprintf("The directory %q could not be read: %v.", path, err),
+			})
+			continue
+		}
+
+		var dirFiles []string
+		for _, info := range infos {
+			if info.IsDir() || !isSuiteFile(info.Name()) {
+				continue
+			}
+			dirFiles = append(dirFiles, filepath.Join(path, info.Name()))
+		}
+		sort.Strings(dirFiles)
+		files = append(files, dirFiles...)
+	}
+
+	return files, diags
+}
+
+func isSuiteFile(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	return filepath.Ext(name) == ".hcl" || IsJSONFile(name)
+}
+
+// IsJSONFile reports whether the suite file filename uses the JSON syntax,
+// such as suite.hcl.json or suite.json.
+func IsJSONFile(filename string) bool {
+	return filepath.Ext(filename) == ".json"
+}
+
+// Load parses the suite files named by paths, as expanded by FindFiles, and
+// decodes them into a single TestSuite. The returned suite is non-nil
+// whenever the files could be parsed, even if there are error diagnostics, so
+// that callers can inspect as much of it as possible.
+func (l *Loader) Load(paths ...string) (*TestSuite, hcl.Diagnostics) {
+	filenames, diags := FindFiles(paths)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if len(filenames) == 0 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "No suite files",
+			Detail:   fmt.Sprintf("No .hcl or .json files were found in %s.", strings.Join(paths, ", ")),
+		})
+		return nil, diags
+	}
+
+	files := make([]*hcl.File, 0, len(filenames))
+	for _, filename := range filenames {
+		f, d := l.ParseFile(filename)
+		diags = append(diags, d...)
+		if f != nil {
+			files = append(files, f)
+		}
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	inc, d := l.resolveIncludes(filenames, files)
+	diags = append(diags, d...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	ts, d := l.decodeSuite(inc)
+	ts.Files = inc.filenames
+	diags = append(diags, d...)
+
+	return ts, diags
+}
+
+func (l *Loader) decodeSuite(inc *includes) (*TestSuite, hcl.Diagnostics) {
+	ts := &TestSuite{
+		Variables:       map[string]*Variable{},
+		Locals:          map[string]*Local{},
+		StepTemplates:   map[string]*StepTemplate{},
+		caseDepGraph:    simple.NewDirectedGraph(),
+		caseDepGraphMap: make(map[graph.Node]*TestCase),
+		filteredCases:   make(map[string]bool),
+		includedFrom:    inc.includedFrom,
+	}
+
+	var diags hcl.Diagnostics
+	var caseBlocks, fixtureBlocks, templateBlocks hcl.Blocks
+	files := inc.files
+	remains := make([]hcl.Body, 0, len(files))
+	for i, f := range files {
+		content, remain, d := optionalLabelContent(f.Body, suiteBlockSchema)
+		diags = append(diags, d...)
+		caseBlocks = append(caseBlocks, content.Blocks.OfType("testcase")...)
+		fixtureBlocks = append(fixtureBlocks, content.Blocks.OfType("fixture")...)
+		templateBlocks = append(templateBlocks, content.Blocks.OfType("step_template")...)
+		remains = append(remains, remain)
+
+		if _, included := inc.includedFrom[inc.filenames[i]]; included {
+			diags = append(diags, checkIncludedContent(f.Body, content)...)
+		}
+	}
+
+	rts := rawTestSuite{}
+	diags = append(diags, gohcl.DecodeBody(hcl.MergeBodies(remains), nil, &rts)...)
+
+	if rts.Name == nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Missing suitename",
+			Detail:   "Exactly one suite file must set the suitename attribute.",
+			Subject:  files[0].Body.MissingItemRange().Ptr(),
+		})
+	} else {
+		ts.Name = *rts.Name
+	}
+
+	diags = append(diags, l.decodeVariables(ts, rts.Variables)...)
+	diags = append(diags, l.decodeLocals(ts, rts.Locals)...)
+
+	ctx := ts.EvalContext()
+	var d hcl.Diagnostics
+	ts.Fixtures, d = l.decodeFixtures(fixtureBlocks, ctx, nil, "the suite")
+	diags = append(diags, d...)
+	diags = append(diags, ts.decodeStepTemplates(templateBlocks)...)
+
+	ts.TestCases = make([]*TestCase, 0, len(caseBlocks))
+	caseRanges := make(map[string]hcl.Range, len(caseBlocks))
+	var cases []*TestCase
+	for _, block := range caseBlocks {
+		instances, d := expandTestCase(block, ctx)
+		diags = append(diags, d...)
+
+		seen := make(map[string]bool)
+		for _, inst := range instances {
+			tc, d := l.decodeTestCase(ts, block, inst)
+			diags = append(diags, uniqueDiagnostics(d, seen)...)
+			if tc != nil {
+				cases = append(cases, tc)
+			}
+		}
+	}
+
+	for _, tc := range cases {
+		if prev, exists := caseRanges[tc.Name]; exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate testcase",
+				Detail:   fmt.Sprintf("A testcase named %q was already declared at %s.", tc.Name, prev),
+				Subject:  tc.DeclRange.Ptr(),
+			})
+			continue
+		}
+		caseRanges[tc.Name] = tc.DeclRange
+
+		tc.suiteNode = ts.caseDepGraph.NewNode()
+		ts.caseDepGraph.AddNode(tc.suiteNode)
+		ts.caseDepGraphMap[tc.suiteNode] = tc
+		ts.TestCases = append(ts.TestCases, tc)
+	}
+
+	// Step references may name steps in other testcases, so the graphs are
+	// only built once every testcase is known.
+	for _, tc := range ts.TestCases {
+		diags = append(diags, tc.buildDepGraph(ts)...)
+	}
+	diags = append(diags, ts.buildCaseGraph()...)
+
+	return ts, annotateIncludes(ts.includedFrom, diags)
+}
+
+func (l *Loader) decodeVariables(ts *TestSuite, rawVars []*rawVariable) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	declared := make([]*Variable, 0, len(rawVars))
+	for _, rv := range rawVars {
+		rng := rv.Default.Range()
+		if prev, exists := ts.Variables[rv.Name]; exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate variable",
+				Detail:   fmt.Sprintf("A variable named %q was already declared at %s.", rv.Name, prev.DeclRange),
+				Subject:  rng.Ptr(),
+			})
+			continue
+		}
+
+		val, d := rv.Default.Value(nil)
+		diags = append(diags, d...)
+
+		v := &Variable{
+			Name:      rv.Name,
+			Value:     val,
+			DeclRange: rng,
+		}
+		ts.Variables[rv.Name] = v
+		declared = append(declared, v)
+	}
+
+	names := make([]string, 0, len(l.variables))
+	for name := range l.variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		v, declared := ts.Variables[name]
+		if !declared {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagWarning,
+				Summary:  "Value for undeclared variable",
+				Detail:   fmt.Sprintf("A value was given for %q, but the suite does not declare a variable of that name.", name),
+			})
+			v = &Variable{Name: name}
+			ts.Variables[name] = v
+			v.Value = l.variables[name]
+			continue
+		}
+		val, d := overrideValue(v, l.variables[name])
+		diags = append(diags, d...)
+		v.Value = val
+	}
+
+	for _, v := range declared {
+		if v.Value.IsNull() {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "No value for required variable",
+				Detail:   fmt.Sprintf("The variable %q has no default, so a value must be given with -var.", v.Name),
+				Subject:  v.DeclRange.Ptr(),
+			})
+		}
+	}
+
+	return diags
+}
+
+// overrideValue returns val as a value for the declared variable v. Values
+// are given as strings, so they are converted to the type of the variable's
+// default: a number or bool is parsed from the string, and anything else is
+// parsed as an HCL expression such as ["a", "b"].
+func overrideValue(v *Variable, val cty.Value) (cty.Value, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	if v.Value.IsNull() || val.IsNull() || !val.IsKnown() || val.Type() != cty.String {
+		return val, diags
+	}
+
+	ty := v.Value.Type()
+	if ty.IsPrimitiveType() {
+		converted, err := convert.Convert(val, ty)
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid value for variable",
+				Detail:   fmt.Sprintf("The value %q given for %q must be a %s, like the variable's default.", val.AsString(), v.Name, ty.FriendlyName()),
+				Subject:  v.DeclRange.Ptr(),
+			})
+			return v.Value, diags
+		}
+		return converted, diags
+	}
+
+	expr, d := hclsyntax.ParseExpression([]byte(val.AsString()), "-var "+v.Name, hcl.Pos{Line: 1, Column: 1})
+	if !d.HasErrors() {
+		var parsed cty.Value
+		parsed, d = expr.Value(nil)
+		if !d.HasErrors() {
+			return parsed, diags
+		}
+	}
+	diags = append(diags, &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid value for variable",
+		Detail:   fmt.Sprintf("The value %q given for %q must be an HCL expression for a %s, like the variable's default: %s.", val.AsString(), v.Name, ty.FriendlyName(), d[0].Summary),
+		Subject:  v.DeclRange.Ptr(),
+	})
+	return v.Value, diags
+}
+
+// decodeLocals evaluates the attributes of the locals blocks in the context
+// of the suite variables. A local may refer to other locals, in any order, as
+// long as none refers to itself.
+func (l *Loader) decodeLocals(ts *TestSuite, rawLocals []*rawLocals) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	attrs := make(map[string]*hcl.Attribute)
+	bodies := make(map[string]hcl.Body)
+	var names []string
+	for _, rl := range rawLocals {
+		blockAttrs, d := rl.Config.JustAttributes()
+		diags = append(diags, relocateJSONDiagnostics(rl.Config, d)...)
+		sorted := make([]*hcl.Attribute, 0, len(blockAttrs))
+		for _, attr := range blockAttrs {
+			sorted = append(sorted, attr)
+		}
+		for _, attr := range sortedAttributes(sorted) {
+			if prev, exists := attrs[attr.Name]; exists {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate local value",
+					Detail:   fmt.Sprintf("A local value named %q was already declared at %s.", attr.Name, prev.NameRange),
+					Subject:  attr.NameRange.Ptr(),
+				})
+				continue
+			}
+			attrs[attr.Name] = attr
+			bodies[attr.Name] = rl.Config
+			names = append(names, attr.Name)
+		}
+	}
+
+	// evaluating holds the locals whose dependencies are being evaluated,
+	// to detect locals that refer to themselves.
+	evaluating := make(map[string]bool)
+	var evaluate func(name string)
+	evaluate = func(name string) {
+		if _, done := ts.Locals[name]; done {
+			return
+		}
+		attr := attrs[name]
+		if evaluating[name] {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Local value cycle",
+				Detail:   fmt.Sprintf("The local value %q refers to itself, directly or through other local values.", name),
+				Subject:  attr.Expr.Range().Ptr(),
+			})
+			ts.Locals[name] = &Local{Name: name, Value: cty.DynamicVal, DeclRange: attr.NameRange}
+			return
+		}
+
+		evaluating[name] = true
+		for _, traversal := range attr.Expr.Variables() {
+			if traversal.RootName() != "local" || len(traversal) < 2 {
+				continue
+			}
+			if step, ok := traversal[1].(hcl.TraverseAttr); ok && attrs[step.Name] != nil {
+				evaluate(step.Name)
+			}
+		}
+		delete(evaluating, name)
+
+		if _, done := ts.Locals[name]; done {
+			return
+		}
+		val, d := attr.Expr.Value(ts.EvalContext())
+		diags = append(diags, relocateJSONDiagnostics(bodies[name], d)...)
+		ts.Locals[name] = &Local{Name: name, Value: val, DeclRange: attr.NameRange}
+	}
+	for _, name := range names {
+		evaluate(name)
+	}
+
+	return diags
+}
+
+// checkIncludedContent reports the content of an included file that must be
+// in one of the suite's own files: the suitename and testcases.
+func checkIncludedContent(body hcl.Body, content *hcl.BodyContent) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	attrs, _, _ := body.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "suitename"}},
+	})
+	if attr, ok := attrs.Attributes["suitename"]; ok {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Unsupported argument in included file",
+			Detail:   "An included file can declare only variables, locals, fixtures, step templates and further includes, so the suitename must be set in one of the suite's own files.",
+			Subject:  attr.NameRange.Ptr(),
+		})
+	}
+	for _, block := range content.Blocks.OfType("testcase") {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Unsupported block in included file",
+			Detail:   "An included file can declare only variables, locals, fixtures, step templates and further includes, so testcases must be declared in one of the suite's own files.",
+			Subject:  block.DefRange.Ptr(),
+		})
+	}
+
+	return diags
+}
+
+// optionalLabelContent is PartialContent for a schema whose blocks each have
+// a single label that may be omitted. Blocks of both forms are returned in
+// source order; blocks with more than one label are reported as errors.
+func optionalLabelContent(body hcl.Body, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Body, hcl.Diagnostics) {
+	// The diagnostics of the full schema are those of its attributes plus
+	// those of the blocks, which are instead collected per block type below.
+	attrSchema := &hcl.BodySchema{Attributes: schema.Attributes}
+	content, _, diags := body.PartialContent(attrSchema)
+	_, remain, _ := body.PartialContent(schema)
+
+	_, native := body.(*hclsyntax.Body)
+	for _, bs := range schema.Blocks {
+		labelled, _, labelledDiags := body.PartialContent(&hcl.BodySchema{
+			Blocks: []hcl.BlockHeaderSchema{bs},
+		})
+		unlabelled, _, unlabelledDiags := body.PartialContent(&hcl.BodySchema{
+			Blocks: []hcl.BlockHeaderSchema{{Type: bs.Type}},
+		})
+
+		// In JSON a single property holds every block of a type, and an
+		// object of labelled blocks is also a valid unlabelled block, so
+		// the unlabelled form is only chosen when the labelled one does
+		// not fit.
+		if !native {
+			if labelledDiags.HasErrors() && !unlabelledDiags.HasErrors() {
+				content.Blocks = append(content.Blocks, unlabelled.Blocks...)
+				diags = append(diags, unlabelledDiags...)
+			} else {
+				content.Blocks = append(content.Blocks, labelled.Blocks...)
+				diags = append(diags, labelledDiags...)
+			}
+			continue
+		}
+
+		// Every block that the unlabelled schema rejects is also rejected
+		// or accepted by the labelled one, so only the complaints of the
+		// latter about the missing label of unlabelled blocks are dropped.
+		unlabelledAt := make(map[hcl.Pos]bool, len(unlabelled.Blocks))
+		for _, block := range unlabelled.Blocks {
+			unlabelledAt[block.TypeRange.Start] = true
+		}
+		for _, diag := range labelledDiags {
+			if diag.Context != nil && unlabelledAt[diag.Context.Start] {
+				continue
+			}
+			diags = append(diags, diag)
+		}
+		content.Blocks = append(content.Blocks, labelled.Blocks...)
+		content.Blocks = append(content.Blocks, unlabelled.Blocks...)
+	}
+
+	// JSON objects of labelled blocks are unordered, but each block's
+	// range still gives its position.
+	sort.SliceStable(content.Blocks, func(i, j int) bool {
+		return content.Blocks[i].DefRange.Start.Byte < content.Blocks[j].DefRange.Start.Byte
+	})
+
+	return content, remain, diags
+}
+
+// blockName returns the name of a testcase, step or fixture block, which is
+// either its label or the value of the attribute that names unlabelled
+// blocks.
+func blockName(block *hcl.Block, attr *string, attrName string) (string, hcl.Diagnostics) {
+	switch {
+	case len(block.Labels) > 0 && attr != nil:
+		return "", hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Conflicting " + block.Type + " name",
+			Detail:   fmt.Sprintf("The %s is named %q by its label, so it cannot also set %s.", block.Type, block.Labels[0], attrName),
+			Subject:  block.LabelRanges[0].Ptr(),
+		}}
+	case len(block.Labels) > 0:
+		return block.Labels[0], nil
+	case attr != nil:
+		return *attr, nil
+	}
+	return "", hcl.Diagnostics{{
+		Severity: hcl.DiagError,
+		Summary:  "Missing required attribute",
+		Detail:   fmt.Sprintf("The attribute %q is required for a %s without a label, but no definition was found.", attrName, block.Type),
+		Subject:  block.Body.MissingItemRange().Ptr(),
+	}}
+}
+
+// decodeTestCase decodes the testcase inst of a testcase block. The suite's
+// context is extended with each for expanded testcases.
+func (l *Loader) decodeTestCase(ts *TestSuite, block *hcl.Block, inst caseInstance) (*TestCase, hcl.Diagnostics) {
+	ctx := inst.evalContext(ts.EvalContext())
+	content, remain, diags := optionalLabelContent(block.Body, testCaseBlockSchema)
+
+	rtc := rawTestCase{}
+	d := relocateJSONDiagnostics(remain, gohcl.DecodeBody(remain, ctx, &rtc))
+	diags = append(diags, d...)
+	if d.HasErrors() {
+		return nil, diags
+	}
+
+	baseName, d := blockName(block, rtc.Name, "casename")
+	diags = append(diags, d...)
+	if d.HasErrors() {
+		return nil, diags
+	}
+	name := inst.instanceName(baseName)
+
+	if l.Filter != nil && !l.Filter.matchCase(name) {
+		ts.filteredCases[name] = true
+		ts.filteredCases[baseName] = true
+		return nil, diags
+	}
+
+	stepBlocks := content.Blocks.OfType("step")
+	fixtureBlocks := content.Blocks.OfType("fixture")
+
+	tc := &TestCase{
+		Name:            name,
+		each:            inst.each,
+		baseName:        baseName,
+		Enabled:         rtc.Enabled == nil || *rtc.Enabled,
+		DeclRange:       block.DefRange,
+		TestSteps:       make([]*TestStep, 0, len(stepBlocks)),
+		StepMap:         make(map[string]*TestStep, len(stepBlocks)),
+		stepDepGraph:    simple.NewDirectedGraph(),
+		stepDepGraphMap: make(map[graph.Node]*TestStep, len(stepBlocks)+1),
+		stepDepKinds:    make(map[stepDepEdge]DependencyKind),
+		filteredSteps:   make(map[string]bool),
+		brokenModules:   make(map[string]bool),
+	}
+
+	if rtc.Tags != nil {
+		tc.Tags = *rtc.Tags
+	}
+
+	tc.dependsOn, d = decodeStepRefs(rtc.DependsOn, ctx)
+	diags = append(diags, d...)
+
+	tc.stepDepRoot = tc.stepDepGraph.NewNode()
+	tc.stepDepGraph.AddNode(tc.stepDepRoot)
+	tc.stepDepGraphMap[tc.stepDepRoot] = nil
+
+	tc.Fixtures, d = l.decodeFixtures(fixtureBlocks, ctx, ts.Fixtures, fmt.Sprintf("testcase %q", name))
+	diags = append(diags, d...)
+
+	steps := make([]*TestStep, 0, len(stepBlocks))
+	for i, sb := range stepBlocks {
+		step, d := l.decodeTestStep(ts, sb, uint64(i)+1, ctx)
+		diags = append(diags, d...)
+		if step != nil {
+			steps = append(steps, step)
+		}
+	}
+
+	// The steps of modules follow the testcase's own steps.
+	modules := make(map[string]*Module)
+	for _, mb := range content.Blocks.OfType("module") {
+		m, moduleSteps, d := l.decodeModule(ts, mb, ctx)
+		diags = append(diags, d...)
+		if m == nil {
+			if len(mb.Labels) > 0 {
+				tc.brokenModules[mb.Labels[0]] = true
+			}
+			continue
+		}
+		if prev, exists := modules[m.Name]; exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate module",
+				Detail:   fmt.Sprintf("A module named %q was already declared in testcase %q at %s.", m.Name, name, prev.DeclRange),
+				Subject:  m.DeclRange.Ptr(),
+			})
+			continue
+		}
+		modules[m.Name] = m
+		tc.Modules = append(tc.Modules, m)
+
+		for _, step := range moduleSteps {
+			step.StepNum = uint64(len(steps)) + 1
+			steps = append(steps, step)
+		}
+	}
+
+	// Ids are checked before filtering so that a duplicate is reported
+	// whichever steps are selected.
+	positional := make(map[string]*TestStep, len(steps))
+	for _, step := range steps {
+		if step.autoID {
+			positional[step.id] = step
+		}
+	}
+	declared := make(map[string]*TestStep, len(steps))
+	for _, step := range steps {
+		if prev, exists := positional[step.id]; exists && prev != step {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Step id shadows a positional id",
+				Detail:   fmt.Sprintf("The id %q is also the position of the step without an id declared in testcase %q at %s. Give one of them a different id.", step.id, name, prev.DeclRange),
+				Subject:  step.idRange.Ptr(),
+			})
+			continue
+		}
+		if prev, exists := declared[step.id]; exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate step id",
+				Detail:   fmt.Sprintf("A step with id %q was already declared in testcase %q at %s.", step.id, name, prev.idRange),
+				Subject:  step.idRange.Ptr(),
+			})
+			continue
+		}
+		declared[step.id] = step
+
+		if l.Filter != nil && !l.Filter.matchStep(tc.Tags, step) {
+			tc.filteredSteps[step.id] = true
+			continue
+		}
+
+		if step.module != nil {
+			step.module.Steps = append(step.module.Steps, step)
+		}
+		step.testCase = tc
+		step.caseNode = tc.stepDepGraph.NewNode()
+		tc.StepMap[step.id] = step
+		tc.TestSteps = append(tc.TestSteps, step)
+		tc.stepDepGraph.AddNode(step.caseNode)
+		tc.stepDepGraphMap[step.caseNode] = step
+	}
+
+	// A testcase is dropped when the filter leaves none of its steps, or,
+	// for a testcase without steps, when its own tags are filtered out.
+	if l.Filter != nil {
+		if (len(stepBlocks) > 0 && len(tc.TestSteps) == 0 && !diags.HasErrors()) ||
+			(len(stepBlocks) == 0 && !l.Filter.matchTags(tc.Tags)) {
+			ts.filteredCases[tc.Name] = true
+			ts.filteredCases[baseName] = true
+			return nil, diags
+		}
+	}
+
+	return tc, diags
+}
+
+// decodeFixtures decodes the fixture blocks of owner, such as "the suite" or
+// `testcase "case1"`, which may not reuse the names of suiteFixtures.
+func (l *Loader) decodeFixtures(blocks hcl.Blocks, ctx *hcl.EvalContext, suiteFixtures []*TestCaseFixture, owner string) ([]*TestCaseFixture, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+
+	type declaration struct {
+		owner string
+		rng   hcl.Range
+	}
+	declared := make(map[string]declaration, len(suiteFixtures)+len(blocks))
+	for _, fixture := range suiteFixtures {
+		declared[fixture.Name] = declaration{"the suite", fixture.DeclRange}
+	}
+
+	fixtures := make([]*TestCaseFixture, 0, len(blocks))
+	for _, fb := range blocks {
+		rawFixture := rawTestCaseFixture{}
+		d := relocateJSONDiagnostics(fb.Body, gohcl.DecodeBody(fb.Body, ctx, &rawFixture))
+		diags = append(diags, d...)
+		if d.HasErrors() {
+			continue
+		}
+		fixtureName, d := blockName(fb, rawFixture.Name, "fixturename")
+		diags = append(diags, d...)
+		if d.HasErrors() {
+			continue
+		}
+		if l.Strict {
+			diags = append(diags, checkStrict(rawFixture.Config, nil, fixtureHeaderNames)...)
+		}
+
+		if prev, exists := declared[fixtureName]; exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate fixture",
+				Detail:   fmt.Sprintf("A fixture named %q was already declared in %s at %s.", fixtureName, prev.owner, prev.rng),
+				Subject:  fb.DefRange.Ptr(),
+			})
+			continue
+		}
+		declared[fixtureName] = declaration{owner, fb.DefRange}
+
+		fixtures = append(fixtures, &TestCaseFixture{
+			Name:      fixtureName,
+			Config:    rawFixture.Config,
+			DeclRange: fb.DefRange,
+		})
+	}
+
+	return fixtures, diags
+}
+
+func (l *Loader) decodeTestStep(ts *TestSuite, block *hcl.Block, stepNum uint64, ctx *hcl.EvalContext) (*TestStep, hcl.Diagnostics) {
+	step := &TestStep{
+		Type:      DefaultStepType,
+		StepNum:   stepNum,
+		DeclRange: block.DefRange,
+	}
+
+	// A step that uses a template is decoded from the template's body with
+	// the step's own content merged over it.
+	body := block.Body
+	content, remain, diags := block.Body.PartialContent(useSchema)
+	if attr, ok := content.Attributes["use"]; ok {
+		var d hcl.Diagnostics
+		step.template, d = ts.useTemplate(attr, ctx)
+		diags = append(diags, d...)
+		if d.HasErrors() {
+			return nil, relocateJSONDiagnostics(block.Body, diags)
+		}
+		step.useRange = attr.Range
+		body = &templateBody{template: step.template.Body, step: remain}
+	}
+
+	rawStep := rawTestStep{}
+	diags = append(diags, gohcl.DecodeBody(body, ctx, &rawStep)...)
+	diags = relocateJSONDiagnostics(body, diags)
+	if diags.HasErrors() {
+		return nil, step.annotateTemplate(diags)
+	}
+	step.Config = rawStep.Config
+
+	var d hcl.Diagnostics
+	step.snapshots, d = decodeSnapshots(rawStep.Snapshots)
+	diags = append(diags, d...)
+
+	if rawStep.Tags != nil {
+		step.Tags = *rawStep.Tags
+	}
+
+	// A step's label is its id, like the id attribute of an unlabelled step,
+	// and stepname only describes it.
+	switch {
+	case len(block.Labels) > 0 && rawStep.ID != nil:
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Conflicting step id",
+			Detail:   fmt.Sprintf("The step is identified as %q by its label, so it cannot also set id.", block.Labels[0]),
+			Subject:  block.LabelRanges[0].Ptr(),
+		})
+		return nil, step.annotateTemplate(diags)
+	case len(block.Labels) > 0:
+		step.id = block.Labels[0]
+		step.Name = step.id
+		if rawStep.Name != nil {
+			step.Name = *rawStep.Name
+		}
+		step.idRange = block.LabelRanges[0]
+	default:
+		var d hcl.Diagnostics
+		step.Name, d = blockName(block, rawStep.Name, "stepname")
+		diags = append(diags, d...)
+		if d.HasErrors() {
+			return nil, step.annotateTemplate(diags)
+		}
+		if rawStep.ID != nil {
+			d := gohcl.DecodeExpression(rawStep.ID.Expr, ctx, &step.id)
+			diags = append(diags, d...)
+			if d.HasErrors() {
+				return nil, step.annotateTemplate(diags)
+			}
+			step.idRange = rawStep.ID.Expr.Range()
+		}
+		if strings.TrimSpace(step.id) == "" {
+			step.id = strconv.FormatUint(stepNum, 10)
+			step.idRange = block.DefRange
+			step.autoID = true
+		}
+	}
+
+	if rawStep.Type != nil {
+		d := gohcl.DecodeExpression(rawStep.Type.Expr, ctx, &step.Type)
+		diags = append(diags, d...)
+		if d.HasErrors() {
+			return nil, step.annotateTemplate(diags)
+		}
+	}
+
+	stepType, known := stepTypes[step.Type]
+	switch {
+	case !known:
+		names := StepTypeNames()
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Unsupported step type",
+			Detail:   fmt.Sprintf("There is no step type named %q.%s Supported types are: %s.", step.Type, didYouMean(step.Type, names), strings.Join(names, ", ")),
+			Subject:  rawStep.Type.Expr.Range().Ptr(),
+		})
+	case l.Strict:
+		diags = append(diags, checkStrict(step.Config, stepType.Schema(), stepHeaderNames)...)
+	}
+
+	step.runBefore, d = decodeStepRefs(rawStep.RunBefore, ctx)
+	diags = append(diags, d...)
+	step.runAfter, d = decodeStepRefs(rawStep.RunAfter, ctx)
+	diags = append(diags, d...)
+
+	return step, step.annotateTemplate(diags)
+}
+
+// decodeStepRefs decodes a before, after or depends_on attribute into the list
+// of step ids or testcase names it holds, keeping the source range of each
+// element so that dependency errors can point at the offending name.
+func decodeStepRefs(attr *hcl.Attribute, ctx *hcl.EvalContext) ([]stepRef, hcl.Diagnostics) {
+	if attr == nil {
+		return nil, nil
+	}
+
+	exprs, diags := hcl.ExprList(attr.Expr)
+	refs := make([]stepRef, 0, len(exprs))
+	for _, expr := range exprs {
+		var id string
+		d := gohcl.DecodeExpression(expr, ctx, &id)
+		diags = append(diags, d...)
+		if d.HasErrors() {
+			continue
+		}
+
+		refs = append(refs, stepRef{
+			id:  id,
+			rng: expr.Range(),
+		})
+	}
+
+	return refs, diags
+}
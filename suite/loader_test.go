@@ -0,0 +1,892 @@
+package suite
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// writeSuite writes files, keyed by name, to a new temporary directory and
+// returns the directory.
+func writeSuite(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "suite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for name, src := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// loadSuite loads a suite from src, failing the test on any error.
+func loadSuite(t *testing.T, l *Loader, src string) *TestSuite {
+	t.Helper()
+	ts, diags := l.Load(writeSuite(t, map[string]string{"suite.hcl": src}))
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %s", diags.Error())
+	}
+	return ts
+}
+
+// diagSummaries returns the summaries of the errors in diags.
+func diagSummaries(diags hcl.Diagnostics) []string {
+	var summaries []string
+	for _, diag := range diags {
+		if diag.Severity == hcl.DiagError {
+			summaries = append(summaries, diag.Summary)
+		}
+	}
+	return summaries
+}
+
+func stepIDs(steps []*TestStep) []string {
+	ids := make([]string, 0, len(steps))
+	for _, step := range steps {
+		ids = append(ids, step.ID())
+	}
+	return ids
+}
+
+func TestLoaderDiagnostics(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "valid",
+			src: `
+suitename = "s"
+
+testcase "c" {
+  step "a" {}
+  step "b" {
+    after = ["a"]
+  }
+}
+`,
+		},
+		{
+			name: "missing suitename",
+			src:  "testcase \"c\" {}\n",
+			want: []string{"Missing suitename"},
+		},
+		{
+			name: "duplicate testcase",
+			src: `
+suitename = "s"
+testcase "c" {}
+testcase "c" {}
+`,
+			want: []string{"Duplicate testcase"},
+		},
+		{
+			name: "duplicate variable",
+			src: `
+suitename = "s"
+variable "v" {
+  default = 1
+}
+variable "v" {
+  default = 2
+}
+`,
+			want: []string{"Duplicate variable"},
+		},
+		{
+			name: "local cycle",
+			src: `
+suitename = "s"
+locals {
+  a = local.b
+  b = local.a
+}
+`,
+			want: []string{"Local value cycle"},
+		},
+		{
+			name: "duplicate step id",
+			src: `
+suitename = "s"
+testcase "c" {
+  step "a" {}
+  step "a" {}
+}
+`,
+			want: []string{"Duplicate step id"},
+		},
+		{
+			name: "conflicting step id",
+			src: `
+suitename = "s"
+testcase "c" {
+  step "a" {
+    id = "b"
+  }
+}
+`,
+			want: []string{"Conflicting step id"},
+		},
+		{
+			name: "conflicting testcase name",
+			src: `
+suitename = "s"
+testcase "a" {
+  casename = "b"
+}
+`,
+			want: []string{"Conflicting testcase name"},
+		},
+		{
+			name: "duplicate labelled and named testcase",
+			src: `
+suitename = "s"
+testcase "a" {}
+testcase {
+  casename = "a"
+}
+`,
+			want: []string{"Duplicate testcase"},
+		},
+		{
+			name: "unsupported step type",
+			src: `
+suitename = "s"
+testcase "c" {
+  step "a" {
+    type = "exce"
+  }
+}
+`,
+			want: []string{"Unsupported step type"},
+		},
+		{
+			name: "missing dependency",
+			src: `
+suitename = "s"
+testcase "c" {
+  step "a" {
+    after = ["b"]
+  }
+}
+`,
+			want: []string{"Step dependency not found"},
+		},
+		{
+			name: "step cycle",
+			src: `
+suitename = "s"
+testcase "c" {
+  step "a" {
+    after = ["b"]
+  }
+  step "b" {
+    after = ["a"]
+  }
+}
+`,
+			want: []string{"Dependency cycle between steps"},
+		},
+		{
+			name: "step after itself",
+			src: `
+suitename = "s"
+testcase "c" {
+  step "a" {
+    after = ["a"]
+  }
+  step "b" {
+    before = ["c.b"]
+  }
+}
+`,
+			want: []string{"Step depends on itself", "Step depends on itself"},
+		},
+		{
+			name: "step referring to its own results",
+			src: `
+suitename = "s"
+testcase "c" {
+  step "a" {
+    type    = "exec"
+    command = "echo"
+    args    = [step.a.stdout]
+  }
+}
+`,
+			want: []string{"Step depends on itself"},
+		},
+		{
+			name: "testcase cycle",
+			src: `
+suitename = "s"
+testcase "a" {
+  depends_on = ["b"]
+}
+testcase "b" {
+  depends_on = ["a"]
+}
+`,
+			want: []string{"Dependency cycle between testcases"},
+		},
+		{
+			name: "missing testcase dependency",
+			src: `
+suitename = "s"
+testcase "a" {
+  depends_on = ["b"]
+}
+`,
+			want: []string{"Testcase dependency not found"},
+		},
+		{
+			name: "testcase depending on itself",
+			src: `
+suitename = "s"
+testcase "a" {
+  depends_on = ["a"]
+}
+`,
+			want: []string{"Testcase depends on itself"},
+		},
+		{
+			name: "missing step of another testcase",
+			src: `
+suitename = "s"
+testcase "a" {
+  step "x" {}
+}
+testcase "b" {
+  step "y" {
+    after = ["a.z"]
+  }
+}
+`,
+			want: []string{"Step dependency not found"},
+		},
+		{
+			name: "cross-testcase step cycle",
+			src: `
+suitename = "s"
+testcase "a" {
+  step "x" {
+    after = ["b.y"]
+  }
+}
+testcase "b" {
+  step "y" {
+    after = ["a.x"]
+  }
+}
+`,
+			want: []string{"Dependency cycle between testcases"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := writeSuite(t, map[string]string{"suite.hcl": test.src})
+			_, diags := NewLoader().Load(dir)
+			if got := diagSummaries(diags); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got errors %q, want %q\n%s", got, test.want, diags.Error())
+			}
+		})
+	}
+}
+
+func TestLoaderSelfDependency(t *testing.T) {
+	dir := writeSuite(t, map[string]string{"suite.hcl": `suitename = "s"
+
+testcase "c" {
+  step "a" {
+    after = ["b", "a"]
+  }
+
+  step "b" {
+    value = step.b.value
+  }
+}
+`})
+	_, diags := NewLoader().Load(dir)
+	var got []string
+	for _, diag := range diags {
+		got = append(got, fmt.Sprintf("%s at %s", diag.Summary, diag.Subject))
+	}
+	want := []string{
+		"Step depends on itself at suite.hcl:5,19-22",
+		"Step depends on itself at suite.hcl:9,13-19",
+	}
+	for i := range want {
+		want[i] = strings.Replace(want[i], "suite.hcl", filepath.Join(dir, "suite.hcl"), 1)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLoaderDuplicateStepIDs(t *testing.T) {
+	dir := writeSuite(t, map[string]string{"suite.hcl": `suitename = "s"
+
+testcase "c" {
+  step "a" {}
+
+  step {
+    id       = "a"
+    stepname = "again"
+  }
+
+  step {
+    stepname = "third"
+  }
+
+  step {
+    id       = "3"
+    stepname = "shadow"
+  }
+}
+`})
+	_, diags := NewLoader().Load(dir)
+	filename := filepath.Join(dir, "suite.hcl")
+	var got []string
+	for _, diag := range diags {
+		got = append(got, fmt.Sprintf("%s at %s: %s", diag.Summary, diag.Subject, diag.Detail))
+	}
+	want := []string{
+		`Duplicate step id at suite.hcl:7,16-19: A step with id "a" was already declared in testcase "c" at suite.hcl:4,8-11.`,
+		`Step id shadows a positional id at suite.hcl:16,16-19: The id "3" is also the position of the step without an id declared in testcase "c" at suite.hcl:11,3-7. Give one of them a different id.`,
+	}
+	for i := range want {
+		want[i] = strings.Replace(want[i], "suite.hcl", filename, -1)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLoaderIncludes(t *testing.T) {
+	dir := writeSuite(t, map[string]string{
+		"suite.hcl": `suitename = "s"
+
+include "common/vars.hcl" {}
+include "common/fixtures.hcl" {}
+
+testcase "c" {
+  step "a" {
+    value = "${greeting}, ${shared.name}"
+  }
+}
+`,
+		"common/vars.hcl": `include "fixtures.hcl" {}
+
+variable "name" {
+  default = "world"
+}
+
+locals {
+  greeting = "hello"
+}
+`,
+		"common/fixtures.hcl": `fixture "shared" {
+  name = name
+}
+`,
+	})
+
+	ts, diags := NewLoader().Load(dir)
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	if ts.Variables["name"] == nil || ts.Locals["greeting"] == nil {
+		t.Errorf("the included variable or local is missing")
+	}
+	if len(ts.Fixtures) != 1 || ts.Fixtures[0].Name != "shared" {
+		t.Errorf("got fixtures %v, want the included fixture once", ts.Fixtures)
+	}
+}
+
+func TestLoaderIncludeDiagnostics(t *testing.T) {
+	tests := []struct {
+		name string
+
+		// b holds common/b.hcl, which common/a.hcl includes, which
+		// suite.hcl includes. want holds the summary and detail of the
+		// expected error, with @suite, @a and @b standing for the
+		// filenames.
+		b    string
+		want string
+	}{
+		{
+			name: "cycle",
+			b: `include "a.hcl" {}
+`,
+			want: `Include cycle at @b:1,1-16: The file "@a" includes itself through @a -> @b -> @a.`,
+		},
+		{
+			name: "error in included file",
+			b: `variable "v" {
+  default = undefined
+}
+`,
+			want: `Variables not allowed at @b:2,13-22: Variables may not be used here.`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := writeSuite(t, map[string]string{
+				"suite.hcl": `suitename = "s"
+
+include "common/a.hcl" {}
+`,
+				"common/a.hcl": `include "b.hcl" {}
+`,
+				"common/b.hcl": test.b,
+			})
+
+			_, diags := NewLoader().Load(dir)
+			var got []string
+			for _, diag := range diags {
+				got = append(got, fmt.Sprintf("%s at %s: %s", diag.Summary, diag.Subject, diag.Detail))
+			}
+			want := test.want + "\n\nThe file @b is included from @a:1,1-16, which is included from @suite:3,1-23."
+			want = strings.NewReplacer(
+				"@suite", filepath.Join(dir, "suite.hcl"),
+				"@a", filepath.Join(dir, "common", "a.hcl"),
+				"@b", filepath.Join(dir, "common", "b.hcl"),
+			).Replace(want)
+			if !reflect.DeepEqual(got, []string{want}) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestLoaderNoFiles(t *testing.T) {
+	_, diags := NewLoader().Load(writeSuite(t, nil))
+	if got, want := diagSummaries(diags), []string{"No suite files"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors %q, want %q", got, want)
+	}
+}
+
+func TestLoaderStepOrder(t *testing.T) {
+	// The unlabelled steps are identified by their positions.
+	ts := loadSuite(t, NewLoader(), `
+suitename = "s"
+
+testcase {
+  casename = "c"
+
+  step {
+    stepname = "first"
+  }
+
+  step {
+    stepname = "post-trailer"
+    after    = ["trailer"]
+  }
+
+  step {
+    id       = "trailer"
+    stepname = "trailer"
+    after    = ["1", "s2", "5"]
+  }
+
+  step {
+    id       = "s2"
+    stepname = "second"
+    before   = ["1"]
+  }
+
+  step {
+    stepname = "third"
+    after    = ["s2"]
+  }
+
+  step {
+    id       = "pre-trailer"
+    stepname = "pre-trailer"
+    before   = ["trailer"]
+  }
+}
+`)
+
+	tc := ts.Case("c")
+	if tc == nil {
+		t.Fatal("testcase c not found")
+	}
+	got := stepIDs(tc.OrderedSteps())
+	want := []string{"s2", "1", "5", "pre-trailer", "trailer", "2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got order %q, want %q", got, want)
+	}
+}
+
+func TestLoaderLabels(t *testing.T) {
+	// Labelled blocks and blocks named by attributes can be mixed, and the
+	// label of a labelled step is its id.
+	ts := loadSuite(t, NewLoader(), `
+suitename = "s"
+
+testcase "labelled" {
+  step "first" {}
+
+  step {
+    id       = "second"
+    stepname = "second"
+  }
+
+  step {
+    stepname = "third"
+  }
+}
+
+testcase {
+  casename = "named"
+
+  step "a" {}
+}
+`)
+
+	var names []string
+	for _, tc := range ts.TestCases {
+		names = append(names, tc.Name)
+	}
+	if want := []string{"labelled", "named"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got testcases %q, want %q", names, want)
+	}
+	if got, want := stepIDs(ts.Case("labelled").OrderedSteps()), []string{"first", "second", "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got steps %q, want %q", got, want)
+	}
+	if got, want := stepIDs(ts.Case("named").OrderedSteps()), []string{"a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got steps %q, want %q", got, want)
+	}
+}
+
+func TestLoaderCaseOrder(t *testing.T) {
+	// A step ordered against a step of another testcase makes its testcase
+	// depend on that testcase.
+	ts := loadSuite(t, NewLoader(), `
+suitename = "s"
+
+testcase "last" {
+  depends_on = ["middle"]
+}
+
+testcase "middle" {
+  step "a" {
+    after = ["first.a"]
+  }
+}
+
+testcase "first" {
+  step "a" {}
+}
+
+testcase "apart" {}
+`)
+
+	var got []string
+	for _, tc := range ts.OrderedCases() {
+		got = append(got, tc.Name)
+	}
+	if want := []string{"first", "middle", "last", "apart"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got order %q, want %q", got, want)
+	}
+
+	deps := ts.CaseDependencies(ts.Case("middle"))
+	if len(deps) != 1 || deps[0].Name != "first" {
+		t.Errorf("got dependencies %v for middle, want first", deps)
+	}
+	if deps := ts.CaseDependencies(ts.Case("apart")); len(deps) != 0 {
+		t.Errorf("got dependencies %v for apart, want none", deps)
+	}
+}
+
+func TestLoaderVariables(t *testing.T) {
+	l := NewLoader()
+	l.SetVariable("name", cty.StringVal("override"))
+	ts := loadSuite(t, l, `
+suitename = "s"
+
+variable "name" {
+  default = "default"
+}
+
+locals {
+  greeting = "hello ${name}"
+}
+`)
+	if got := ts.Locals["greeting"].Value.AsString(); got != "hello override" {
+		t.Errorf("got greeting %q, want %q", got, "hello override")
+	}
+
+	src := `
+suitename = "s"
+
+variable "count" {
+  default = 5
+}
+
+variable "enabled" {
+  default = false
+}
+
+variable "names" {
+  default = ["a"]
+}
+`
+	l = NewLoader()
+	l.SetVariable("count", cty.StringVal("7"))
+	l.SetVariable("enabled", cty.StringVal("true"))
+	l.SetVariable("names", cty.StringVal(`["b", "c"]`))
+	ts = loadSuite(t, l, src)
+	want := map[string]cty.Value{
+		"count":   cty.NumberIntVal(7),
+		"enabled": cty.True,
+		"names":   cty.TupleVal([]cty.Value{cty.StringVal("b"), cty.StringVal("c")}),
+	}
+	for name, val := range want {
+		if got := ts.Variables[name].Value; !got.RawEquals(val) {
+			t.Errorf("got %s = %#v, want %#v", name, got, val)
+		}
+	}
+
+	for name, val := range map[string]string{"count": "seven", "names": "[b"} {
+		l = NewLoader()
+		l.SetVariable(name, cty.StringVal(val))
+		_, diags := l.Load(writeSuite(t, map[string]string{"suite.hcl": src}))
+		if got, want := diagSummaries(diags), []string{"Invalid value for variable"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %q: got errors %q, want %q", name, val, got, want)
+		}
+	}
+
+	l = NewLoader()
+	l.SetVariable("undeclared", cty.StringVal("x"))
+	_, diags := l.Load(writeSuite(t, map[string]string{"suite.hcl": "suitename = \"s\"\n"}))
+	if len(diags) != 1 || diags[0].Severity != hcl.DiagWarning || diags[0].Summary != "Value for undeclared variable" {
+		t.Errorf("got %s, want a warning for the undeclared variable", diags.Error())
+	}
+}
+
+func TestFilter(t *testing.T) {
+	src := `
+suitename = "s"
+
+testcase "one" {
+  tags = ["slow"]
+
+  step "a" {}
+  step "b" {
+    tags  = ["db"]
+    after = ["a"]
+  }
+}
+
+testcase "two" {
+  step "a" {}
+  step "c" {
+    tags = ["db"]
+  }
+}
+`
+	tests := []struct {
+		run, tags, skipTags string
+		want                []string
+	}{
+		{want: []string{"one/a", "one/b", "two/a", "two/c"}},
+		{run: "one", want: []string{"one/a", "one/b"}},
+		{run: "/a", want: []string{"one/a", "two/a"}},
+		{run: "t.o/c", want: []string{"two/c"}},
+		{tags: "db", want: []string{"one/b", "two/c"}},
+		{tags: "slow", skipTags: "db", want: []string{"one/a"}},
+		{skipTags: "slow,db", want: []string{"two/a"}},
+		{tags: "slow and db", want: []string{"one/b"}},
+		{tags: "not slow", want: []string{"two/a", "two/c"}},
+		{tags: "db and not slow or slow and not db", want: []string{"one/a", "two/c"}},
+		{tags: "not (slow or db)", want: []string{"two/a"}},
+		{skipTags: "slow and not db", want: []string{"one/b", "two/a", "two/c"}},
+	}
+
+	dir := writeSuite(t, map[string]string{"suite.hcl": src})
+	for _, test := range tests {
+		name := strings.Join([]string{test.run, test.tags, test.skipTags}, ";")
+		t.Run(name, func(t *testing.T) {
+			filter, err := NewFilter(test.run, test.tags, test.skipTags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			l := NewLoader()
+			l.Filter = filter
+			ts, diags := l.Load(dir)
+			if diags.HasErrors() {
+				t.Fatal(diags.Error())
+			}
+
+			var got []string
+			for _, tc := range ts.TestCases {
+				for _, step := range tc.TestSteps {
+					got = append(got, tc.Name+"/"+step.ID())
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got steps %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterInvalid(t *testing.T) {
+	for _, run := range []string{"(", "a/b/c"} {
+		if _, err := NewFilter(run, "", ""); err == nil {
+			t.Errorf("NewFilter(%q) succeeded, want an error", run)
+		}
+	}
+	for _, tags := range []string{"slow and", "(slow", "slow)", "or db", "not", "slow db", "a,,b"} {
+		if _, err := NewFilter("", tags, ""); err == nil {
+			t.Errorf("NewFilter with tags %q succeeded, want an error", tags)
+		}
+	}
+}
+
+func TestParseTagExpr(t *testing.T) {
+	tests := map[string]string{
+		"slow":                     "slow",
+		"slow,db":                  "(slow or db)",
+		"a or b and not c":         "(a or (b and not c))",
+		"not not a":                "not not a",
+		"(a or b) and c":           "((a or b) and c)",
+		"a and b or c, d":          "(((a and b) or c) or d)",
+		" ( a ) ":                  "a",
+		"ci-linux and not db.slow": "(ci-linux and not db.slow)",
+	}
+	for src, want := range tests {
+		expr, err := parseTagExpr(src)
+		if err != nil {
+			t.Errorf("%q: %v", src, err)
+			continue
+		}
+		if got := expr.String(); got != want {
+			t.Errorf("%q: got %s, want %s", src, got, want)
+		}
+	}
+}
+
+func TestLoaderExpansion(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		cases    []string
+		errors   []string
+		warnings []string
+	}{
+		{
+			name: "for_each map",
+			src: `
+testcase "k" {
+  for_each = { a = 1, b = 2 }
+}
+`,
+			cases: []string{"k[a]", "k[b]"},
+		},
+		{
+			name: "matrix",
+			src: `
+testcase "m" {
+  matrix {
+    os   = ["linux", "darwin"]
+    mode = ["fast"]
+  }
+}
+`,
+			cases: []string{"m[os=linux,mode=fast]", "m[os=darwin,mode=fast]"},
+		},
+		{
+			name: "slash in for_each key",
+			src: `
+testcase "k" {
+  for_each = { "a/b" = 1 }
+}
+`,
+			errors: []string{"Invalid for_each argument"},
+		},
+		{
+			name: "slash in for_each element",
+			src: `
+testcase "k" {
+  for_each = ["a/b"]
+}
+`,
+			errors: []string{"Invalid for_each argument"},
+		},
+		{
+			name: "slash in matrix value",
+			src: `
+testcase "m" {
+  matrix {
+    platform = ["linux/amd64"]
+  }
+}
+`,
+			errors: []string{"Invalid matrix values"},
+		},
+		{
+			name: "empty matrix values",
+			src: `
+testcase "m" {
+  matrix {
+    os   = ["linux"]
+    mode = []
+  }
+}
+`,
+			warnings: []string{"Empty matrix values"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := "suitename = \"s\"\n" + test.src
+			ts, diags := NewLoader().Load(writeSuite(t, map[string]string{"suite.hcl": src}))
+
+			var warnings []string
+			for _, diag := range diags {
+				if diag.Severity == hcl.DiagWarning {
+					warnings = append(warnings, diag.Summary)
+				}
+			}
+			if got := diagSummaries(diags); !reflect.DeepEqual(got, test.errors) {
+				t.Errorf("got errors %q, want %q", got, test.errors)
+			}
+			if !reflect.DeepEqual(warnings, test.warnings) {
+				t.Errorf("got warnings %q, want %q", warnings, test.warnings)
+			}
+			if diags.HasErrors() {
+				return
+			}
+
+			var cases []string
+			for _, tc := range ts.TestCases {
+				cases = append(cases, tc.Name)
+			}
+			if !reflect.DeepEqual(cases, test.cases) {
+				t.Errorf("got testcases %q, want %q", cases, test.cases)
+			}
+		})
+	}
+}
@@ -0,0 +1,372 @@
+package suite
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl2/gohcl"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+var moduleBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "source", Required: true},
+	},
+}
+
+// moduleFileSchema is the content of the files of a module directory.
+var moduleFileSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "input", LabelNames: []string{"name"}},
+		{Type: "output", LabelNames: []string{"name"}},
+		{Type: "fixture", LabelNames: []string{"name"}},
+		{Type: "step", LabelNames: []string{"id"}},
+	},
+}
+
+type rawModuleInput struct {
+	Default *hcl.Attribute `hcl:"default,attr"`
+}
+
+type rawModuleOutput struct {
+	Value hcl.Expression `hcl:"value,attr"`
+}
+
+// Module is a module block of a testcase, which adds the steps and fixtures
+// declared in the directory named by its source to the testcase. The ids of
+// the module's steps are prefixed with the module's name, as in
+// login_flow.s1, and within the module its steps refer to each other by
+// their own ids.
+//
+// The rest of the module block sets the module's inputs, which its steps and
+// fixtures see as input.<name>, and the testcase's steps see the module's
+// outputs as module.<name>.<output>.
+type Module struct {
+	Name      string
+	Source    string
+	Steps     []*TestStep
+	Fixtures  []*TestCaseFixture
+	DeclRange hcl.Range
+
+	// body is the module block without its source, whose attributes are
+	// the inputs given to the module.
+	body hcl.Body
+
+	// inputs are the inputs declared by the module, whose values are
+	// cty.NilVal for the inputs without a default.
+	inputs map[string]cty.Value
+
+	outputs map[string]moduleOutput
+}
+
+// moduleOutput is an output of a module. The body of its block is kept to
+// relocate the diagnostics of JSON expressions.
+type moduleOutput struct {
+	expr hcl.Expression
+	body hcl.Body
+}
+
+// decodeModule decodes a module block and the files of its directory,
+// returning the module and its steps.
+func (l *Loader) decodeModule(ts *TestSuite, block *hcl.Block, ctx *hcl.EvalContext) (*Module, []*TestStep, hcl.Diagnostics) {
+	if len(block.Labels) == 0 {
+		return nil, nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Missing module name",
+			Detail:   "A module block must have a label naming it.",
+			Subject:  block.DefRange.Ptr(),
+		}}
+	}
+
+	m := &Module{
+		Name:      block.Labels[0],
+		DeclRange: block.DefRange,
+		inputs:    make(map[string]cty.Value),
+		outputs:   make(map[string]moduleOutput),
+	}
+
+	content, remain, diags := block.Body.PartialContent(moduleBlockSchema)
+	diags = relocateJSONDiagnostics(block.Body, diags)
+	if diags.HasErrors() {
+		return nil, nil, diags
+	}
+	m.body = remain
+
+	source := content.Attributes["source"]
+	d := gohcl.DecodeExpression(source.Expr, ctx, &m.Source)
+	diags = append(diags, d...)
+	if d.HasErrors() {
+		return nil, nil, diags
+	}
+
+	dir := m.Source
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(block.DefRange.Filename), dir)
+	}
+	var filenames []string
+	fi, err := os.Stat(dir)
+	if err == nil && !fi.IsDir() {
+		err = fmt.Errorf("not a directory")
+	}
+	if err == nil {
+		filenames, d = FindFiles([]string{dir})
+		diags = append(diags, d...)
+		if len(filenames) == 0 && !d.HasErrors() {
+			err = fmt.Errorf("it contains no .hcl or .json files")
+		}
+	}
+	if err != nil {
+		return nil, nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to read module",
+			Detail:   fmt.Sprintf("The module directory %q could not be read: %v.", dir, err),
+			Subject:  source.Expr.Range().Ptr(),
+		})
+	}
+	if diags.HasErrors() {
+		return nil, nil, diags
+	}
+
+	var inputBlocks, outputBlocks, fixtureBlocks, stepBlocks hcl.Blocks
+	for _, filename := range filenames {
+		f, d := l.ParseFile(filename)
+		diags = append(diags, d...)
+		if d.HasErrors() {
+			continue
+		}
+
+		content, remain, d := optionalLabelContent(f.Body, moduleFileSchema)
+		diags = append(diags, d...)
+		_, d = remain.Content(&hcl.BodySchema{})
+		diags = append(diags, d...)
+
+		for _, b := range content.Blocks {
+			switch {
+			case b.Type == "input" || b.Type == "output":
+				if len(b.Labels) == 0 {
+					diags = append(diags, &hcl.Diagnostic{
+						Severity: hcl.DiagError,
+						Summary:  "Missing " + b.Type + " name",
+						Detail:   fmt.Sprintf("An %s block must have a label naming it.", b.Type),
+						Subject:  b.DefRange.Ptr(),
+					})
+				} else if b.Type == "input" {
+					inputBlocks = append(inputBlocks, b)
+				} else {
+					outputBlocks = append(outputBlocks, b)
+				}
+			case b.Type == "fixture":
+				fixtureBlocks = append(fixtureBlocks, b)
+			default:
+				stepBlocks = append(stepBlocks, b)
+			}
+		}
+	}
+	if diags.HasErrors() {
+		return nil, nil, diags
+	}
+
+	declared := make(map[string]hcl.Range, len(inputBlocks)+len(outputBlocks))
+	for _, b := range append(inputBlocks, outputBlocks...) {
+		key := b.Type + "." + b.Labels[0]
+		if prev, exists := declared[key]; exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate module " + b.Type,
+				Detail:   fmt.Sprintf("An %s named %q was already declared at %s.", b.Type, b.Labels[0], prev),
+				Subject:  b.DefRange.Ptr(),
+			})
+			continue
+		}
+		declared[key] = b.DefRange
+
+		if b.Type == "output" {
+			rawOutput := rawModuleOutput{}
+			d := relocateJSONDiagnostics(b.Body, gohcl.DecodeBody(b.Body, nil, &rawOutput))
+			diags = append(diags, d...)
+			if !d.HasErrors() {
+				m.outputs[b.Labels[0]] = moduleOutput{expr: rawOutput.Value, body: b.Body}
+			}
+			continue
+		}
+
+		rawInput := rawModuleInput{}
+		d := relocateJSONDiagnostics(b.Body, gohcl.DecodeBody(b.Body, nil, &rawInput))
+		diags = append(diags, d...)
+		m.inputs[b.Labels[0]] = cty.NilVal
+		if rawInput.Default != nil {
+			val, d := rawInput.Default.Expr.Value(ctx)
+			diags = append(diags, relocateJSONDiagnostics(b.Body, d)...)
+			m.inputs[b.Labels[0]] = val
+		}
+	}
+
+	attrs, d := remain.JustAttributes()
+	diags = append(diags, relocateJSONDiagnostics(remain, d)...)
+	names := m.InputNames()
+	for _, attr := range sortedAttributes(attributeList(attrs)) {
+		if _, exists := m.inputs[attr.Name]; !exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unsupported module input",
+				Detail:   fmt.Sprintf("The module %q has no input named %q.%s", m.Name, attr.Name, didYouMean(attr.Name, names)),
+				Subject:  attr.NameRange.Ptr(),
+			})
+		}
+	}
+	for _, name := range names {
+		if _, given := attrs[name]; !given && m.inputs[name] == cty.NilVal {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Missing module input",
+				Detail:   fmt.Sprintf("The module %q requires the input %q, declared at %s.", m.Name, name, declared["input."+name]),
+				Subject:  block.Body.MissingItemRange().Ptr(),
+			})
+		}
+	}
+
+	m.Fixtures, d = l.decodeFixtures(fixtureBlocks, ctx, nil, fmt.Sprintf("module %q", m.Name))
+	diags = append(diags, d...)
+
+	steps := make([]*TestStep, 0, len(stepBlocks))
+	for i, sb := range stepBlocks {
+		step, d := l.decodeTestStep(ts, sb, uint64(i)+1, ctx)
+		diags = append(diags, d...)
+		if step == nil {
+			continue
+		}
+
+		step.module = m
+		if step.Name == step.id {
+			step.Name = m.Name + "." + step.id
+		}
+		step.id = m.Name + "." + step.id
+		for i := range step.runBefore {
+			step.runBefore[i].id = m.Name + "." + step.runBefore[i].id
+		}
+		for i := range step.runAfter {
+			step.runAfter[i].id = m.Name + "." + step.runAfter[i].id
+		}
+		steps = append(steps, step)
+	}
+
+	return m, steps, diags
+}
+
+// InputNames returns the names of the module's inputs in lexical order.
+func (m *Module) InputNames() []string {
+	names := make([]string, 0, len(m.inputs))
+	for name := range m.inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OutputNames returns the names of the module's outputs in lexical order.
+func (m *Module) OutputNames() []string {
+	names := make([]string, 0, len(m.outputs))
+	for name := range m.outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// localID returns the id of a step of the module within the module.
+func (m *Module) localID(step *TestStep) string {
+	return strings.TrimPrefix(step.id, m.Name+".")
+}
+
+// Module returns the module of the testcase with the given name, or nil.
+func (tc *TestCase) Module(name string) *Module {
+	for _, m := range tc.Modules {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// moduleRun is the state of a module while the steps of a testcase run.
+type moduleRun struct {
+	// ctx is the context of the module's steps, with its inputs, fixtures
+	// and, as they complete, the results of its steps.
+	ctx       *hcl.EvalContext
+	results   map[string]cty.Value
+	remaining int
+
+	// diags holds the diagnostics of evaluating the module's inputs and
+	// fixtures, which fail every step of the module if there are errors.
+	diags hcl.Diagnostics
+}
+
+// start evaluates the inputs of m in caseCtx, the context of the testcase's
+// steps, and then the module's fixtures. The module's steps are evaluated in
+// a child of base, which is where the testcase's own variables are added.
+func (m *Module) start(base, caseCtx *hcl.EvalContext, tc *TestCase) *moduleRun {
+	run := &moduleRun{results: make(map[string]cty.Value)}
+	for _, step := range tc.TestSteps {
+		if step.module == m {
+			run.remaining++
+		}
+	}
+
+	inputs := make(map[string]cty.Value, len(m.inputs))
+	for name, val := range m.inputs {
+		inputs[name] = val
+	}
+	attrs, _ := m.body.JustAttributes()
+	for name, attr := range attrs {
+		val, d := attr.Expr.Value(caseCtx)
+		run.diags = append(run.diags, d...)
+		inputs[name] = val
+	}
+	run.diags = relocateJSONDiagnostics(m.body, run.diags)
+
+	run.ctx = base.NewChild()
+	run.ctx.Variables = map[string]cty.Value{"input": cty.ObjectVal(inputs)}
+
+	fixtures := make(map[string]cty.Value, len(m.Fixtures))
+	for _, fixture := range m.Fixtures {
+		val, d := evalAttributes(expandDynamic(fixture.Config, run.ctx), run.ctx)
+		run.diags = append(run.diags, relocateJSONDiagnostics(fixture.Config, d)...)
+		fixtures[fixture.Name] = val
+	}
+	run.ctx.Variables["fixture"] = cty.ObjectVal(fixtures)
+	run.ctx.Variables["step"] = cty.EmptyObjectVal
+
+	return run
+}
+
+// stepDone records the results of a step of the module that passed. Once
+// every step of the module has, it returns the module's outputs.
+func (m *Module) stepDone(run *moduleRun, step *TestStep, results cty.Value) (cty.Value, hcl.Diagnostics) {
+	run.results[m.localID(step)] = results
+	run.ctx.Variables["step"] = cty.ObjectVal(run.results)
+	run.remaining--
+	if run.remaining > 0 {
+		return cty.NilVal, nil
+	}
+
+	var diags hcl.Diagnostics
+	outputs := make(map[string]cty.Value, len(m.outputs))
+	for name, output := range m.outputs {
+		val, d := output.expr.Value(run.ctx)
+		diags = append(diags, relocateJSONDiagnostics(output.body, d)...)
+		outputs[name] = val
+	}
+	return cty.ObjectVal(outputs), diags
+}
+
+func attributeList(attrs hcl.Attributes) []*hcl.Attribute {
+	list := make([]*hcl.Attribute, 0, len(attrs))
+	for _, attr := range attrs {
+		list = append(list, attr)
+	}
+	return list
+}
@@ -0,0 +1,165 @@
+package suite
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// loginModule holds the files of a module directory whose two steps greet
+// the user given as an input.
+var loginModule = map[string]string{
+	"modules/login/module.hcl": `input "user" {}
+
+input "greeting" {
+  default = "hello"
+}
+
+fixture "f" {
+  punctuation = "!"
+}
+
+step "s1" {
+  text = "${input.greeting}, ${input.user}"
+}
+
+step "s2" {
+  after = ["s1"]
+  text  = "${step.s1.text}${fixture.f.punctuation}"
+}
+
+output "message" {
+  value = step.s2.text
+}
+`,
+}
+
+func TestModule(t *testing.T) {
+	files := map[string]string{"suite.hcl": `
+suitename = "s"
+
+testcase "c" {
+  step "first" {}
+
+  module "login" {
+    source = "./modules/login"
+    user   = "x"
+  }
+
+  step "last" {
+    after   = ["login.s2"]
+    message = module.login.message
+  }
+}
+`}
+	for name, src := range loginModule {
+		files[name] = src
+	}
+	ts, diags := NewLoader().Load(writeSuite(t, files))
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+
+	tc := ts.Case("c")
+	if got, want := stepIDs(tc.OrderedSteps()), []string{"first", "login.s1", "login.s2", "last"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got order %q, want %q", got, want)
+	}
+	if m := tc.Module("login"); m == nil || !reflect.DeepEqual(m.InputNames(), []string{"greeting", "user"}) || !reflect.DeepEqual(m.OutputNames(), []string{"message"}) {
+		t.Errorf("got module %+v", m)
+	}
+
+	result := (&Runner{Suite: ts}).Run(context.Background())
+	if result.Failed() {
+		t.Fatalf("the run failed: %v", stepStatuses(result))
+	}
+	for _, sr := range result.Cases[0].Steps {
+		if sr.Step.ID() != "last" {
+			continue
+		}
+		if got, want := sr.Outputs.GetAttr("message"), cty.StringVal("hello, x!"); !got.RawEquals(want) {
+			t.Errorf("got message %#v, want %#v", got, want)
+		}
+	}
+}
+
+func TestModuleDiagnostics(t *testing.T) {
+	tests := []struct {
+		name   string
+		module string
+		want   []string
+	}{
+		{
+			name: "missing input",
+			module: `
+  module "login" {
+    source = "./modules/login"
+  }
+`,
+			want: []string{"Missing module input"},
+		},
+		{
+			name: "unsupported input",
+			module: `
+  module "login" {
+    source = "./modules/login"
+    user   = "x"
+    usr    = "x"
+  }
+`,
+			want: []string{"Unsupported module input"},
+		},
+		{
+			name: "missing directory",
+			module: `
+  module "login" {
+    source = "./modules/logout"
+  }
+`,
+			want: []string{"Failed to read module"},
+		},
+		{
+			name: "duplicate module",
+			module: `
+  module "login" {
+    source = "./modules/login"
+    user   = "x"
+  }
+
+  module "login" {
+    source = "./modules/login"
+    user   = "y"
+  }
+`,
+			want: []string{"Duplicate module"},
+		},
+		{
+			name: "unknown step of a module",
+			module: `
+  module "login" {
+    source = "./modules/login"
+    user   = "x"
+  }
+
+  step "last" {
+    after = ["login.s3"]
+  }
+`,
+			want: []string{"Step dependency not found"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files := map[string]string{"suite.hcl": "suitename = \"s\"\n\ntestcase \"c\" {\n" + test.module + "}\n"}
+			for name, src := range loginModule {
+				files[name] = src
+			}
+			_, diags := NewLoader().Load(writeSuite(t, files))
+			if got := diagSummaries(diags); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got errors %q, want %q\n%s", got, test.want, diags.Error())
+			}
+		})
+	}
+}
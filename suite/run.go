@@ -0,0 +1,373 @@
+package suite
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Status is the outcome of a step or testcase.
+type Status int
+
+const (
+	StatusPass Status = iota
+	StatusFail
+	StatusSkip
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusPass:
+		return "PASS"
+	case StatusFail:
+		return "FAIL"
+	case StatusSkip:
+		return "SKIP"
+	default:
+		return fmt.Sprintf("Status(%d)", int(s))
+	}
+}
+
+// StepResult is the outcome of a single step.
+type StepResult struct {
+	Step        *TestStep
+	Status      Status
+	Reason      string
+	Outputs     cty.Value
+	Diagnostics hcl.Diagnostics
+	Duration    time.Duration
+}
+
+// CaseResult is the outcome of a testcase and all of its steps, in execution
+// order.
+type CaseResult struct {
+	Case        *TestCase
+	Status      Status
+	Reason      string
+	Steps       []*StepResult
+	Diagnostics hcl.Diagnostics
+	Duration    time.Duration
+}
+
+// SuiteResult is the outcome of a run of the suite. Its diagnostics concern
+// the run as a whole, such as stale snapshots.
+type SuiteResult struct {
+	Suite       *TestSuite
+	Cases       []*CaseResult
+	Diagnostics hcl.Diagnostics
+	Duration    time.Duration
+}
+
+// Failed reports whether any testcase in the run failed.
+func (r *SuiteResult) Failed() bool {
+	for _, cr := range r.Cases {
+		if cr.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+// Runner executes the testcases of a suite.
+type Runner struct {
+	Suite *TestSuite
+
+	// Parallel is the maximum number of testcases that run at the same
+	// time. A testcase starts only once every testcase it depends on has
+	// completed. Values below 1 run one testcase at a time.
+	Parallel int
+
+	// Targets, if not empty, limits the run to the given steps and the
+	// steps they depend on. Every other step and testcase is skipped as not
+	// selected.
+	Targets []*TestStep
+
+	// StepDone, if set, is called as each step finishes so that callers can
+	// report progress while the suite is running. Calls are never made
+	// concurrently, even when testcases run in parallel.
+	StepDone func(*CaseResult, *StepResult)
+
+	// UpdateSnapshots rewrites the files of snapshots that are missing or
+	// differ rather than failing their steps, and removes stale snapshot
+	// files.
+	UpdateSnapshots bool
+
+	stepDoneMu sync.Mutex
+	snapshots  *snapshotRun
+}
+
+// notSelected is the skip reason for steps and testcases excluded by
+// Runner.Targets.
+const notSelected = "not selected"
+
+// Run executes every enabled testcase in the suite. Testcases run in
+// dependency order, and a testcase is skipped if any testcase it depends on
+// did not pass. Within a testcase steps run in dependency order; a step is
+// skipped if any step it depends on did not pass.
+func (r *Runner) Run(ctx context.Context) *SuiteResult {
+	start := time.Now()
+
+	parallel := r.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	r.snapshots = newSnapshotRun()
+	selected := r.selectedSteps()
+	pending := append([]*TestCase(nil), r.Suite.OrderedCases()...)
+	results := make(map[*TestCase]*CaseResult, len(pending))
+	done := make(chan *CaseResult)
+	running := 0
+	for len(pending) > 0 || running > 0 {
+		// Start every testcase whose dependencies have completed, in
+		// execution order, until the parallelism limit is reached.
+		waiting := pending[:0]
+		for _, tc := range pending {
+			if running >= parallel || !r.caseReady(tc, results) {
+				waiting = append(waiting, tc)
+				continue
+			}
+
+			if blocker := r.caseBlocker(tc, results); blocker != nil {
+				results[tc] = &CaseResult{
+					Case:   tc,
+					Status: StatusSkip,
+					Reason: fmt.Sprintf("dependency testcase %q did not pass", blocker.Name),
+				}
+				continue
+			}
+
+			statuses := crossStatuses(tc, results)
+			running++
+			go func(tc *TestCase) {
+				done <- r.runCase(ctx, tc, selected, statuses)
+			}(tc)
+		}
+		pending = waiting
+
+		if running > 0 {
+			cr := <-done
+			running--
+			results[cr.Case] = cr
+		}
+	}
+
+	result := &SuiteResult{
+		Suite:    r.Suite,
+		Cases:    make([]*CaseResult, 0, len(results)),
+		Duration: time.Since(start),
+	}
+	for _, tc := range r.Suite.OrderedCases() {
+		result.Cases = append(result.Cases, results[tc])
+	}
+	result.Diagnostics = r.staleSnapshots()
+	return result
+}
+
+// caseReady reports whether every testcase tc depends on has completed.
+func (r *Runner) caseReady(tc *TestCase, results map[*TestCase]*CaseResult) bool {
+	for _, dep := range r.Suite.CaseDependencies(tc) {
+		if results[dep] == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// caseBlocker returns the first testcase in tc's depends_on that did not pass,
+// or nil if tc can run. Testcases that tc only depends on through step
+// dependencies do not block it; the dependent steps are skipped instead.
+func (r *Runner) caseBlocker(tc *TestCase, results map[*TestCase]*CaseResult) *TestCase {
+	for _, ref := range tc.dependsOn {
+		dep := r.Suite.Case(ref.id)
+		if dep != nil && results[dep].Status != StatusPass {
+			return dep
+		}
+	}
+	return nil
+}
+
+// crossStatuses returns the outcome of every step in another testcase that a
+// step of tc depends on. The testcases of those steps have already completed.
+func crossStatuses(tc *TestCase, results map[*TestCase]*CaseResult) map[*TestStep]Status {
+	statuses := make(map[*TestStep]Status)
+	for _, step := range tc.TestSteps {
+		for _, dep := range step.crossDeps {
+			statuses[dep] = StatusSkip
+			for _, sr := range results[dep.testCase].Steps {
+				if sr.Step == dep {
+					statuses[dep] = sr.Status
+				}
+			}
+		}
+	}
+	return statuses
+}
+
+// selectedSteps returns the set of steps chosen by r.Targets, or nil if every
+// step should run. Every step of the testcases a target's testcase depends on
+// is selected too.
+func (r *Runner) selectedSteps() map[*TestStep]bool {
+	if len(r.Targets) == 0 {
+		return nil
+	}
+
+	selected := make(map[*TestStep]bool)
+	for _, target := range r.Targets {
+		tc := target.testCase
+		selected[target] = true
+		for _, step := range tc.Ancestors(target) {
+			selected[step] = true
+		}
+		for _, dep := range r.Suite.caseAncestors(tc) {
+			for _, step := range dep.TestSteps {
+				selected[step] = true
+			}
+		}
+	}
+	return selected
+}
+
+func (r *Runner) stepDone(cr *CaseResult, sr *StepResult) {
+	if r.StepDone == nil {
+		return
+	}
+	r.stepDoneMu.Lock()
+	defer r.stepDoneMu.Unlock()
+	r.StepDone(cr, sr)
+}
+
+// runCase runs the steps of tc. statuses holds the outcome of the steps of
+// other testcases that steps of tc depend on.
+func (r *Runner) runCase(ctx context.Context, tc *TestCase, selected map[*TestStep]bool, statuses map[*TestStep]Status) *CaseResult {
+	start := time.Now()
+	cr := &CaseResult{
+		Case:   tc,
+		Status: StatusPass,
+	}
+	defer func() {
+		cr.Duration = time.Since(start)
+	}()
+
+	if !tc.Enabled {
+		cr.Status = StatusSkip
+		cr.Reason = "testcase is disabled"
+		return cr
+	}
+
+	if selected != nil {
+		caseSelected := false
+		for _, step := range tc.TestSteps {
+			caseSelected = caseSelected || selected[step]
+		}
+		if !caseSelected {
+			cr.Status = StatusSkip
+			cr.Reason = notSelected
+			return cr
+		}
+	}
+
+	evalCtx := tc.evalContext(r.Suite.EvalContext()).NewChild()
+	evalCtx.Variables = map[string]cty.Value{}
+
+	caseFixtures := r.Suite.CaseFixtures(tc)
+	fixtures := make(map[string]cty.Value, len(caseFixtures))
+	for _, fixture := range caseFixtures {
+		val, diags := evalAttributes(expandDynamic(fixture.Config, evalCtx.Parent()), evalCtx.Parent())
+		diags = relocateJSONDiagnostics(fixture.Config, diags)
+		cr.Diagnostics = append(cr.Diagnostics, annotateIncludes(r.Suite.includedFrom, diags)...)
+		fixtures[fixture.Name] = val
+	}
+	if cr.Diagnostics.HasErrors() {
+		cr.Status = StatusFail
+		cr.Reason = "fixture evaluation failed"
+		return cr
+	}
+	evalCtx.Variables["fixture"] = cty.ObjectVal(fixtures)
+
+	outputs := make(map[string]cty.Value, len(tc.TestSteps))
+	moduleOutputs := make(map[string]cty.Value, len(tc.Modules))
+	moduleRuns := make(map[*Module]*moduleRun, len(tc.Modules))
+	for _, step := range tc.OrderedSteps() {
+		sr := &StepResult{
+			Step:    step,
+			Status:  StatusPass,
+			Outputs: cty.DynamicVal,
+		}
+
+		if selected != nil && !selected[step] {
+			sr.Status = StatusSkip
+			sr.Reason = notSelected
+		} else {
+			for _, dep := range tc.Dependencies(step) {
+				if statuses[dep.From] != StatusPass {
+					sr.Status = StatusSkip
+					sr.Reason = fmt.Sprintf("dependency %q did not pass", dep.From.id)
+					break
+				}
+			}
+		}
+		for _, dep := range step.crossDeps {
+			if sr.Status == StatusPass && statuses[dep] != StatusPass {
+				sr.Status = StatusSkip
+				sr.Reason = fmt.Sprintf("dependency %q did not pass", dep.testCase.Name+"."+dep.id)
+			}
+		}
+
+		evalCtx.Variables["step"] = cty.ObjectVal(outputs)
+		evalCtx.Variables["module"] = cty.ObjectVal(moduleOutputs)
+
+		// The steps of a module are evaluated in the module's context,
+		// which is created when the first of them runs.
+		stepCtx := evalCtx
+		var run *moduleRun
+		if m := step.module; m != nil && sr.Status == StatusPass {
+			run = moduleRuns[m]
+			if run == nil {
+				run = m.start(evalCtx.Parent(), evalCtx, tc)
+				moduleRuns[m] = run
+				sr.Diagnostics = run.diags
+			}
+			if run.diags.HasErrors() {
+				sr.Status = StatusFail
+				sr.Reason = "module evaluation failed"
+				cr.Status = StatusFail
+			}
+			stepCtx = run.ctx
+		}
+
+		if sr.Status == StatusPass {
+			stepStart := time.Now()
+			var diags hcl.Diagnostics
+			sr.Outputs, diags = stepTypes[step.Type].Run(ctx, step.expanded(stepCtx), stepCtx)
+			sr.Diagnostics = append(sr.Diagnostics, step.annotateTemplate(relocateJSONDiagnostics(step.Config, diags))...)
+			if !diags.HasErrors() {
+				sr.Diagnostics = append(sr.Diagnostics, step.annotateTemplate(r.checkSnapshots(step, stepCtx, sr.Outputs))...)
+			}
+			if run != nil && !diags.HasErrors() {
+				moduleVal, d := step.module.stepDone(run, step, sr.Outputs)
+				sr.Diagnostics = append(sr.Diagnostics, d...)
+				if moduleVal != cty.NilVal {
+					moduleOutputs[step.module.Name] = moduleVal
+				}
+			}
+			sr.Duration = time.Since(stepStart)
+			if sr.Diagnostics.HasErrors() {
+				sr.Status = StatusFail
+				cr.Status = StatusFail
+			} else {
+				outputs[step.id] = sr.Outputs
+			}
+		}
+
+		statuses[step] = sr.Status
+		cr.Steps = append(cr.Steps, sr)
+		r.stepDone(cr, sr)
+	}
+
+	return cr
+}
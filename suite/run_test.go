@@ -0,0 +1,277 @@
+package suite
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stepStatuses returns the status of every step in result, keyed by
+// case/step, with the reason for skipped steps.
+func stepStatuses(result *SuiteResult) map[string]string {
+	statuses := make(map[string]string)
+	for _, cr := range result.Cases {
+		statuses[cr.Case.Name] = cr.Status.String()
+		for _, sr := range cr.Steps {
+			status := sr.Status.String()
+			if sr.Reason != "" {
+				status += ": " + sr.Reason
+			}
+			statuses[cr.Case.Name+"/"+sr.Step.ID()] = status
+		}
+	}
+	return statuses
+}
+
+func TestRunnerSkipsDependents(t *testing.T) {
+	ts := loadSuite(t, NewLoader(), `
+suitename = "s"
+
+testcase "c" {
+  step "ok" {}
+
+  step "fail" {
+    type    = "exec"
+    command = "false"
+  }
+
+  step "child" {
+    after = ["fail"]
+  }
+
+  step "grandchild" {
+    value = step.child
+  }
+
+  step "other" {
+    after = ["ok"]
+  }
+}
+
+testcase "blocked" {
+  depends_on = ["c"]
+
+  step "a" {}
+}
+
+testcase "cross" {
+  step "a" {
+    after = ["c.child"]
+  }
+
+  step "b" {}
+}
+`)
+
+	result := (&Runner{Suite: ts}).Run(context.Background())
+	want := map[string]string{
+		"c":            "FAIL",
+		"c/ok":         "PASS",
+		"c/fail":       "FAIL",
+		"c/child":      `SKIP: dependency "fail" did not pass`,
+		"c/grandchild": `SKIP: dependency "child" did not pass`,
+		"c/other":      "PASS",
+		"blocked":      "SKIP",
+		"cross":        "PASS",
+		"cross/a":      `SKIP: dependency "c.child" did not pass`,
+		"cross/b":      "PASS",
+	}
+	if got := stepStatuses(result); !reflect.DeepEqual(got, want) {
+		t.Errorf("got statuses %v, want %v", got, want)
+	}
+	if !result.Failed() {
+		t.Error("the run did not fail")
+	}
+}
+
+func TestRunnerStepOrder(t *testing.T) {
+	ts := loadSuite(t, NewLoader(), `
+suitename = "s"
+
+testcase "c" {
+  step "c" {
+    after = ["b"]
+  }
+
+  step "b" {
+    value = step.a
+  }
+
+  step "a" {}
+}
+`)
+
+	var order []string
+	runner := &Runner{
+		Suite: ts,
+		StepDone: func(cr *CaseResult, sr *StepResult) {
+			order = append(order, sr.Step.ID())
+		},
+	}
+	runner.Run(context.Background())
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("got order %q, want %q", order, want)
+	}
+}
+
+func TestRunnerTargets(t *testing.T) {
+	ts := loadSuite(t, NewLoader(), `
+suitename = "s"
+
+testcase "setup" {
+  step "a" {}
+}
+
+testcase "c" {
+  depends_on = ["setup"]
+
+  step "a" {}
+
+  step "b" {
+    after = ["a"]
+  }
+
+  step "c" {}
+}
+
+testcase "unrelated" {
+  step "a" {}
+}
+`)
+
+	runner := &Runner{
+		Suite:   ts,
+		Targets: []*TestStep{ts.Case("c").StepMap["b"]},
+	}
+	result := runner.Run(context.Background())
+	want := map[string]string{
+		"setup":     "PASS",
+		"setup/a":   "PASS",
+		"c":         "PASS",
+		"c/a":       "PASS",
+		"c/b":       "PASS",
+		"c/c":       "SKIP: " + notSelected,
+		"unrelated": "SKIP",
+	}
+	if got := stepStatuses(result); !reflect.DeepEqual(got, want) {
+		t.Errorf("got statuses %v, want %v", got, want)
+	}
+}
+
+func TestRunnerMultipleTargets(t *testing.T) {
+	ts := loadSuite(t, NewLoader(), `
+suitename = "s"
+
+testcase "setup" {
+  step "a" {}
+}
+
+testcase "c" {
+  step "a" {}
+
+  step "b" {
+    value = step.a
+  }
+
+  step "c" {
+    after = ["setup.a"]
+  }
+
+  step "d" {}
+}
+
+testcase "other" {
+  step "a" {}
+}
+`)
+
+	c := ts.Case("c")
+	runner := &Runner{
+		Suite:   ts,
+		Targets: []*TestStep{c.StepMap["b"], c.StepMap["c"]},
+	}
+	result := runner.Run(context.Background())
+	want := map[string]string{
+		"setup":   "PASS",
+		"setup/a": "PASS",
+		"c":       "PASS",
+		"c/a":     "PASS",
+		"c/b":     "PASS",
+		"c/c":     "PASS",
+		"c/d":     "SKIP: " + notSelected,
+		"other":   "SKIP",
+	}
+	if got := stepStatuses(result); !reflect.DeepEqual(got, want) {
+		t.Errorf("got statuses %v, want %v", got, want)
+	}
+	if result.Failed() {
+		t.Error("the run failed")
+	}
+}
+
+func TestRunnerParallel(t *testing.T) {
+	ts := loadSuite(t, NewLoader(), `
+suitename = "s"
+
+testcase "first" {
+  step "sleep" {
+    type    = "exec"
+    command = "sleep"
+    args    = ["0.3"]
+  }
+}
+
+testcase "second" {
+  step "sleep" {
+    type    = "exec"
+    command = "sleep"
+    args    = ["0.3"]
+  }
+}
+
+testcase "last" {
+  depends_on = ["first", "second"]
+
+  step "a" {}
+}
+
+testcase "cross" {
+  step "a" {
+    after = ["first.sleep"]
+  }
+}
+`)
+
+	var mu sync.Mutex
+	finished := make(map[string]time.Time)
+	runner := &Runner{
+		Suite:    ts,
+		Parallel: 4,
+		StepDone: func(cr *CaseResult, sr *StepResult) {
+			mu.Lock()
+			defer mu.Unlock()
+			finished[cr.Case.Name+"/"+sr.Step.ID()] = time.Now()
+		},
+	}
+	start := time.Now()
+	result := runner.Run(context.Background())
+	if result.Failed() {
+		t.Fatalf("the run failed: %v", stepStatuses(result))
+	}
+
+	// The independent testcases run at the same time, and the dependent
+	// ones only once they have finished.
+	if elapsed := time.Since(start); elapsed > 550*time.Millisecond {
+		t.Errorf("the run took %s, so the testcases did not run in parallel", elapsed)
+	}
+	for _, dep := range []string{"first/sleep", "second/sleep"} {
+		if finished["last/a"].Before(finished[dep]) {
+			t.Errorf("last/a finished before %s", dep)
+		}
+	}
+	if finished["cross/a"].Before(finished["first/sleep"]) {
+		t.Error("cross/a finished before first/sleep")
+	}
+}
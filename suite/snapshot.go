@@ -0,0 +1,296 @@
+package suite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl2/gohcl"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// SnapshotDir is the directory, beside the file of a step, that holds the
+// files of the step's snapshots.
+const SnapshotDir = "__snapshots__"
+
+// snapshotExt is the extension of snapshot files.
+const snapshotExt = ".snap"
+
+// snapshotDiffLines is the number of lines of the diff of a mismatched
+// snapshot shown in its diagnostic. The rest are only counted, since a
+// snapshot can be large and the file can be updated to see it all.
+const snapshotDiffLines = 100
+
+var snapshotBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "name", Required: true},
+		{Name: "value", Required: true},
+	},
+}
+
+type rawSnapshot struct {
+	Config hcl.Body `hcl:",remain"`
+}
+
+// snapshot is a snapshot block of a step, which compares a value to the one
+// stored in a file once the step has run. Both expressions may refer to the
+// step's results as self.
+type snapshot struct {
+	name  hcl.Expression
+	value hcl.Expression
+	body  hcl.Body
+}
+
+func decodeSnapshots(raws []*rawSnapshot) ([]*snapshot, hcl.Diagnostics) {
+	var snapshots []*snapshot
+	var diags hcl.Diagnostics
+	for _, raw := range raws {
+		content, d := raw.Config.Content(snapshotBlockSchema)
+		diags = append(diags, relocateJSONDiagnostics(raw.Config, d)...)
+		if d.HasErrors() {
+			continue
+		}
+		snapshots = append(snapshots, &snapshot{
+			name:  content.Attributes["name"].Expr,
+			value: content.Attributes["value"].Expr,
+			body:  raw.Config,
+		})
+	}
+	return snapshots, diags
+}
+
+// snapshotRun tracks the snapshots checked during a run, so that two steps
+// checking the same file can be caught and the files no step checked can be
+// found.
+type snapshotRun struct {
+	mu      sync.Mutex
+	checked map[string]*checkedSnapshot
+	steps   map[*TestStep]bool
+
+	// named holds the file of every snapshot whose name could be
+	// evaluated, even if its value could not, and unnamed is set when a
+	// name could not be, so that no file can be taken to be stale.
+	named   map[string]bool
+	unnamed bool
+}
+
+type checkedSnapshot struct {
+	data []byte
+	step *TestStep
+}
+
+func newSnapshotRun() *snapshotRun {
+	return &snapshotRun{
+		checked: make(map[string]*checkedSnapshot),
+		steps:   make(map[*TestStep]bool),
+		named:   make(map[string]bool),
+	}
+}
+
+// checkSnapshots compares the snapshots of step, evaluated with self set to
+// the results of the step, to their files. With Runner.UpdateSnapshots the
+// files are rewritten instead.
+func (r *Runner) checkSnapshots(step *TestStep, evalCtx *hcl.EvalContext, self cty.Value) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	if len(step.snapshots) == 0 {
+		return diags
+	}
+
+	snapCtx := evalCtx.NewChild()
+	snapCtx.Variables = map[string]cty.Value{"self": self}
+
+	r.snapshots.mu.Lock()
+	defer r.snapshots.mu.Unlock()
+	r.snapshots.steps[step] = true
+
+	for _, snap := range step.snapshots {
+		d := r.checkSnapshot(step, snap, snapCtx)
+		diags = append(diags, relocateJSONDiagnostics(snap.body, d)...)
+	}
+	return diags
+}
+
+func (r *Runner) checkSnapshot(step *TestStep, snap *snapshot, snapCtx *hcl.EvalContext) hcl.Diagnostics {
+	var name string
+	diags := gohcl.DecodeExpression(snap.name, snapCtx, &name)
+	if diags.HasErrors() {
+		r.snapshots.unnamed = true
+		return diags
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid snapshot name",
+			Detail:   fmt.Sprintf("The snapshot name %q cannot be used as a file name.", name),
+			Subject:  snap.name.Range().Ptr(),
+		})
+	}
+
+	filename := filepath.Join(filepath.Dir(step.DeclRange.Filename), SnapshotDir, name+snapshotExt)
+	r.snapshots.named[filename] = true
+
+	val, d := snap.value.Value(snapCtx)
+	diags = append(diags, d...)
+	if d.HasErrors() {
+		return diags
+	}
+	data, err := snapshotData(val)
+	if err != nil {
+		return append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid snapshot value",
+			Detail:   fmt.Sprintf("The value of snapshot %q cannot be stored: %v.", name, err),
+			Subject:  snap.value.Range().Ptr(),
+		})
+	}
+
+	if prev, exists := r.snapshots.checked[filename]; exists {
+		if !bytes.Equal(prev.data, data) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Conflicting snapshot",
+				Detail:   fmt.Sprintf("Snapshot %q of step %q differs from the value step %q of testcase %q gave it. Each snapshot needs a name of its own, such as one that includes each.key.", name, step.id, prev.step.id, prev.step.testCase.Name),
+				Subject:  snap.name.Range().Ptr(),
+			})
+		}
+		return diags
+	}
+	r.snapshots.checked[filename] = &checkedSnapshot{data: data, step: step}
+
+	stored, err := ioutil.ReadFile(filename)
+	switch {
+	case err == nil && bytes.Equal(stored, data):
+		return diags
+	case r.UpdateSnapshots:
+		err = os.MkdirAll(filepath.Dir(filename), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(filename, data, 0644)
+		}
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to update snapshot",
+				Detail:   fmt.Sprintf("Snapshot %q could not be written: %v.", name, err),
+				Subject:  snap.name.Range().Ptr(),
+			})
+		}
+		return diags
+	case os.IsNotExist(err):
+		return append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Missing snapshot",
+			Detail:   fmt.Sprintf("Snapshot %q of step %q has not been recorded in %s. Run with -update to record it.", name, step.id, filename),
+			Subject:  snap.name.Range().Ptr(),
+		})
+	case err != nil:
+		return append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to read snapshot",
+			Detail:   fmt.Sprintf("Snapshot %q could not be read: %v.", name, err),
+			Subject:  snap.name.Range().Ptr(),
+		})
+	}
+
+	diff := strings.SplitAfter(strings.TrimSuffix(string(UnifiedDiff(filename, "value", stored, data)), "\n"), "\n")
+	if len(diff) > snapshotDiffLines {
+		diff = append(diff[:snapshotDiffLines], fmt.Sprintf("... %d more lines", len(diff)-snapshotDiffLines))
+	}
+	return append(diags, &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Snapshot mismatch",
+		Detail:   fmt.Sprintf("The value of snapshot %q of step %q differs from %s. Run with -update to accept it.\n\n%s", name, step.id, filename, strings.Join(diff, "")),
+		Subject:  snap.value.Range().Ptr(),
+	})
+}
+
+// snapshotData returns the content of the file of a snapshot with the given
+// value: strings as they are and anything else as indented JSON.
+func snapshotData(val cty.Value) ([]byte, error) {
+	if val.IsNull() {
+		return nil, fmt.Errorf("the value is null")
+	}
+	if !val.IsKnown() {
+		return nil, fmt.Errorf("the value is not known")
+	}
+	if val.Type() == cty.String {
+		return []byte(val.AsString()), nil
+	}
+
+	v, err := plainValue(val)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// staleSnapshots returns a warning for every snapshot file beside the
+// suite's steps that no snapshot block named, removing the files with
+// Runner.UpdateSnapshots. Files are only stale if every step with snapshots
+// ran, since otherwise their steps may just not have been checked.
+func (r *Runner) staleSnapshots() hcl.Diagnostics {
+	if len(r.Targets) > 0 || len(r.Suite.filteredCases) > 0 || r.snapshots.unnamed {
+		return nil
+	}
+
+	dirs := make(map[string]bool)
+	for _, tc := range r.Suite.TestCases {
+		if len(tc.filteredSteps) > 0 {
+			return nil
+		}
+		for _, step := range tc.TestSteps {
+			if len(step.snapshots) > 0 && !r.snapshots.steps[step] {
+				return nil
+			}
+			dirs[filepath.Join(filepath.Dir(step.DeclRange.Filename), SnapshotDir)] = true
+		}
+	}
+
+	var stale []string
+	for dir := range dirs {
+		files, _ := ioutil.ReadDir(dir)
+		for _, file := range files {
+			filename := filepath.Join(dir, file.Name())
+			if !file.IsDir() && filepath.Ext(filename) == snapshotExt && !r.snapshots.named[filename] {
+				stale = append(stale, filename)
+			}
+		}
+	}
+	sort.Strings(stale)
+
+	var diags hcl.Diagnostics
+	for _, filename := range stale {
+		if !r.UpdateSnapshots {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagWarning,
+				Summary:  "Stale snapshot",
+				Detail:   fmt.Sprintf("No snapshot block names %s. Run with -update to remove it.", filename),
+			})
+			continue
+		}
+		if err := os.Remove(filename); err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagWarning,
+				Summary:  "Failed to remove stale snapshot",
+				Detail:   fmt.Sprintf("No snapshot block names %s, but it could not be removed: %v.", filename, err),
+			})
+			continue
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagWarning,
+			Summary:  "Removed stale snapshot",
+			Detail:   fmt.Sprintf("No snapshot block names %s, so it was removed.", filename),
+		})
+	}
+	return diags
+}
@@ -0,0 +1,192 @@
+package suite
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// runSnapshot runs a suite with a step whose snapshot "out" has the value
+// text, against the snapshot file stored, and returns the step's result. The
+// snapshot file is not written if stored is empty.
+func runSnapshot(t *testing.T, stored, text string, update bool) (*StepResult, string) {
+	t.Helper()
+	dir := writeSuite(t, map[string]string{"suite.hcl": `
+suitename = "s"
+
+variable "text" {
+  default = ""
+}
+
+testcase "c" {
+  step "a" {
+    snapshot {
+      name  = "out"
+      value = text
+    }
+  }
+}
+`})
+	filename := filepath.Join(dir, SnapshotDir, "out"+snapshotExt)
+	if stored != "" {
+		if err := os.Mkdir(filepath.Join(dir, SnapshotDir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(stored), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l := NewLoader()
+	l.SetVariable("text", cty.StringVal(text))
+	ts, diags := l.Load(dir)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %s", diags.Error())
+	}
+	result := (&Runner{Suite: ts, UpdateSnapshots: update}).Run(context.Background())
+	return result.Cases[0].Steps[0], filename
+}
+
+func TestSnapshot(t *testing.T) {
+	sr, _ := runSnapshot(t, "a\nb\n", "a\nb\n", false)
+	if sr.Status != StatusPass {
+		t.Errorf("a matching snapshot failed: %s", sr.Diagnostics.Error())
+	}
+
+	sr, _ = runSnapshot(t, "", "a\n", false)
+	if got := diagSummaries(sr.Diagnostics); len(got) != 1 || got[0] != "Missing snapshot" {
+		t.Errorf("got errors %q for a missing snapshot", got)
+	}
+
+	sr, _ = runSnapshot(t, "a\nb\n", "a\nc\n", false)
+	if got := diagSummaries(sr.Diagnostics); len(got) != 1 || got[0] != "Snapshot mismatch" {
+		t.Fatalf("got errors %q for a mismatched snapshot", got)
+	}
+	if detail := sr.Diagnostics[0].Detail; !strings.HasSuffix(detail, "+++ value\n@@ -1,2 +1,2 @@\n a\n-b\n+c") {
+		t.Errorf("unexpected mismatch detail %q", detail)
+	}
+
+	sr, filename := runSnapshot(t, "a\nb\n", "a\nc\n", true)
+	if sr.Status != StatusPass {
+		t.Errorf("updating a snapshot failed: %s", sr.Diagnostics.Error())
+	}
+	if data, _ := ioutil.ReadFile(filename); string(data) != "a\nc\n" {
+		t.Errorf("the snapshot was updated to %q", data)
+	}
+}
+
+func TestSnapshotLargeMismatch(t *testing.T) {
+	var stored, text strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&stored, "old line %d\n", i)
+		fmt.Fprintf(&text, "new line %d\n", i)
+	}
+
+	start := time.Now()
+	sr, _ := runSnapshot(t, stored.String(), text.String(), false)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("checking the snapshot took %s", elapsed)
+	}
+	if got := diagSummaries(sr.Diagnostics); len(got) != 1 || got[0] != "Snapshot mismatch" {
+		t.Fatalf("got errors %q for a mismatched snapshot", got)
+	}
+
+	// The diff has a header of 3 lines and a line for each of the 40000
+	// changed lines, of which the first 100 are shown.
+	detail := sr.Diagnostics[0].Detail
+	if !strings.HasSuffix(detail, "\n... 39903 more lines") {
+		t.Errorf("the diff was not cut off: %q", detail[len(detail)-100:])
+	}
+	if lines := strings.Count(detail, "\n"); lines > snapshotDiffLines+5 {
+		t.Errorf("the detail has %d lines", lines)
+	}
+}
+
+func TestStaleSnapshots(t *testing.T) {
+	tests := []struct {
+		name string
+
+		// snapName and value are the expressions of a snapshot block
+		// whose name is "out" when it can be evaluated, and want holds
+		// the summaries of the warnings of the runs without and with
+		// -update. stale lists the snapshot files that should be gone
+		// after the run with -update.
+		snapName, value string
+		want            []string
+		stale           []string
+	}{
+		{
+			name:     "stale file",
+			snapName: `"out"`,
+			value:    `"a\n"`,
+			want:     []string{"Stale snapshot", "Removed stale snapshot"},
+			stale:    []string{"old"},
+		},
+		{
+			name:     "value with errors",
+			snapName: `"out"`,
+			value:    "self.nothere",
+			want:     []string{"Stale snapshot", "Removed stale snapshot"},
+			stale:    []string{"old"},
+		},
+		{
+			name:     "name with errors",
+			snapName: "self.nothere",
+			value:    `"a\n"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := writeSuite(t, map[string]string{
+				"suite.hcl": `
+suitename = "s"
+
+testcase "c" {
+  step "a" {
+    snapshot {
+      name  = ` + test.snapName + `
+      value = ` + test.value + `
+    }
+  }
+}
+`,
+				filepath.Join(SnapshotDir, "out"+snapshotExt): "a\n",
+				filepath.Join(SnapshotDir, "old"+snapshotExt): "old\n",
+			})
+
+			var got []string
+			for _, update := range []bool{false, true} {
+				ts, diags := NewLoader().Load(dir)
+				if diags.HasErrors() {
+					t.Fatal(diags.Error())
+				}
+				result := (&Runner{Suite: ts, UpdateSnapshots: update}).Run(context.Background())
+				for _, diag := range result.Diagnostics {
+					got = append(got, diag.Summary)
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got warnings %q, want %q", got, test.want)
+			}
+
+			var gone []string
+			for _, name := range []string{"out", "old"} {
+				if _, err := os.Stat(filepath.Join(dir, SnapshotDir, name+snapshotExt)); os.IsNotExist(err) {
+					gone = append(gone, name)
+				}
+			}
+			if !reflect.DeepEqual(gone, test.stale) {
+				t.Errorf("the snapshots %q were removed, want %q", gone, test.stale)
+			}
+		})
+	}
+}
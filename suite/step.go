@@ -0,0 +1,173 @@
+package suite
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/hashicorp/hcl2/gohcl"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// StepType implements the behaviour of one kind of step, selected with the
+// step's type attribute.
+type StepType interface {
+	// Schema returns the schema of the step's Config body, which is
+	// enforced by strict mode. A nil schema means the body holds
+	// free-form attributes.
+	Schema() *hcl.BodySchema
+
+	// Run executes the step. The step's Config body is decoded with the
+	// given evaluation context, and the returned value is made available
+	// to later steps as step.<id>. Error diagnostics fail the step.
+	Run(ctx context.Context, step *TestStep, evalCtx *hcl.EvalContext) (cty.Value, hcl.Diagnostics)
+}
+
+// selfAttributer is implemented by step types that evaluate attributes of
+// their own, besides assert blocks, with the step's results as self.
+type selfAttributer interface {
+	selfAttributes() []string
+}
+
+var stepTypes = map[string]StepType{
+	"exec": execStep{},
+	"file": fileStep{},
+	"http": httpStep{},
+	"noop": noopStep{},
+	"ssh":  sshStep{},
+	"wait": waitStep{},
+}
+
+// StepSchema returns the schema of the Config body of steps of the named
+// type, or nil if the type is unknown or its steps are free-form.
+func StepSchema(typeName string) *hcl.BodySchema {
+	if stepType, ok := stepTypes[typeName]; ok {
+		return stepType.Schema()
+	}
+	return nil
+}
+
+// StepTypeNames returns the names of the supported step types in lexical
+// order.
+func StepTypeNames() []string {
+	names := make([]string, 0, len(stepTypes))
+	for name := range stepTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolvePath returns path relative to dir unless it is absolute.
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// noopStep evaluates every attribute of the step and does nothing else. The
+// evaluated attributes are the step's results.
+type noopStep struct{}
+
+func (noopStep) Schema() *hcl.BodySchema {
+	return nil
+}
+
+func (noopStep) Run(ctx context.Context, step *TestStep, evalCtx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	return evalAttributes(step.Config, evalCtx)
+}
+
+// evalAttributes evaluates every attribute in body and returns them as an
+// object. The nested blocks of each type become a list of objects under the
+// type's name, each evaluated the same way.
+func evalAttributes(body hcl.Body, evalCtx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	content, diags := freeFormContent(body)
+	if diags.HasErrors() {
+		return cty.DynamicVal, diags
+	}
+
+	vals := make(map[string]cty.Value, len(content.Attributes))
+	for name, attr := range content.Attributes {
+		val, d := attr.Expr.Value(evalCtx)
+		diags = append(diags, d...)
+		vals[name] = val
+	}
+
+	blocks := make(map[string][]cty.Value)
+	for _, block := range content.Blocks {
+		val, d := evalAttributes(block.Body, evalCtx)
+		diags = append(diags, d...)
+		blocks[block.Type] = append(blocks[block.Type], val)
+	}
+	for blockType, list := range blocks {
+		vals[blockType] = cty.TupleVal(list)
+	}
+
+	return cty.ObjectVal(vals), diags
+}
+
+// stepAssert is an assert block of a step, which is checked once the step
+// has run, with the step's results available as self.
+type stepAssert struct {
+	Condition    hcl.Expression `hcl:"condition,attr"`
+	ErrorMessage hcl.Expression `hcl:"error_message,attr"`
+}
+
+// checkAsserts evaluates the conditions of asserts with self set to the
+// results of step, and reports each one that does not hold.
+func checkAsserts(asserts []*stepAssert, step *TestStep, evalCtx *hcl.EvalContext, self cty.Value) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	if len(asserts) == 0 {
+		return diags
+	}
+
+	assertCtx := evalCtx.NewChild()
+	assertCtx.Variables = map[string]cty.Value{"self": self}
+
+	for _, assert := range asserts {
+		val, d := assert.Condition.Value(assertCtx)
+		diags = append(diags, d...)
+		if d.HasErrors() {
+			continue
+		}
+
+		val, err := convert.Convert(val, cty.Bool)
+		if err != nil || val.IsNull() || !val.IsKnown() {
+			detail := "The condition must be true or false."
+			if err != nil {
+				detail = fmt.Sprintf("The condition must be true or false: %s.", err)
+			}
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid assert condition",
+				Detail:   detail,
+				Subject:  assert.Condition.Range().Ptr(),
+			})
+			continue
+		}
+		if val.True() {
+			continue
+		}
+
+		detail := fmt.Sprintf("An assertion of step %q does not hold.", step.id)
+		if msgVal, _ := assert.ErrorMessage.Value(assertCtx); !msgVal.IsNull() {
+			var msg string
+			d = gohcl.DecodeExpression(assert.ErrorMessage, assertCtx, &msg)
+			diags = append(diags, d...)
+			if msg != "" {
+				detail = fmt.Sprintf("An assertion of step %q does not hold: %s", step.id, msg)
+			}
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Assertion failed",
+			Detail:   detail,
+			Subject:  assert.Condition.Range().Ptr(),
+		})
+	}
+	return diags
+}
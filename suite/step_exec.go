@@ -0,0 +1,113 @@
+package suite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl2/gohcl"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// execStep runs a local command. Its results are the exit status and the
+// captured output of the command.
+type execStep struct{}
+
+type execStepConfig struct {
+	Command    string             `hcl:"command,attr"`
+	Args       *[]string          `hcl:"args,attr"`
+	Env        *map[string]string `hcl:"env,attr"`
+	Dir        *string            `hcl:"dir,attr"`
+	Stdin      *string            `hcl:"stdin,attr"`
+	ExpectExit *int               `hcl:"expect_exit,attr"`
+}
+
+func (execStep) Schema() *hcl.BodySchema {
+	schema, _ := gohcl.ImpliedBodySchema(&execStepConfig{})
+	return schema
+}
+
+func (execStep) Run(ctx context.Context, step *TestStep, evalCtx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	cfg := execStepConfig{}
+	diags := gohcl.DecodeBody(step.Config, evalCtx, &cfg)
+	if diags.HasErrors() {
+		return cty.DynamicVal, diags
+	}
+
+	var args []string
+	if cfg.Args != nil {
+		args = *cfg.Args
+	}
+
+	cmd := exec.CommandContext(ctx, cfg.Command, args...)
+	cmd.Dir = filepath.Dir(step.DeclRange.Filename)
+	if cfg.Dir != nil {
+		if filepath.IsAbs(*cfg.Dir) {
+			cmd.Dir = *cfg.Dir
+		} else {
+			cmd.Dir = filepath.Join(cmd.Dir, *cfg.Dir)
+		}
+	}
+	if cfg.Env != nil {
+		cmd.Env = os.Environ()
+		keys := make([]string, 0, len(*cfg.Env))
+		for k := range *cfg.Env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			cmd.Env = append(cmd.Env, k+"="+(*cfg.Env)[k])
+		}
+	}
+	if cfg.Stdin != nil {
+		cmd.Stdin = strings.NewReader(*cfg.Stdin)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	exitStatus := 0
+	if err := cmd.Run(); err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to run command",
+				Detail:   fmt.Sprintf("Step %q could not run %q: %v.", step.id, cfg.Command, err),
+				Subject:  step.DeclRange.Ptr(),
+			})
+			return cty.DynamicVal, diags
+		}
+		exitStatus = exitErr.ExitCode()
+	}
+
+	expectExit := 0
+	if cfg.ExpectExit != nil {
+		expectExit = *cfg.ExpectExit
+	}
+	if exitStatus != expectExit {
+		detail := fmt.Sprintf("Step %q expected %q to exit with status %d, but it exited with status %d.", step.id, cfg.Command, expectExit, exitStatus)
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			detail += "\n\nstderr:\n" + msg
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Unexpected exit status",
+			Detail:   detail,
+			Subject:  step.DeclRange.Ptr(),
+		})
+	}
+
+	return cty.ObjectVal(map[string]cty.Value{
+		"exit_status": cty.NumberIntVal(int64(exitStatus)),
+		"stdout":      cty.StringVal(stdout.String()),
+		"stderr":      cty.StringVal(stderr.String()),
+	}), diags
+}
@@ -0,0 +1,361 @@
+package suite
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl2/gohcl"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	hcljson "github.com/hashicorp/hcl2/hcl/json"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// fileStep checks a file or directory produced by earlier steps. Each check
+// that is set must hold, and its diagnostics point at the expected value. The
+// results describe the file as found.
+type fileStep struct{}
+
+type fileStepConfig struct {
+	Path      string         `hcl:"path,attr"`
+	Exists    hcl.Expression `hcl:"exists,attr"`
+	Directory hcl.Expression `hcl:"directory,attr"`
+	Mode      hcl.Expression `hcl:"mode,attr"`
+	Size      hcl.Expression `hcl:"size,attr"`
+	Content   hcl.Expression `hcl:"content,attr"`
+	Matches   hcl.Expression `hcl:"matches,attr"`
+	JSON      hcl.Expression `hcl:"json,attr"`
+	HCL       hcl.Expression `hcl:"hcl,attr"`
+	MD5       hcl.Expression `hcl:"md5,attr"`
+	SHA256    hcl.Expression `hcl:"sha256,attr"`
+	Asserts   []*stepAssert  `hcl:"assert,block"`
+}
+
+func (fileStep) Schema() *hcl.BodySchema {
+	schema, _ := gohcl.ImpliedBodySchema(&fileStepConfig{})
+	return schema
+}
+
+func (fileStep) Run(ctx context.Context, step *TestStep, evalCtx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	cfg := fileStepConfig{}
+	diags := gohcl.DecodeBody(step.Config, evalCtx, &cfg)
+	if diags.HasErrors() {
+		return cty.DynamicVal, diags
+	}
+
+	check := &fileCheck{
+		step:    step,
+		path:    cfg.Path,
+		evalCtx: evalCtx,
+	}
+	check.load(resolvePath(filepath.Dir(step.DeclRange.Filename), cfg.Path))
+	if check.err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to read file",
+			Detail:   fmt.Sprintf("Step %q could not read %s: %v.", step.id, cfg.Path, check.err),
+			Subject:  step.DeclRange.Ptr(),
+		})
+		return cty.DynamicVal, diags
+	}
+
+	exists := true
+	if !check.decode(cfg.Exists, &exists) {
+		exists = true
+	}
+	switch {
+	case exists && check.info == nil:
+		check.diags = append(check.diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "File does not exist",
+			Detail:   fmt.Sprintf("Step %q expected %s to exist, but it does not.", step.id, cfg.Path),
+			Subject:  step.DeclRange.Ptr(),
+		})
+	case !exists && check.info != nil:
+		check.fail(cfg.Exists, "File exists", "not to exist, but it does")
+	case exists:
+		check.checkAll(&cfg)
+	}
+
+	result := check.result()
+	diags = append(diags, check.diags...)
+	diags = append(diags, checkAsserts(cfg.Asserts, step, evalCtx, result)...)
+	return result, diags
+}
+
+// fileCheck holds a file and the diagnostics of the checks made of it.
+type fileCheck struct {
+	step    *TestStep
+	path    string
+	evalCtx *hcl.EvalContext
+
+	// info is nil if the file does not exist. data is the content of a
+	// regular file, and entries the names in a directory.
+	info    os.FileInfo
+	data    []byte
+	entries []string
+	err     error
+
+	diags hcl.Diagnostics
+}
+
+func (c *fileCheck) load(filename string) {
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		c.err = err
+		return
+	}
+	c.info = info
+
+	if info.IsDir() {
+		files, err := ioutil.ReadDir(filename)
+		if err != nil {
+			c.err = err
+			return
+		}
+		c.entries = make([]string, 0, len(files))
+		for _, file := range files {
+			c.entries = append(c.entries, file.Name())
+		}
+		sort.Strings(c.entries)
+		return
+	}
+	c.data, c.err = ioutil.ReadFile(filename)
+}
+
+// result returns the results of the step: whether the file exists and, if it
+// does, its type, size, mode and either its content and SHA-256 checksum or
+// its entries.
+func (c *fileCheck) result() cty.Value {
+	vals := map[string]cty.Value{
+		"exists":    cty.BoolVal(c.info != nil),
+		"directory": cty.NullVal(cty.Bool),
+		"size":      cty.NullVal(cty.Number),
+		"mode":      cty.NullVal(cty.String),
+		"content":   cty.NullVal(cty.String),
+		"sha256":    cty.NullVal(cty.String),
+		"entries":   cty.NullVal(cty.List(cty.String)),
+	}
+	if c.info == nil {
+		return cty.ObjectVal(vals)
+	}
+
+	vals["directory"] = cty.BoolVal(c.info.IsDir())
+	vals["size"] = cty.NumberIntVal(c.info.Size())
+	vals["mode"] = cty.StringVal(fmt.Sprintf("%04o", c.info.Mode().Perm()))
+	if c.info.IsDir() {
+		entries := make([]cty.Value, len(c.entries))
+		for i, name := range c.entries {
+			entries[i] = cty.StringVal(name)
+		}
+		vals["entries"] = cty.ListValEmpty(cty.String)
+		if len(entries) > 0 {
+			vals["entries"] = cty.ListVal(entries)
+		}
+	} else {
+		sum := sha256.Sum256(c.data)
+		vals["content"] = cty.StringVal(string(c.data))
+		vals["sha256"] = cty.StringVal(hex.EncodeToString(sum[:]))
+	}
+	return cty.ObjectVal(vals)
+}
+
+// checkAll makes the checks of cfg other than exists of the file, which
+// must exist.
+func (c *fileCheck) checkAll(cfg *fileStepConfig) {
+	var directory bool
+	if c.decode(cfg.Directory, &directory) && directory != c.info.IsDir() {
+		if directory {
+			c.fail(cfg.Directory, "Not a directory", "to be a directory, but it is a file")
+		} else {
+			c.fail(cfg.Directory, "Not a file", "to be a file, but it is a directory")
+		}
+	}
+
+	var mode string
+	if c.decode(cfg.Mode, &mode) {
+		perm, err := strconv.ParseUint(mode, 8, 32)
+		switch {
+		case err != nil || perm > 0777:
+			c.diags = append(c.diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid file mode",
+				Detail:   fmt.Sprintf("The mode must be a string of octal permission bits, such as \"0644\", not %q.", mode),
+				Subject:  cfg.Mode.Range().Ptr(),
+			})
+		case os.FileMode(perm) != c.info.Mode().Perm():
+			c.fail(cfg.Mode, "Unexpected file mode", fmt.Sprintf("to have mode %04o, but it has mode %04o", perm, c.info.Mode().Perm()))
+		}
+	}
+
+	var size int64
+	if c.decode(cfg.Size, &size) && size != c.info.Size() {
+		c.fail(cfg.Size, "Unexpected file size", fmt.Sprintf("to be %d bytes, but it is %d bytes", size, c.info.Size()))
+	}
+
+	var content string
+	if c.decode(cfg.Content, &content) && c.regular(cfg.Content) && content != string(c.data) {
+		diag := c.failure(cfg.Content, "Unexpected file content", "to have the expected content, but it differs")
+		diag.Detail += "\n\n" + strings.TrimSuffix(string(UnifiedDiff("expected", cfg.Path, []byte(content), c.data)), "\n")
+		c.diags = append(c.diags, diag)
+	}
+
+	var pattern string
+	if c.decode(cfg.Matches, &pattern) && c.regular(cfg.Matches) {
+		re, err := regexp.Compile(pattern)
+		switch {
+		case err != nil:
+			c.diags = append(c.diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid regular expression",
+				Detail:   fmt.Sprintf("The pattern %q is not a valid regular expression: %v.", pattern, err),
+				Subject:  cfg.Matches.Range().Ptr(),
+			})
+		case !re.Match(c.data):
+			c.fail(cfg.Matches, "Unexpected file content", fmt.Sprintf("to match %q, but it does not", pattern))
+		}
+	}
+
+	c.structure(cfg.JSON, "JSON", c.jsonValue)
+	c.structure(cfg.HCL, "HCL", c.hclValue)
+	c.checksum(cfg.MD5, "MD5", md5.New())
+	c.checksum(cfg.SHA256, "SHA-256", sha256.New())
+}
+
+// decode decodes expr into target and reports whether the check it expresses
+// is set. Attributes that are absent or null are not.
+func (c *fileCheck) decode(expr hcl.Expression, target interface{}) bool {
+	if val, _ := expr.Value(c.evalCtx); val.IsNull() {
+		return false
+	}
+	diags := gohcl.DecodeExpression(expr, c.evalCtx, target)
+	c.diags = append(c.diags, diags...)
+	return !diags.HasErrors()
+}
+
+// regular reports whether the file is a regular file, as the check expressed
+// by expr requires.
+func (c *fileCheck) regular(expr hcl.Expression) bool {
+	if !c.info.IsDir() {
+		return true
+	}
+	c.fail(expr, "Not a file", "to be a file, but it is a directory")
+	return false
+}
+
+func (c *fileCheck) fail(expr hcl.Expression, summary, expected string) {
+	c.diags = append(c.diags, c.failure(expr, summary, expected))
+}
+
+func (c *fileCheck) failure(expr hcl.Expression, summary, expected string) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  summary,
+		Detail:   fmt.Sprintf("Step %q expected %s %s.", c.step.id, c.path, expected),
+		Subject:  expr.Range().Ptr(),
+	}
+}
+
+// structure checks that the file, decoded by decode, is structurally equal
+// to the value of expr. Both are compared in their JSON form, so object
+// attributes may be in any order and numbers need only have the same value.
+func (c *fileCheck) structure(expr hcl.Expression, format string, decode func() (interface{}, error)) {
+	val, diags := expr.Value(c.evalCtx)
+	c.diags = append(c.diags, diags...)
+	if diags.HasErrors() || val.IsNull() || !c.regular(expr) {
+		return
+	}
+
+	expected, err := plainValue(val)
+	if err != nil {
+		c.diags = append(c.diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s value", format),
+			Detail:   fmt.Sprintf("The expected value cannot be compared: %v.", err),
+			Subject:  expr.Range().Ptr(),
+		})
+		return
+	}
+	actual, err := decode()
+	if err != nil {
+		c.fail(expr, fmt.Sprintf("Invalid %s file", format), fmt.Sprintf("to be valid %s, but it is not: %v", format, err))
+		return
+	}
+	if reflect.DeepEqual(expected, actual) {
+		return
+	}
+
+	expectedJSON, _ := json.MarshalIndent(expected, "", "  ")
+	actualJSON, _ := json.MarshalIndent(actual, "", "  ")
+	diag := c.failure(expr, fmt.Sprintf("Unexpected %s content", format), fmt.Sprintf("to be equal to the expected %s value, but it differs", format))
+	diag.Detail += "\n\n" + strings.TrimSuffix(string(UnifiedDiff("expected", c.path, append(expectedJSON, '\n'), append(actualJSON, '\n'))), "\n")
+	c.diags = append(c.diags, diag)
+}
+
+func (c *fileCheck) jsonValue() (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal(c.data, &v)
+	return v, err
+}
+
+// hclValue evaluates the attributes of the file without variables. Nested
+// blocks become lists of objects, as in the results of noop steps.
+func (c *fileCheck) hclValue() (interface{}, error) {
+	var file *hcl.File
+	var diags hcl.Diagnostics
+	if IsJSONFile(c.path) {
+		file, diags = hcljson.Parse(c.data, c.path)
+	} else {
+		file, diags = hclsyntax.ParseConfig(c.data, c.path, hcl.Pos{Line: 1, Column: 1})
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	val, diags := evalAttributes(file.Body, nil)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return plainValue(val)
+}
+
+// checksum checks that the hex digest of the file computed by h is the
+// value of expr, ignoring case.
+func (c *fileCheck) checksum(expr hcl.Expression, name string, h hash.Hash) {
+	var expected string
+	if !c.decode(expr, &expected) || !c.regular(expr) {
+		return
+	}
+	h.Write(c.data)
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, expected) {
+		c.fail(expr, "Unexpected checksum", fmt.Sprintf("to have %s checksum %s, but it has %s", name, expected, sum))
+	}
+}
+
+// plainValue converts val to the Go values encoding/json decodes the same
+// JSON into.
+func plainValue(val cty.Value) (interface{}, error) {
+	buf, err := ctyjson.Marshal(val, val.Type())
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	err = json.Unmarshal(buf, &v)
+	return v, err
+}
@@ -0,0 +1,92 @@
+package suite
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFileStep(t *testing.T) {
+	dir := writeSuite(t, map[string]string{
+		"out.txt":  "hello\n",
+		"out.json": `{"a": 1}`,
+	})
+
+	tests := []struct {
+		name string
+		step string
+
+		// want holds the summaries of the expected errors.
+		want []string
+	}{
+		{
+			name: "content",
+			step: `
+    path    = "${base}/out.txt"
+    content = "hello\n"
+    size    = 6
+`,
+		},
+		{
+			name: "failed checks",
+			step: `
+    path      = "${base}/out.txt"
+    directory = true
+    content   = "bye\n"
+    matches   = "^bye"
+`,
+			want: []string{"Not a directory", "Unexpected file content", "Unexpected file content"},
+		},
+		{
+			name: "json",
+			step: `
+    path = "${base}/out.json"
+    json = { a = 1 }
+`,
+		},
+		{
+			name: "missing",
+			step: `
+    path = "${base}/missing.txt"
+
+    assert {
+      condition = self.exists
+    }
+`,
+			want: []string{"File does not exist", "Assertion failed"},
+		},
+		{
+			name: "expected missing",
+			step: `
+    path   = "${base}/missing.txt"
+    exists = false
+
+    assert {
+      condition = !self.exists
+    }
+`,
+		},
+		{
+			name: "unexpected file",
+			step: `
+    path   = "${base}/out.txt"
+    exists = false
+
+    assert {
+      condition     = self.content == "bye\n"
+      error_message = "The file says ${self.content}"
+    }
+`,
+			want: []string{"File exists", "Assertion failed"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			steps := "  step \"f\" {\n    type = \"file\"\n" + test.step + "  }\n"
+			sr := runSuiteStep(t, dir, steps, "f")
+			if got := diagSummaries(sr.Diagnostics); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got errors %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package suite
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl2/gohcl"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// httpStep sends an HTTP request. Its results are the status, headers and
+// body of the response, and the body decoded as JSON when it is valid JSON.
+type httpStep struct{}
+
+type httpStepConfig struct {
+	Method       *string            `hcl:"method,attr"`
+	URL          string             `hcl:"url,attr"`
+	Headers      *map[string]string `hcl:"headers,attr"`
+	Body         *string            `hcl:"body,attr"`
+	JSONBody     hcl.Expression     `hcl:"json_body,attr"`
+	ExpectStatus *int               `hcl:"expect_status,attr"`
+	Timeout      *hcl.Attribute     `hcl:"timeout,attr"`
+	Asserts      []*stepAssert      `hcl:"assert,block"`
+}
+
+// defaultHTTPTimeout bounds a request whose step sets no timeout, so that a
+// server that never responds cannot hang the run.
+const defaultHTTPTimeout = 30 * time.Second
+
+func (httpStep) Schema() *hcl.BodySchema {
+	schema, _ := gohcl.ImpliedBodySchema(&httpStepConfig{})
+	return schema
+}
+
+func (httpStep) Run(ctx context.Context, step *TestStep, evalCtx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	cfg := httpStepConfig{}
+	diags := gohcl.DecodeBody(step.Config, evalCtx, &cfg)
+	if diags.HasErrors() {
+		return cty.DynamicVal, diags
+	}
+
+	timeout, d := decodeDuration(cfg.Timeout, evalCtx, defaultHTTPTimeout)
+	diags = append(diags, d...)
+	if d.HasErrors() {
+		return cty.DynamicVal, diags
+	}
+
+	method := http.MethodGet
+	if cfg.Method != nil {
+		method = strings.ToUpper(*cfg.Method)
+	}
+
+	var body io.Reader
+	jsonBody, d := cfg.JSONBody.Value(evalCtx)
+	diags = append(diags, d...)
+	if d.HasErrors() {
+		return cty.DynamicVal, diags
+	}
+	switch {
+	case !jsonBody.IsNull() && cfg.Body != nil:
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Conflicting request body",
+			Detail:   "Only one of body and json_body may be set.",
+			Subject:  cfg.JSONBody.Range().Ptr(),
+		})
+		return cty.DynamicVal, diags
+	case !jsonBody.IsNull():
+		buf, err := ctyjson.Marshal(jsonBody, jsonBody.Type())
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid json_body value",
+				Detail:   fmt.Sprintf("The request body cannot be encoded as JSON: %v.", err),
+				Subject:  cfg.JSONBody.Range().Ptr(),
+			})
+			return cty.DynamicVal, diags
+		}
+		body = strings.NewReader(string(buf))
+	case cfg.Body != nil:
+		body = strings.NewReader(*cfg.Body)
+	}
+
+	req, err := http.NewRequest(method, cfg.URL, body)
+	if err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid request",
+			Detail:   fmt.Sprintf("Step %q could not build the request: %v.", step.id, err),
+			Subject:  step.DeclRange.Ptr(),
+		})
+		return cty.DynamicVal, diags
+	}
+	req = req.WithContext(ctx)
+	if !jsonBody.IsNull() {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if cfg.Headers != nil {
+		for k, v := range *cfg.Headers {
+			req.Header.Set(k, v)
+		}
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to send request",
+			Detail:   fmt.Sprintf("Step %q could not send %s %s: %v.", step.id, method, cfg.URL, err),
+			Subject:  step.DeclRange.Ptr(),
+		})
+		return cty.DynamicVal, diags
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to read response",
+			Detail:   fmt.Sprintf("Step %q could not read the response to %s %s: %v.", step.id, method, cfg.URL, err),
+			Subject:  step.DeclRange.Ptr(),
+		})
+		return cty.DynamicVal, diags
+	}
+
+	result := cty.ObjectVal(map[string]cty.Value{
+		"status":  cty.NumberIntVal(int64(resp.StatusCode)),
+		"headers": responseHeaders(resp.Header),
+		"body":    cty.StringVal(string(respBody)),
+		"json":    decodeJSONBody(respBody),
+	})
+
+	// Without expect_status any successful status will do.
+	statusOK := resp.StatusCode >= 200 && resp.StatusCode < 300
+	expected := "a 2xx status"
+	if cfg.ExpectStatus != nil {
+		statusOK = resp.StatusCode == *cfg.ExpectStatus
+		expected = fmt.Sprintf("status %d", *cfg.ExpectStatus)
+	}
+	if !statusOK {
+		detail := fmt.Sprintf("Step %q expected %s %s to respond with %s, but it responded with status %d.", step.id, method, cfg.URL, expected, resp.StatusCode)
+		if msg := strings.TrimSpace(string(respBody)); msg != "" {
+			detail += "\n\nbody:\n" + msg
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Unexpected status",
+			Detail:   detail,
+			Subject:  step.DeclRange.Ptr(),
+		})
+	}
+
+	diags = append(diags, checkAsserts(cfg.Asserts, step, evalCtx, result)...)
+	return result, diags
+}
+
+// responseHeaders returns the headers of a response as a map keyed by their
+// canonical names, such as Content-Type. Repeated headers are joined with
+// commas.
+func responseHeaders(header http.Header) cty.Value {
+	if len(header) == 0 {
+		return cty.MapValEmpty(cty.String)
+	}
+	vals := make(map[string]cty.Value, len(header))
+	for name, values := range header {
+		vals[name] = cty.StringVal(strings.Join(values, ", "))
+	}
+	return cty.MapVal(vals)
+}
+
+// decodeJSONBody returns the value of a JSON response body, or null if the
+// body is not valid JSON.
+func decodeJSONBody(body []byte) cty.Value {
+	ty, err := ctyjson.ImpliedType(body)
+	if err != nil {
+		return cty.NullVal(cty.DynamicPseudoType)
+	}
+	val, err := ctyjson.Unmarshal(body, ty)
+	if err != nil {
+		return cty.NullVal(cty.DynamicPseudoType)
+	}
+	return val
+}
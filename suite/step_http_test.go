@@ -0,0 +1,266 @@
+package suite
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// runSuiteStep loads a suite holding a testcase with the given steps, with
+// the variable base set to base, runs it and returns the result of the step
+// with the given id.
+func runSuiteStep(t *testing.T, base, steps, id string) *StepResult {
+	t.Helper()
+	src := "suitename = \"s\"\n\nvariable \"base\" {\n  default = \"\"\n}\n\ntestcase \"c\" {\n" + steps + "}\n"
+	l := NewLoader()
+	l.SetVariable("base", cty.StringVal(base))
+	ts := loadSuite(t, l, src)
+
+	result := (&Runner{Suite: ts}).Run(context.Background())
+	for _, sr := range result.Cases[0].Steps {
+		if sr.Step.ID() == id {
+			return sr
+		}
+	}
+	t.Fatalf("step %q did not run", id)
+	return nil
+}
+
+func newHTTPTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Method", r.Method)
+		json.NewEncoder(w).Encode(map[string]string{
+			"method":       r.Method,
+			"body":         string(body),
+			"content_type": r.Header.Get("Content-Type"),
+			"token":        r.Header.Get("X-Token"),
+		})
+	})
+	mux.HandleFunc("/created", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such thing", http.StatusNotFound)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHTTPStep(t *testing.T) {
+	server := newHTTPTestServer(t)
+
+	tests := []struct {
+		name string
+		step string
+
+		// want holds the expected results by name, and fail the summary of
+		// the expected error, if any.
+		want map[string]cty.Value
+		fail string
+	}{
+		{
+			name: "get",
+			step: `
+    url = "${base}/echo"
+`,
+			want: map[string]cty.Value{
+				"status": cty.NumberIntVal(200),
+				"json": cty.ObjectVal(map[string]cty.Value{
+					"method":       cty.StringVal("GET"),
+					"body":         cty.StringVal(""),
+					"content_type": cty.StringVal(""),
+					"token":        cty.StringVal(""),
+				}),
+			},
+		},
+		{
+			name: "method, headers and body",
+			step: `
+    method  = "put"
+    url     = "${base}/echo"
+    headers = { X-Token = "secret" }
+    body    = "hello"
+`,
+			want: map[string]cty.Value{
+				"json": cty.ObjectVal(map[string]cty.Value{
+					"method":       cty.StringVal("PUT"),
+					"body":         cty.StringVal("hello"),
+					"content_type": cty.StringVal(""),
+					"token":        cty.StringVal("secret"),
+				}),
+			},
+		},
+		{
+			name: "json_body",
+			step: `
+    method    = "POST"
+    url       = "${base}/echo"
+    json_body = { name = "alice", admin = true }
+`,
+			want: map[string]cty.Value{
+				"json": cty.ObjectVal(map[string]cty.Value{
+					"method":       cty.StringVal("POST"),
+					"body":         cty.StringVal(`{"admin":true,"name":"alice"}`),
+					"content_type": cty.StringVal("application/json"),
+					"token":        cty.StringVal(""),
+				}),
+			},
+		},
+		{
+			name: "conflicting bodies",
+			step: `
+    url       = "${base}/echo"
+    body      = "hello"
+    json_body = { name = "alice" }
+`,
+			fail: "Conflicting request body",
+		},
+		{
+			name: "any 2xx status by default",
+			step: `
+    url = "${base}/created"
+`,
+			want: map[string]cty.Value{
+				"status": cty.NumberIntVal(201),
+				"body":   cty.StringVal("created"),
+				"json":   cty.NullVal(cty.DynamicPseudoType),
+			},
+		},
+		{
+			name: "unexpected status",
+			step: `
+    url = "${base}/missing"
+`,
+			fail: "Unexpected status",
+		},
+		{
+			name: "expect_status",
+			step: `
+    url           = "${base}/missing"
+    expect_status = 404
+`,
+			want: map[string]cty.Value{
+				"status": cty.NumberIntVal(404),
+			},
+		},
+		{
+			name: "expect_status mismatch",
+			step: `
+    url           = "${base}/created"
+    expect_status = 200
+`,
+			fail: "Unexpected status",
+		},
+		{
+			name: "asserts",
+			step: `
+    method = "DELETE"
+    url    = "${base}/echo"
+
+    assert {
+      condition = self.status == 200
+    }
+
+    assert {
+      condition = self.headers["X-Method"] == "DELETE"
+    }
+
+    assert {
+      condition     = self.json.method == "DELETE"
+      error_message = "unexpected method ${self.json.method}"
+    }
+`,
+			want: map[string]cty.Value{
+				"status": cty.NumberIntVal(200),
+			},
+		},
+		{
+			name: "failed assert",
+			step: `
+    url = "${base}/echo"
+
+    assert {
+      condition     = self.json.method == "POST"
+      error_message = "unexpected method ${self.json.method}"
+    }
+`,
+			fail: "Assertion failed",
+		},
+		{
+			name: "timeout",
+			step: `
+    url     = "${base}/slow"
+    timeout = "100ms"
+`,
+			fail: "Failed to send request",
+		},
+		{
+			name: "invalid timeout",
+			step: `
+    url     = "${base}/echo"
+    timeout = "soon"
+`,
+			fail: "Invalid duration",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			steps := "  step \"h\" {\n    type = \"http\"\n" + test.step + "  }\n"
+			sr := runSuiteStep(t, server.URL, steps, "h")
+
+			if test.fail != "" {
+				if sr.Status != StatusFail || len(sr.Diagnostics) == 0 || sr.Diagnostics[0].Summary != test.fail {
+					t.Fatalf("got %s with %v, want a failure with %q", sr.Status, sr.Diagnostics, test.fail)
+				}
+				return
+			}
+			if sr.Status != StatusPass {
+				t.Fatalf("got %s: %s", sr.Status, sr.Diagnostics.Error())
+			}
+			for name, want := range test.want {
+				got := sr.Outputs.GetAttr(name)
+				if !got.RawEquals(want) {
+					t.Errorf("got %s = %#v, want %#v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPStepTimeoutBoundsRun(t *testing.T) {
+	server := newHTTPTestServer(t)
+	start := time.Now()
+	sr := runSuiteStep(t, server.URL, `
+  step "h" {
+    type    = "http"
+    url     = "${base}/slow"
+    timeout = "200ms"
+  }
+`, "h")
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("the step took %s despite its timeout", elapsed)
+	}
+	if sr.Status != StatusFail || !strings.Contains(sr.Diagnostics[0].Detail, "Client.Timeout") {
+		t.Errorf("got %s with %v, want a client timeout", sr.Status, sr.Diagnostics)
+	}
+}
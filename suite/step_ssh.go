@@ -0,0 +1,257 @@
+package suite
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl2/gohcl"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshStep runs a command on a remote host over SSH. Its results are the exit
+// status and the captured output of the command, as for exec steps.
+type sshStep struct{}
+
+type sshStepConfig struct {
+	Host       string  `hcl:"host,attr"`
+	User       string  `hcl:"user,attr"`
+	PrivateKey *string `hcl:"private_key,attr"`
+	Password   *string `hcl:"password,attr"`
+	Command    string  `hcl:"command,attr"`
+	Stdin      *string `hcl:"stdin,attr"`
+	KnownHosts string  `hcl:"known_hosts,attr"`
+	ExpectExit *int    `hcl:"expect_exit,attr"`
+}
+
+func (sshStep) Schema() *hcl.BodySchema {
+	schema, _ := gohcl.ImpliedBodySchema(&sshStepConfig{})
+	return schema
+}
+
+func (sshStep) Run(ctx context.Context, step *TestStep, evalCtx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	cfg := sshStepConfig{}
+	diags := gohcl.DecodeBody(step.Config, evalCtx, &cfg)
+	if diags.HasErrors() {
+		return cty.DynamicVal, diags
+	}
+
+	addr := cfg.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+
+	clientCfg, err := cfg.clientConfig(filepath.Dir(step.DeclRange.Filename))
+	if err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid SSH configuration",
+			Detail:   fmt.Sprintf("Step %q cannot connect to %s: %v.", step.id, addr, err),
+			Subject:  step.DeclRange.Ptr(),
+		})
+		return cty.DynamicVal, diags
+	}
+
+	client, err := dialSSH(ctx, addr, clientCfg)
+	if err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to connect",
+			Detail:   fmt.Sprintf("Step %q could not connect to %s as %q: %v.", step.id, addr, cfg.User, err),
+			Subject:  step.DeclRange.Ptr(),
+		})
+		return cty.DynamicVal, diags
+	}
+	defer client.Close()
+
+	// Closing the client interrupts the command if ctx is done first.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			client.Close()
+		case <-done:
+		}
+	}()
+
+	session, err := client.NewSession()
+	if err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to run command",
+			Detail:   fmt.Sprintf("Step %q could not open a session on %s: %v.", step.id, addr, err),
+			Subject:  step.DeclRange.Ptr(),
+		})
+		return cty.DynamicVal, diags
+	}
+	defer session.Close()
+
+	if cfg.Stdin != nil {
+		session.Stdin = strings.NewReader(*cfg.Stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	exitStatus := 0
+	if err := session.Run(cfg.Command); err != nil {
+		exitErr, ok := err.(*ssh.ExitError)
+		if !ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to run command",
+				Detail:   fmt.Sprintf("Step %q could not run %q on %s: %v.", step.id, cfg.Command, addr, err),
+				Subject:  step.DeclRange.Ptr(),
+			})
+			return cty.DynamicVal, diags
+		}
+		exitStatus = exitErr.ExitStatus()
+	}
+
+	expectExit := 0
+	if cfg.ExpectExit != nil {
+		expectExit = *cfg.ExpectExit
+	}
+	if exitStatus != expectExit {
+		detail := fmt.Sprintf("Step %q expected %q on %s to exit with status %d, but it exited with status %d.", step.id, cfg.Command, addr, expectExit, exitStatus)
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			detail += "\n\nstderr:\n" + msg
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Unexpected exit status",
+			Detail:   detail,
+			Subject:  step.DeclRange.Ptr(),
+		})
+	}
+
+	return cty.ObjectVal(map[string]cty.Value{
+		"exit_status": cty.NumberIntVal(int64(exitStatus)),
+		"stdout":      cty.StringVal(stdout.String()),
+		"stderr":      cty.StringVal(stderr.String()),
+	}), diags
+}
+
+// clientConfig returns the client configuration of the step. The private_key
+// and known_hosts files are relative to dir.
+func (cfg *sshStepConfig) clientConfig(dir string) (*ssh.ClientConfig, error) {
+	known, err := ioutil.ReadFile(resolvePath(dir, cfg.KnownHosts))
+	if err != nil {
+		return nil, err
+	}
+	clientCfg := &ssh.ClientConfig{
+		User:            cfg.User,
+		HostKeyCallback: knownHostsCallback(known),
+	}
+
+	if cfg.PrivateKey != nil {
+		pemBytes, err := ioutil.ReadFile(resolvePath(dir, *cfg.PrivateKey))
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid private_key %s: %v", *cfg.PrivateKey, err)
+		}
+		clientCfg.Auth = append(clientCfg.Auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != nil {
+		clientCfg.Auth = append(clientCfg.Auth, ssh.Password(*cfg.Password))
+	}
+	if len(clientCfg.Auth) == 0 {
+		return nil, fmt.Errorf("one of private_key and password must be set")
+	}
+	return clientCfg, nil
+}
+
+// dialSSH connects to addr, giving up at the deadline of ctx.
+func dialSSH(ctx context.Context, addr string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, cfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// knownHostsCallback accepts a host key if it is listed for the host in known,
+// which is in the format of OpenSSH's known_hosts file. Hosts may be listed
+// by name, as [name]:port for ports other than 22, or hashed. Entries with a
+// marker such as @cert-authority are ignored.
+func knownHostsCallback(known []byte) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		host, port, err := net.SplitHostPort(hostname)
+		if err != nil {
+			return err
+		}
+		name := host
+		if port != "22" {
+			name = "[" + host + "]:" + port
+		}
+
+		for rest := known; len(rest) > 0; {
+			marker, hosts, pubKey, _, next, err := ssh.ParseKnownHosts(rest)
+			if err != nil {
+				break
+			}
+			rest = next
+			if marker != "" || !knownHostMatches(hosts, name) {
+				continue
+			}
+			if bytes.Equal(pubKey.Marshal(), key.Marshal()) {
+				return nil
+			}
+		}
+		return fmt.Errorf("the %s host key of %s is not listed in known_hosts", key.Type(), name)
+	}
+}
+
+func knownHostMatches(hosts []string, name string) bool {
+	for _, host := range hosts {
+		if host == name {
+			return true
+		}
+
+		// Hashed entries are |1|salt|hash, with the hash an HMAC-SHA1 of
+		// the name keyed by the salt.
+		parts := strings.Split(host, "|")
+		if len(parts) != 4 || parts[0] != "" || parts[1] != "1" {
+			continue
+		}
+		salt, err := base64.StdEncoding.DecodeString(parts[2])
+		if err != nil {
+			continue
+		}
+		hash, err := base64.StdEncoding.DecodeString(parts[3])
+		if err != nil {
+			continue
+		}
+		mac := hmac.New(sha1.New, salt)
+		mac.Write([]byte(name))
+		if hmac.Equal(mac.Sum(nil), hash) {
+			return true
+		}
+	}
+	return false
+}
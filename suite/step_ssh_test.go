@@ -0,0 +1,293 @@
+package suite
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshTestServer is an in-process SSH server that accepts the password
+// "secret" and the public key of clientKey. It "runs" a command by writing
+// "ran <command>" to stdout and its stdin to stderr, and exits with status N
+// for commands of the form "exit N".
+type sshTestServer struct {
+	addr      string
+	hostKey   ssh.Signer
+	clientKey *ecdsa.PrivateKey
+}
+
+func newSSHTestServer(t *testing.T) *sshTestServer {
+	t.Helper()
+	hostKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPub, err := ssh.NewPublicKey(&clientKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "alice" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("wrong password for %s", conn.User())
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "alice" && string(key.Marshal()) == string(clientPub.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key for %s", conn.User())
+		},
+	}
+	cfg.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, cfg)
+		}
+	}()
+
+	return &sshTestServer{
+		addr:      ln.Addr().String(),
+		hostKey:   hostSigner,
+		clientKey: clientKey,
+	}
+}
+
+func serveSSH(conn net.Conn, cfg *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		ch, chReqs, err := newChan.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer ch.Close()
+			for req := range chReqs {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				var exec struct{ Command string }
+				if err := ssh.Unmarshal(req.Payload, &exec); err != nil {
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+
+				stdin, _ := ioutil.ReadAll(ch)
+				fmt.Fprintf(ch, "ran %s\n", exec.Command)
+				ch.Stderr().Write(stdin)
+
+				var status struct{ Status uint32 }
+				if code := strings.TrimPrefix(exec.Command, "exit "); code != exec.Command {
+					n, _ := strconv.Atoi(code)
+					status.Status = uint32(n)
+				}
+				ch.SendRequest("exit-status", false, ssh.Marshal(&status))
+				return
+			}
+		}()
+	}
+}
+
+// knownHosts returns a known_hosts line listing the host key of the server
+// under name.
+func (s *sshTestServer) knownHosts(name string) string {
+	return name + " " + string(ssh.MarshalAuthorizedKey(s.hostKey.PublicKey()))
+}
+
+// hashedName returns name hashed as in a known_hosts file.
+func hashedName(name string) string {
+	salt := []byte("0123456789abcdefghij")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(name))
+	return "|1|" + base64.StdEncoding.EncodeToString(salt) + "|" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestSSHStep(t *testing.T) {
+	server := newSSHTestServer(t)
+	_, port, _ := net.SplitHostPort(server.addr)
+	name := "[127.0.0.1]:" + port
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, err := ssh.NewPublicKey(&otherKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(server.clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := writeSuite(t, map[string]string{
+		"known_hosts":  server.knownHosts(name),
+		"hashed_hosts": server.knownHosts(hashedName(name)),
+		"other_hosts":  name + " " + string(ssh.MarshalAuthorizedKey(otherPub)),
+		"id_ecdsa":     string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+	})
+
+	tests := []struct {
+		name string
+
+		// step holds the attributes of the step, with @dir standing for
+		// the directory of the key and known_hosts files. want holds the
+		// expected results by name, and fail the summary of the expected
+		// error, if any.
+		step string
+		want map[string]cty.Value
+		fail string
+	}{
+		{
+			name: "password",
+			step: `
+    password    = "secret"
+    known_hosts = "@dir/known_hosts"
+    command     = "uptime"
+`,
+			want: map[string]cty.Value{
+				"exit_status": cty.NumberIntVal(0),
+				"stdout":      cty.StringVal("ran uptime\n"),
+				"stderr":      cty.StringVal(""),
+			},
+		},
+		{
+			name: "private key, stdin and hashed known_hosts",
+			step: `
+    private_key = "@dir/id_ecdsa"
+    known_hosts = "@dir/hashed_hosts"
+    command     = "cat"
+    stdin       = "hello"
+`,
+			want: map[string]cty.Value{
+				"stdout": cty.StringVal("ran cat\n"),
+				"stderr": cty.StringVal("hello"),
+			},
+		},
+		{
+			name: "expect_exit",
+			step: `
+    password    = "secret"
+    known_hosts = "@dir/known_hosts"
+    command     = "exit 3"
+    expect_exit = 3
+`,
+			want: map[string]cty.Value{
+				"exit_status": cty.NumberIntVal(3),
+			},
+		},
+		{
+			name: "unexpected exit status",
+			step: `
+    password    = "secret"
+    known_hosts = "@dir/known_hosts"
+    command     = "exit 1"
+`,
+			fail: "Unexpected exit status",
+		},
+		{
+			name: "wrong password",
+			step: `
+    password    = "guess"
+    known_hosts = "@dir/known_hosts"
+    command     = "uptime"
+`,
+			fail: "Failed to connect",
+		},
+		{
+			name: "unknown host key",
+			step: `
+    password    = "secret"
+    known_hosts = "@dir/other_hosts"
+    command     = "uptime"
+`,
+			fail: "Failed to connect",
+		},
+		{
+			name: "missing known_hosts",
+			step: `
+    password = "secret"
+    command  = "uptime"
+`,
+			fail: "Missing required attribute",
+		},
+		{
+			name: "missing credentials",
+			step: `
+    known_hosts = "@dir/known_hosts"
+    command     = "uptime"
+`,
+			fail: "Invalid SSH configuration",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := strings.Replace(test.step, "@dir", filepath.ToSlash(dir), -1)
+			steps := "  step \"s\" {\n    type = \"ssh\"\n    host = \"${base}\"\n    user = \"alice\"\n" + body + "  }\n"
+			sr := runSuiteStep(t, server.addr, steps, "s")
+
+			if test.fail != "" {
+				if sr.Status != StatusFail || len(sr.Diagnostics) == 0 || sr.Diagnostics[0].Summary != test.fail {
+					t.Fatalf("got %s with %v, want a failure with %q", sr.Status, sr.Diagnostics, test.fail)
+				}
+				return
+			}
+			if sr.Status != StatusPass {
+				t.Fatalf("got %s: %s", sr.Status, sr.Diagnostics.Error())
+			}
+			for name, want := range test.want {
+				got := sr.Outputs.GetAttr(name)
+				if !got.RawEquals(want) {
+					t.Errorf("got %s = %#v, want %#v", name, got, want)
+				}
+			}
+		})
+	}
+}
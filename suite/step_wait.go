@@ -0,0 +1,280 @@
+package suite
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/hcl2/gohcl"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+const (
+	defaultWaitInterval = time.Second
+	defaultWaitTimeout  = 30 * time.Second
+)
+
+// waitStep polls a TCP address, an HTTP endpoint or a file until it is ready,
+// and then until its condition, if any, holds. Its results are the number of
+// attempts, the seconds spent waiting and the state seen by the last attempt.
+type waitStep struct{}
+
+type waitStepConfig struct {
+	TCP       *string        `hcl:"tcp,attr"`
+	HTTP      *string        `hcl:"http,attr"`
+	File      *string        `hcl:"file,attr"`
+	Condition *hcl.Attribute `hcl:"condition,attr"`
+	Interval  *hcl.Attribute `hcl:"interval,attr"`
+	Timeout   *hcl.Attribute `hcl:"timeout,attr"`
+}
+
+func (waitStep) Schema() *hcl.BodySchema {
+	schema, _ := gohcl.ImpliedBodySchema(&waitStepConfig{})
+	return schema
+}
+
+// The condition sees the latest observation of the target as self.
+func (waitStep) selfAttributes() []string {
+	return []string{"condition"}
+}
+
+// waitProbe makes one attempt. It returns whether the target is ready, a
+// description of its state, and the value of self for the condition.
+type waitProbe func(ctx context.Context) (bool, string, cty.Value)
+
+func (waitStep) Run(ctx context.Context, step *TestStep, evalCtx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	cfg := waitStepConfig{}
+	diags := gohcl.DecodeBody(step.Config, evalCtx, &cfg)
+	if diags.HasErrors() {
+		return cty.DynamicVal, diags
+	}
+
+	interval, d := decodeDuration(cfg.Interval, evalCtx, defaultWaitInterval)
+	diags = append(diags, d...)
+	timeout, d := decodeDuration(cfg.Timeout, evalCtx, defaultWaitTimeout)
+	diags = append(diags, d...)
+	if diags.HasErrors() {
+		return cty.DynamicVal, diags
+	}
+
+	var target string
+	var probe waitProbe
+	targets := 0
+	if cfg.TCP != nil {
+		targets++
+		target, probe = *cfg.TCP, tcpProbe(*cfg.TCP)
+	}
+	if cfg.HTTP != nil {
+		targets++
+		target, probe = *cfg.HTTP, httpProbe(*cfg.HTTP)
+	}
+	if cfg.File != nil {
+		targets++
+		target, probe = *cfg.File, fileProbe(resolvePath(filepath.Dir(step.DeclRange.Filename), *cfg.File))
+	}
+	switch {
+	case targets > 1:
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Conflicting wait targets",
+			Detail:   "Only one of tcp, http and file may be set.",
+			Subject:  step.DeclRange.Ptr(),
+		})
+		return cty.DynamicVal, diags
+	case targets == 0 && cfg.Condition == nil:
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Missing wait target",
+			Detail:   "One of tcp, http, file and condition must be set.",
+			Subject:  step.DeclRange.Ptr(),
+		})
+		return cty.DynamicVal, diags
+	case targets == 0:
+		probe = func(context.Context) (bool, string, cty.Value) {
+			return true, "", cty.NullVal(cty.DynamicPseudoType)
+		}
+	}
+
+	start := time.Now()
+	deadline := start.Add(timeout)
+	attempts := 0
+	var state string
+	for {
+		attempts++
+		attemptCtx, cancel := context.WithDeadline(ctx, deadline)
+		ready, observed, self := probe(attemptCtx)
+		cutOff := attemptCtx.Err() != nil
+		cancel()
+
+		if ready && cfg.Condition != nil {
+			condCtx := evalCtx.NewChild()
+			condCtx.Variables = map[string]cty.Value{"self": self}
+			val, d := cfg.Condition.Expr.Value(condCtx)
+			diags = append(diags, d...)
+			if d.HasErrors() {
+				return cty.DynamicVal, diags
+			}
+			val, err := convert.Convert(val, cty.Bool)
+			if err != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid wait condition",
+					Detail:   fmt.Sprintf("The condition must be true or false: %s.", err),
+					Subject:  cfg.Condition.Expr.Range().Ptr(),
+				})
+				return cty.DynamicVal, diags
+			}
+			if ready = val.IsKnown() && !val.IsNull() && val.True(); !ready {
+				if observed != "" {
+					observed += ", but "
+				}
+				observed += "the condition is false"
+			}
+		}
+
+		// An attempt cut off by the deadline says less about the target
+		// than the one before it.
+		if !cutOff || state == "" {
+			state = observed
+		}
+
+		result := cty.ObjectVal(map[string]cty.Value{
+			"attempts": cty.NumberIntVal(int64(attempts)),
+			"elapsed":  cty.NumberFloatVal(time.Since(start).Seconds()),
+			"state":    cty.StringVal(state),
+		})
+		if ready {
+			return result, diags
+		}
+
+		// Without a target nothing the condition sees can change, so
+		// there is no point in trying again.
+		if targets == 0 {
+			return result, append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Wait condition is false",
+				Detail:   fmt.Sprintf("Step %q has no tcp, http or file target to wait for, and its condition is false.", step.id),
+				Subject:  cfg.Condition.Expr.Range().Ptr(),
+			})
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 || ctx.Err() != nil {
+			return result, append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Timed out waiting",
+				Detail:   fmt.Sprintf("Step %q waited %s for %s, but it was not ready after %d attempts. The last attempt found: %s.", step.id, time.Since(start).Round(time.Millisecond), target, attempts, state),
+				Subject:  step.DeclRange.Ptr(),
+			})
+		}
+
+		// The last attempt is made at the deadline.
+		wait := interval
+		if wait > remaining {
+			wait = remaining
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// decodeDuration decodes a duration such as "500ms" from attr, or returns
+// def if attr is not set.
+func decodeDuration(attr *hcl.Attribute, ctx *hcl.EvalContext, def time.Duration) (time.Duration, hcl.Diagnostics) {
+	if attr == nil {
+		return def, nil
+	}
+	var s string
+	diags := gohcl.DecodeExpression(attr.Expr, ctx, &s)
+	if diags.HasErrors() {
+		return def, diags
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return def, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid duration",
+			Detail:   fmt.Sprintf("The %s must be a positive duration such as \"500ms\" or \"2m\", not %q.", attr.Name, s),
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+	}
+	return d, diags
+}
+
+// tcpProbe is ready once a connection to addr succeeds.
+func tcpProbe(addr string) waitProbe {
+	return func(ctx context.Context) (bool, string, cty.Value) {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return false, err.Error(), cty.NullVal(cty.DynamicPseudoType)
+		}
+		conn.Close()
+		return true, "connected to " + addr, cty.ObjectVal(map[string]cty.Value{
+			"address": cty.StringVal(addr),
+		})
+	}
+}
+
+// httpProbe is ready once a GET request for url gets a 2xx status. The
+// condition sees the response as the results of an http step.
+func httpProbe(url string) waitProbe {
+	return func(ctx context.Context) (bool, string, cty.Value) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return false, err.Error(), cty.NullVal(cty.DynamicPseudoType)
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return false, err.Error(), cty.NullVal(cty.DynamicPseudoType)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return false, err.Error(), cty.NullVal(cty.DynamicPseudoType)
+		}
+
+		state := fmt.Sprintf("status %d", resp.StatusCode)
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return false, state, cty.NullVal(cty.DynamicPseudoType)
+		}
+		return true, state, cty.ObjectVal(map[string]cty.Value{
+			"status":  cty.NumberIntVal(int64(resp.StatusCode)),
+			"headers": responseHeaders(resp.Header),
+			"body":    cty.StringVal(string(body)),
+			"json":    decodeJSONBody(body),
+		})
+	}
+}
+
+// fileProbe is ready once filename exists. The condition sees the content of
+// a regular file.
+func fileProbe(filename string) waitProbe {
+	return func(context.Context) (bool, string, cty.Value) {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return false, err.Error(), cty.NullVal(cty.DynamicPseudoType)
+		}
+		content := cty.NullVal(cty.String)
+		if !info.IsDir() {
+			data, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return false, err.Error(), cty.NullVal(cty.DynamicPseudoType)
+			}
+			content = cty.StringVal(string(data))
+		}
+		return true, filename + " exists", cty.ObjectVal(map[string]cty.Value{
+			"path":    cty.StringVal(filename),
+			"content": content,
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package suite
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestWaitStep(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests < 2 {
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"requests": %d}`, requests)
+	}))
+	t.Cleanup(server.Close)
+	dir := writeSuite(t, map[string]string{"ready.txt": "starting\n"})
+
+	tests := []struct {
+		name string
+
+		// step holds the attributes of the step, with @dir standing for a
+		// directory holding ready.txt. attempts is the expected number of
+		// attempts, and fail the expected error and a part of its detail,
+		// if any.
+		step     string
+		attempts int64
+		fail     []string
+	}{
+		{
+			name: "http with condition",
+			step: `
+    http      = "@url"
+    interval  = "10ms"
+    condition = self.json.requests >= 4
+`,
+			attempts: 4,
+		},
+		{
+			name: "file",
+			step: `
+    file = "@dir/ready.txt"
+`,
+			attempts: 1,
+		},
+		{
+			name: "timeout",
+			step: `
+    file      = "@dir/ready.txt"
+    interval  = "50ms"
+    timeout   = "200ms"
+    condition = self.content == "ready\n"
+`,
+			fail: []string{"Timed out waiting", "The last attempt found: " + dir + "/ready.txt exists, but the condition is false."},
+		},
+		{
+			name: "true condition",
+			step: `
+    condition = true
+`,
+			attempts: 1,
+		},
+		{
+			name: "false condition",
+			step: `
+    timeout   = "10s"
+    condition = false
+`,
+			fail: []string{"Wait condition is false", "has no tcp, http or file target"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := strings.Replace(test.step, "@url", server.URL, -1)
+			body = strings.Replace(body, "@dir", dir, -1)
+			steps := "  step \"w\" {\n    type = \"wait\"\n" + body + "  }\n"
+
+			start := time.Now()
+			sr := runSuiteStep(t, "", steps, "w")
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("the step took %s", elapsed)
+			}
+
+			if test.fail != nil {
+				if sr.Status != StatusFail || len(sr.Diagnostics) == 0 || sr.Diagnostics[0].Summary != test.fail[0] {
+					t.Fatalf("got %s with %v, want a failure with %q", sr.Status, sr.Diagnostics, test.fail[0])
+				}
+				if detail := sr.Diagnostics[0].Detail; !strings.Contains(detail, test.fail[1]) {
+					t.Errorf("got detail %q, want it to contain %q", detail, test.fail[1])
+				}
+				return
+			}
+			if sr.Status != StatusPass {
+				t.Fatalf("got %s: %s", sr.Status, sr.Diagnostics.Error())
+			}
+			if got := sr.Outputs.GetAttr("attempts"); !got.RawEquals(cty.NumberIntVal(test.attempts)) {
+				t.Errorf("got %#v attempts, want %d", got, test.attempts)
+			}
+		})
+	}
+}
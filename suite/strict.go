@@ -0,0 +1,170 @@
+package suite
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcl2/gohcl"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+)
+
+// stepHeaderNames and fixtureHeaderNames are the attributes and blocks the
+// loader itself decodes from step and fixture blocks, including the use
+// attribute of steps. Everything else is left in Config.
+var (
+	stepHeaderNames    = schemaNames(&rawTestStep{}, "use")
+	fixtureHeaderNames = schemaNames(&rawTestCaseFixture{})
+)
+
+func schemaNames(val interface{}, extra ...string) []string {
+	schema, _ := gohcl.ImpliedBodySchema(val)
+	names := append([]string(nil), extra...)
+	for _, attr := range schema.Attributes {
+		names = append(names, attr.Name)
+	}
+	for _, block := range schema.Blocks {
+		names = append(names, block.Type)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkStrict reports the content of body that is not described by schema.
+// headerNames are the attributes and blocks already decoded from the
+// enclosing block, which are offered as suggestions alongside the schema's
+// own attributes.
+//
+// A nil schema means body holds free-form attributes. Those are all
+// accepted, except that near-misses of the header names are reported, since
+// a misspelled "after" or "type" would otherwise be silently treated as an
+// ordinary attribute.
+func checkStrict(body hcl.Body, schema *hcl.BodySchema, headerNames []string) hcl.Diagnostics {
+	if tb, ok := body.(*templateBody); ok {
+		// Either body may set a required attribute, so each is checked
+		// without requiring any.
+		if schema != nil {
+			schema = relaxedSchema(schema)
+		}
+		return append(checkStrict(tb.template, schema, headerNames), checkStrict(tb.step, schema, headerNames)...)
+	}
+
+	if schema == nil {
+		return checkFreeForm(body, headerNames)
+	}
+
+	names := append([]string(nil), headerNames...)
+	for _, attr := range schema.Attributes {
+		names = append(names, attr.Name)
+	}
+
+	// Errors such as a missing required attribute do not stop the check,
+	// since the attribute is often only misspelled and the unsupported one
+	// gets a suggestion below.
+	_, rest, diags := body.PartialContent(schema)
+
+	var unknown []*hcl.Attribute
+	if sb, ok := body.(*hclsyntax.Body); ok {
+		// JustAttributes refuses native syntax bodies that contain any
+		// blocks at all, even ones the schema accepts, so the syntax tree
+		// is inspected directly instead.
+		blockNames := make([]string, 0, len(schema.Blocks))
+		for _, block := range schema.Blocks {
+			blockNames = append(blockNames, block.Type)
+		}
+		for _, block := range sb.Blocks {
+			if containsString(blockNames, block.Type) || containsString(headerNames, block.Type) {
+				continue
+			}
+			if block.Type == "dynamic" && len(blockNames) > 0 && len(block.Labels) == 1 {
+				if containsString(blockNames, block.Labels[0]) {
+					continue
+				}
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Unsupported block type",
+					Detail:   fmt.Sprintf("Blocks of type %q are not expected here, so a dynamic block cannot generate them.%s", block.Labels[0], didYouMean(block.Labels[0], blockNames)),
+					Subject:  block.LabelRanges[0].Ptr(),
+				})
+				continue
+			}
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unsupported block type",
+				Detail:   fmt.Sprintf("Blocks of type %q are not expected here.%s", block.Type, didYouMean(block.Type, blockNames)),
+				Subject:  block.TypeRange.Ptr(),
+			})
+		}
+		for name, attr := range sb.Attributes {
+			if !containsString(names, name) {
+				unknown = append(unknown, attr.AsHCLAttribute())
+			}
+		}
+	} else {
+		attrs, d := rest.JustAttributes()
+		diags = append(diags, d...)
+		for _, attr := range attrs {
+			unknown = append(unknown, attr)
+		}
+	}
+
+	for _, attr := range sortedAttributes(unknown) {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Unsupported attribute",
+			Detail:   fmt.Sprintf("An attribute named %q is not expected here.%s", attr.Name, didYouMean(attr.Name, names)),
+			Subject:  attr.NameRange.Ptr(),
+		})
+	}
+
+	return diags
+}
+
+func checkFreeForm(body hcl.Body, headerNames []string) hcl.Diagnostics {
+	content, diags := freeFormContent(body)
+	if diags.HasErrors() {
+		return diags
+	}
+	attrs := content.Attributes
+
+	unsorted := make([]*hcl.Attribute, 0, len(attrs))
+	for _, attr := range attrs {
+		unsorted = append(unsorted, attr)
+	}
+	for _, attr := range sortedAttributes(unsorted) {
+		// Short names are too often a legitimate result name that happens
+		// to be close to a header name, such as "id2" or "typ".
+		if len(attr.Name) < 4 {
+			continue
+		}
+		suggestion := nameSuggestion(attr.Name, headerNames)
+		if suggestion == "" {
+			continue
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Suspicious attribute name",
+			Detail:   fmt.Sprintf("An attribute named %q is treated as a result of this block. Did you mean %q?", attr.Name, suggestion),
+			Subject:  attr.NameRange.Ptr(),
+		})
+	}
+
+	return diags
+}
+
+// sortedAttributes sorts attrs into source order.
+func sortedAttributes(sorted []*hcl.Attribute) []*hcl.Attribute {
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].NameRange.Start.Byte < sorted[j].NameRange.Start.Byte
+	})
+	return sorted
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
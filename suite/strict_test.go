@@ -0,0 +1,82 @@
+package suite
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStrict(t *testing.T) {
+	tests := []struct {
+		name string
+		step string
+		want []string
+	}{
+		{
+			name: "valid",
+			step: `
+    type    = "exec"
+    command = "echo"
+    after   = ["a"]
+`,
+		},
+		{
+			name: "misspelled required attribute",
+			step: `
+    type   = "exec"
+    comand = "echo"
+    aftr   = ["a"]
+`,
+			want: []string{
+				`Missing required attribute`,
+				`Unsupported attribute: An attribute named "comand" is not expected here. Did you mean "command"?`,
+				`Unsupported attribute: An attribute named "aftr" is not expected here. Did you mean "after"?`,
+			},
+		},
+		{
+			name: "unsupported block",
+			step: `
+    type    = "http"
+    url     = "http://localhost"
+
+    asert {
+      condition = true
+    }
+`,
+			want: []string{
+				`Unsupported block type: Blocks of type "asert" are not expected here. Did you mean "assert"?`,
+			},
+		},
+		{
+			name: "free-form near-miss",
+			step: `
+    aftr  = ["a"]
+    value = 1
+`,
+			want: []string{
+				`Suspicious attribute name: An attribute named "aftr" is treated as a result of this block. Did you mean "after"?`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := "suitename = \"s\"\n\ntestcase \"c\" {\n  step \"a\" {}\n\n  step \"b\" {" + test.step + "  }\n}\n"
+			l := NewLoader()
+			l.Strict = true
+			_, diags := l.Load(writeSuite(t, map[string]string{"suite.hcl": src}))
+
+			var got []string
+			for _, diag := range diags {
+				msg := diag.Summary
+				if strings.HasPrefix(diag.Detail, "An attribute") || strings.HasPrefix(diag.Detail, "Blocks") {
+					msg += ": " + diag.Detail
+				}
+				got = append(got, msg)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
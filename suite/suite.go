@@ -0,0 +1,181 @@
+// Package suite loads HCL2 test suites and executes the steps within them.
+//
+// A suite is made up of one or more files containing a single suitename, any
+// number of variable declarations, locals, fixtures and testcase blocks, and
+// include blocks naming further files of variables, locals and fixtures. Each
+// testcase contains fixtures and steps, and the steps are ordered by the
+// before/after dependencies between them.
+package suite
+
+import (
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+// TestSuite is the fully-decoded representation of a suite.
+type TestSuite struct {
+	Name      string
+	TestCases []*TestCase
+	Variables map[string]*Variable
+	Locals    map[string]*Local
+
+	// Fixtures are the fixtures declared outside any testcase, which are
+	// available to the steps of every testcase.
+	Fixtures []*TestCaseFixture
+
+	// StepTemplates are the step_template blocks of the suite by name.
+	StepTemplates map[string]*StepTemplate
+
+	// Files is the set of files that make up the suite, in load order,
+	// including the files they include.
+	Files []string
+
+	// includedFrom maps each included file to the include block that
+	// included it, for describing the include chain in diagnostics.
+	includedFrom map[string]hcl.Range
+
+	caseDepGraph    *simple.DirectedGraph
+	caseDepGraphMap map[graph.Node]*TestCase
+	orderedCases    []*TestCase
+
+	// filteredCases holds the names of the testcases dropped by the
+	// loader's Filter, so that dependencies on them are not reported as
+	// missing.
+	filteredCases map[string]bool
+}
+
+// Variable is a suite-level variable declaration. The value of a variable is
+// its default unless it was overridden when the suite was loaded.
+type Variable struct {
+	Name      string
+	Value     cty.Value
+	DeclRange hcl.Range
+}
+
+// Local is a value from a locals block, available to every expression in the
+// suite as local.<name>.
+type Local struct {
+	Name      string
+	Value     cty.Value
+	DeclRange hcl.Range
+}
+
+// TestCase is a named collection of fixtures and steps.
+type TestCase struct {
+	Name      string
+	Enabled   bool
+	Tags      []string
+	TestSteps []*TestStep
+	Fixtures  []*TestCaseFixture
+	Modules   []*Module
+	StepMap   map[string]*TestStep
+	DeclRange hcl.Range
+
+	stepDepGraph    *simple.DirectedGraph
+	stepDepRoot     graph.Node
+	stepDepGraphMap map[graph.Node]*TestStep
+	stepDepKinds    map[stepDepEdge]DependencyKind
+	orderedSteps    []*TestStep
+
+	// dependsOn names the testcases that must complete before this one
+	// starts, and suiteNode is the case's node in the suite's graph.
+	dependsOn []stepRef
+	suiteNode graph.Node
+
+	// each is the each object of a testcase expanded by for_each or a
+	// matrix, and cty.NilVal otherwise. baseName is the name of the
+	// testcase block, without the instance key.
+	each     cty.Value
+	baseName string
+
+	// filteredSteps holds the ids of the steps dropped by the loader's
+	// Filter, so that references to them are not reported as missing.
+	filteredSteps map[string]bool
+
+	// brokenModules holds the names of the modules that failed to load,
+	// whose errors have already been reported.
+	brokenModules map[string]bool
+}
+
+// TestStep is a single unit of work within a TestCase. The Config body holds
+// everything that was not consumed by the step header and is interpreted by
+// the step's type when it runs.
+type TestStep struct {
+	Name      string
+	Type      string
+	Tags      []string
+	StepNum   uint64
+	Config    hcl.Body
+	DeclRange hcl.Range
+
+	id        string
+	testCase  *TestCase
+	caseNode  graph.Node
+	runBefore []stepRef
+	runAfter  []stepRef
+
+	// crossDeps are the steps of other testcases that must pass before this
+	// step can run.
+	crossDeps []*TestStep
+
+	// idRange is where the id was declared: the label, the id attribute
+	// or, when autoID is set because the id is the step's position, the
+	// block header.
+	idRange hcl.Range
+	autoID  bool
+
+	// template is the step template named by use, if any, at useRange.
+	template *StepTemplate
+	useRange hcl.Range
+
+	// module is the module that added the step to its testcase, if any.
+	module *Module
+
+	// snapshots are the step's snapshot blocks, which the loader takes out
+	// of Config.
+	snapshots []*snapshot
+}
+
+// TestCaseFixture is a named set of values made available to every step in a
+// TestCase, or in every testcase for the fixtures of the suite, as
+// fixture.<name>.<attribute>.
+type TestCaseFixture struct {
+	Name      string
+	Config    hcl.Body
+	DeclRange hcl.Range
+}
+
+// stepRef is a reference to a step by id, as written in a before or after
+// attribute, or to a testcase by name, as written in depends_on.
+type stepRef struct {
+	id  string
+	rng hcl.Range
+}
+
+// ID returns the identifier used to refer to the step from other steps. It is
+// either the explicit id attribute or the 1-based position of the step in its
+// testcase.
+func (s *TestStep) ID() string {
+	return s.id
+}
+
+// CaseFixtures returns the fixtures available to the steps of tc: those of
+// the suite followed by those of the testcase.
+func (ts *TestSuite) CaseFixtures(tc *TestCase) []*TestCaseFixture {
+	fixtures := make([]*TestCaseFixture, 0, len(ts.Fixtures)+len(tc.Fixtures))
+	fixtures = append(fixtures, ts.Fixtures...)
+	return append(fixtures, tc.Fixtures...)
+}
+
+// Case returns the TestCase with the given name, or nil if there is no such
+// case in the suite.
+func (ts *TestSuite) Case(name string) *TestCase {
+	for _, tc := range ts.TestCases {
+		if tc.Name == name {
+			return tc
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package suite
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// tagExpr is a boolean expression over the tags of a step, as given to -tags
+// and -skip-tags.
+type tagExpr interface {
+	match(tags []string) bool
+	String() string
+}
+
+type tagName string
+
+type tagNot struct {
+	expr tagExpr
+}
+
+type tagAnd struct {
+	left, right tagExpr
+}
+
+type tagOr struct {
+	left, right tagExpr
+}
+
+func (e tagName) match(tags []string) bool { return containsString(tags, string(e)) }
+func (e tagNot) match(tags []string) bool  { return !e.expr.match(tags) }
+func (e tagAnd) match(tags []string) bool  { return e.left.match(tags) && e.right.match(tags) }
+func (e tagOr) match(tags []string) bool   { return e.left.match(tags) || e.right.match(tags) }
+
+func (e tagName) String() string { return string(e) }
+func (e tagNot) String() string  { return "not " + e.expr.String() }
+func (e tagAnd) String() string  { return "(" + e.left.String() + " and " + e.right.String() + ")" }
+func (e tagOr) String() string   { return "(" + e.left.String() + " or " + e.right.String() + ")" }
+
+// parseTagExpr parses a tag expression such as "slow and not (db or net)".
+// A comma is the same as or, so a comma-separated list of tags matches any
+// of them. not binds tighter than and, which binds tighter than or. The
+// expression of an empty string is nil.
+func parseTagExpr(s string) (tagExpr, error) {
+	p := &tagParser{tokens: tagTokens(s)}
+	if len(p.tokens) == 0 {
+		return nil, nil
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok != "" {
+		return nil, fmt.Errorf("unexpected %q", tok)
+	}
+	return expr, nil
+}
+
+// tagTokens splits s into parentheses, commas and words.
+func tagTokens(s string) []string {
+	var tokens []string
+	word := -1
+	for i, r := range s {
+		if r == '(' || r == ')' || r == ',' || unicode.IsSpace(r) {
+			if word >= 0 {
+				tokens = append(tokens, s[word:i])
+				word = -1
+			}
+			if !unicode.IsSpace(r) {
+				tokens = append(tokens, string(r))
+			}
+			continue
+		}
+		if word < 0 {
+			word = i
+		}
+	}
+	if word >= 0 {
+		tokens = append(tokens, s[word:])
+	}
+	return tokens
+}
+
+type tagParser struct {
+	tokens []string
+}
+
+func (p *tagParser) peek() string {
+	if len(p.tokens) == 0 {
+		return ""
+	}
+	return p.tokens[0]
+}
+
+func (p *tagParser) next() string {
+	tok := p.peek()
+	if tok != "" {
+		p.tokens = p.tokens[1:]
+	}
+	return tok
+}
+
+func (p *tagParser) parseOr() (tagExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" || p.peek() == "," {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = tagOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *tagParser) parseAnd() (tagExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = tagAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *tagParser) parseNot() (tagExpr, error) {
+	switch tok := p.next(); tok {
+	case "":
+		return nil, fmt.Errorf("expected a tag at the end")
+	case "not":
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return tagNot{expr}, nil
+	case "(":
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return expr, nil
+	case ")", ",", "and", "or":
+		return nil, fmt.Errorf("expected a tag before %q", tok)
+	default:
+		return tagName(tok), nil
+	}
+}
@@ -0,0 +1,235 @@
+package suite
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl2/gohcl"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+)
+
+var useSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "use"},
+	},
+}
+
+// StepTemplate is a step_template block, whose content is shared by every
+// step that names it in its use attribute.
+type StepTemplate struct {
+	Name      string
+	Body      hcl.Body
+	DeclRange hcl.Range
+
+	// srcRange covers the whole block, to recognize the diagnostics
+	// raised within it.
+	srcRange hcl.Range
+}
+
+// decodeStepTemplates collects the step_template blocks of the suite.
+func (ts *TestSuite) decodeStepTemplates(blocks hcl.Blocks) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	for _, block := range blocks {
+		if len(block.Labels) == 0 {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Missing step template name",
+				Detail:   "A step_template block must have a label naming it.",
+				Subject:  block.DefRange.Ptr(),
+			})
+			continue
+		}
+		name := block.Labels[0]
+
+		if prev, exists := ts.StepTemplates[name]; exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate step template",
+				Detail:   fmt.Sprintf("A step template named %q was already declared at %s.", name, prev.DeclRange),
+				Subject:  block.DefRange.Ptr(),
+			})
+			continue
+		}
+
+		content, _, _ := block.Body.PartialContent(useSchema)
+		if attr, ok := content.Attributes["use"]; ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Nested step template",
+				Detail:   "A step template cannot use another template.",
+				Subject:  attr.NameRange.Ptr(),
+			})
+			continue
+		}
+
+		ts.StepTemplates[name] = &StepTemplate{
+			Name:      name,
+			Body:      block.Body,
+			DeclRange: block.DefRange,
+			srcRange:  hcl.RangeBetween(block.DefRange, block.Body.MissingItemRange()),
+		}
+	}
+	return diags
+}
+
+// useTemplate returns the template named by the use attribute of a step.
+func (ts *TestSuite) useTemplate(attr *hcl.Attribute, ctx *hcl.EvalContext) (*StepTemplate, hcl.Diagnostics) {
+	var name string
+	diags := gohcl.DecodeExpression(attr.Expr, ctx, &name)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	tmpl, exists := ts.StepTemplates[name]
+	if !exists {
+		names := make([]string, 0, len(ts.StepTemplates))
+		for name := range ts.StepTemplates {
+			names = append(names, name)
+		}
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Unknown step template",
+			Detail:   fmt.Sprintf("There is no step template named %q.%s", name, didYouMean(name, names)),
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+	}
+	return tmpl, diags
+}
+
+// annotateTemplate adds the other half of the picture to the diagnostics of
+// a step that uses a template: the use site to those raised within the
+// template, since the template alone does not say which step was being
+// decoded or run, and the template to the rest.
+func (s *TestStep) annotateTemplate(diags hcl.Diagnostics) hcl.Diagnostics {
+	if s.template == nil {
+		return diags
+	}
+	for _, diag := range diags {
+		if diag.Subject != nil && rangeWithin(*diag.Subject, s.template.srcRange) {
+			diag.Detail += fmt.Sprintf("\n\nThis is part of step template %q, which is used by the step at %s.", s.template.Name, s.useRange)
+		} else {
+			diag.Detail += fmt.Sprintf("\n\nThe step uses step template %q, declared at %s.", s.template.Name, s.template.DeclRange)
+		}
+	}
+	return diags
+}
+
+func rangeWithin(inner, outer hcl.Range) bool {
+	return inner.Filename == outer.Filename &&
+		inner.Start.Byte >= outer.Start.Byte &&
+		inner.End.Byte <= outer.End.Byte
+}
+
+// templateBody is the body of a step that uses a template. Like the bodies
+// returned by hcl.MergeBodies it combines the content of both bodies, with
+// the blocks of the template before those of the step, except that an
+// attribute set by both is taken from the step rather than being an error.
+type templateBody struct {
+	template hcl.Body
+	step     hcl.Body
+}
+
+func (b *templateBody) Content(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	relaxed := relaxedSchema(schema)
+	templateContent, diags := b.template.Content(relaxed)
+	stepContent, d := b.step.Content(relaxed)
+	diags = append(diags, d...)
+	return b.merge(schema, templateContent, stepContent, diags)
+}
+
+func (b *templateBody) PartialContent(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Body, hcl.Diagnostics) {
+	relaxed := relaxedSchema(schema)
+	templateContent, templateRemain, diags := b.template.PartialContent(relaxed)
+	stepContent, stepRemain, d := b.step.PartialContent(relaxed)
+	diags = append(diags, d...)
+	content, diags := b.merge(schema, templateContent, stepContent, diags)
+	return content, &templateBody{template: templateRemain, step: stepRemain}, diags
+}
+
+func (b *templateBody) JustAttributes() (hcl.Attributes, hcl.Diagnostics) {
+	templateAttrs, diags := b.template.JustAttributes()
+	stepAttrs, d := b.step.JustAttributes()
+	diags = append(diags, d...)
+
+	attrs := make(hcl.Attributes, len(templateAttrs)+len(stepAttrs))
+	for name, attr := range templateAttrs {
+		attrs[name] = attr
+	}
+	for name, attr := range stepAttrs {
+		attrs[name] = attr
+	}
+	return attrs, diags
+}
+
+func (b *templateBody) MissingItemRange() hcl.Range {
+	return b.step.MissingItemRange()
+}
+
+// merge combines the content of the template and the step. Required
+// attributes are checked here, since either body may set them.
+func (b *templateBody) merge(schema *hcl.BodySchema, template, step *hcl.BodyContent, diags hcl.Diagnostics) (*hcl.BodyContent, hcl.Diagnostics) {
+	content := &hcl.BodyContent{
+		Attributes:       make(hcl.Attributes, len(template.Attributes)+len(step.Attributes)),
+		MissingItemRange: step.MissingItemRange,
+	}
+	for name, attr := range template.Attributes {
+		content.Attributes[name] = attr
+	}
+	for name, attr := range step.Attributes {
+		content.Attributes[name] = attr
+	}
+	content.Blocks = append(content.Blocks, template.Blocks...)
+	content.Blocks = append(content.Blocks, step.Blocks...)
+
+	for _, attrS := range schema.Attributes {
+		if _, exists := content.Attributes[attrS.Name]; attrS.Required && !exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Missing required argument",
+				Detail:   fmt.Sprintf("The argument %q is required, but no definition was found in the step or its template.", attrS.Name),
+				Subject:  step.MissingItemRange.Ptr(),
+			})
+		}
+	}
+	return content, diags
+}
+
+// overrides reports whether rng lies within an attribute of the template
+// that the step overrides, so that its expressions are never evaluated.
+func (b *templateBody) overrides(rng hcl.Range) bool {
+	templateRanges := attributeRanges(b.template)
+	for name := range attributeRanges(b.step) {
+		if attrRange, exists := templateRanges[name]; exists && rangeWithin(rng, attrRange) {
+			return true
+		}
+	}
+	return false
+}
+
+// attributeRanges returns the ranges of the attributes of body by name.
+func attributeRanges(body hcl.Body) map[string]hcl.Range {
+	ranges := make(map[string]hcl.Range)
+	if sb, ok := body.(*hclsyntax.Body); ok {
+		// JustAttributes rejects native bodies with blocks.
+		for name, attr := range sb.Attributes {
+			ranges[name] = attr.SrcRange
+		}
+		return ranges
+	}
+	attrs, _ := body.JustAttributes()
+	for name, attr := range attrs {
+		ranges[name] = attr.Range
+	}
+	return ranges
+}
+
+func relaxedSchema(schema *hcl.BodySchema) *hcl.BodySchema {
+	relaxed := &hcl.BodySchema{
+		Attributes: make([]hcl.AttributeSchema, len(schema.Attributes)),
+		Blocks:     schema.Blocks,
+	}
+	for i, attrS := range schema.Attributes {
+		relaxed.Attributes[i] = hcl.AttributeSchema{Name: attrS.Name}
+	}
+	return relaxed
+}
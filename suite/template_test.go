@@ -0,0 +1,142 @@
+package suite
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestStepTemplate(t *testing.T) {
+	dir := writeSuite(t, map[string]string{"out.txt": "hello\n"})
+	l := NewLoader()
+	l.SetVariable("base", cty.StringVal(dir))
+	ts := loadSuite(t, l, `
+suitename = "s"
+
+variable "base" {}
+
+step_template "hello" {
+  type    = "file"
+  path    = "${base}/out.txt"
+  content = "bye\n"
+
+  assert {
+    condition = self.exists
+  }
+}
+
+step_template "bare" {
+  type = "file"
+}
+
+testcase "c" {
+  step "override" {
+    use     = "hello"
+    content = "hello\n"
+
+    assert {
+      condition = self.size == 6
+    }
+  }
+
+  step "inherit" {
+    use = "hello"
+  }
+
+  step "own" {
+    use  = "hello"
+    path = "${base}/missing.txt"
+  }
+
+  step "bare" {
+    use = "bare"
+  }
+}
+`)
+
+	result := (&Runner{Suite: ts}).Run(context.Background())
+	got := make(map[string][]string)
+	details := make(map[string]string)
+	for _, sr := range result.Cases[0].Steps {
+		got[sr.Step.ID()] = diagSummaries(sr.Diagnostics)
+		if len(sr.Diagnostics) > 0 {
+			details[sr.Step.ID()] = sr.Diagnostics[0].Detail
+		}
+	}
+	want := map[string][]string{
+		"override": nil,
+		"inherit":  {"Unexpected file content"},
+		"own":      {"File does not exist", "Assertion failed"},
+		"bare":     {"Missing required argument"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors %q, want %q", got, want)
+	}
+
+	// The content that does not match comes from the template, while the
+	// missing file is the step's own.
+	if want := `This is part of step template "hello", which is used by the step at `; !strings.Contains(details["inherit"], want) {
+		t.Errorf("got detail %q, want it to contain %q", details["inherit"], want)
+	}
+	if want := `The step uses step template "hello", declared at `; !strings.Contains(details["own"], want) {
+		t.Errorf("got detail %q, want it to contain %q", details["own"], want)
+	}
+	if want := "no definition was found in the step or its template."; !strings.Contains(details["bare"], want) {
+		t.Errorf("got detail %q, want it to contain %q", details["bare"], want)
+	}
+}
+
+func TestStepTemplateDiagnostics(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "unknown template",
+			src: `
+suitename = "s"
+step_template "hello" {}
+testcase "c" {
+  step "a" {
+    use = "helo"
+  }
+}
+`,
+			want: []string{"Unknown step template"},
+		},
+		{
+			name: "duplicate template",
+			src: `
+suitename = "s"
+step_template "a" {}
+step_template "a" {}
+`,
+			want: []string{"Duplicate step template"},
+		},
+		{
+			name: "nested template",
+			src: `
+suitename = "s"
+step_template "a" {}
+step_template "b" {
+  use = "a"
+}
+`,
+			want: []string{"Nested step template"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := writeSuite(t, map[string]string{"suite.hcl": test.src})
+			_, diags := NewLoader().Load(dir)
+			if got := diagSummaries(diags); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got errors %q, want %q\n%s", got, test.want, diags.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,504 @@
+package suite
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// validateScope is the set of names an expression may refer to.
+type validateScope struct {
+	variables map[string]*Variable
+	locals    map[string]*Local
+
+	// fixtures maps each fixture name to its attribute names. It is nil
+	// where fixtures are not in scope.
+	fixtures map[string]map[string]bool
+
+	// steps is true where step results are in scope. References to
+	// individual steps are checked when the dependency graph is built.
+	steps bool
+
+	// each is true within testcases expanded by for_each or a matrix.
+	each bool
+
+	// self is true where a step's own results are in scope, as in its
+	// snapshot blocks. Within the rest of a step's body they are only in
+	// scope within selfRanges: its assert blocks and the attributes its
+	// type evaluates with self.
+	self       bool
+	selfRanges []hcl.Range
+
+	// inputs holds the input names of the module whose steps and fixtures
+	// are being checked. It is nil outside modules.
+	inputs map[string]bool
+
+	// modules maps the name of each module of the testcase to its output
+	// names. It is nil where module outputs are not in scope.
+	modules map[string]map[string]bool
+}
+
+// Validate statically checks the expressions of every fixture, step and
+// module in the suite without evaluating them. It reports references to undeclared
+// variables, locals, fixtures and fixture attributes, and calls to unknown
+// functions. Dependency and cycle errors are reported by Load.
+func (ts *TestSuite) Validate() hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	fixtureAttrs := make(map[*TestCaseFixture]map[string]bool, len(ts.Fixtures))
+	validateFixture := func(fixture *TestCaseFixture, fixtureScope *validateScope) {
+		content, d := freeFormContent(fixture.Config)
+		diags = append(diags, d...)
+
+		// Nested blocks are attributes of the fixture too, including
+		// those generated by dynamic blocks.
+		names := make(map[string]bool, len(content.Attributes)+len(content.Blocks))
+		for name := range content.Attributes {
+			names[name] = true
+		}
+		for _, block := range content.Blocks {
+			if block.Type == "dynamic" && len(block.Labels) == 1 {
+				names[block.Labels[0]] = true
+			} else {
+				names[block.Type] = true
+			}
+		}
+		fixtureAttrs[fixture] = names
+
+		diags = append(diags, validateBody(fixture.Config, fixtureScope)...)
+	}
+
+	// The suite's fixtures are checked once rather than for each testcase.
+	for _, fixture := range ts.Fixtures {
+		validateFixture(fixture, &validateScope{variables: ts.Variables, locals: ts.Locals})
+	}
+
+	for _, tc := range ts.TestCases {
+		each := tc.each != cty.NilVal
+		for _, fixture := range tc.Fixtures {
+			validateFixture(fixture, &validateScope{variables: ts.Variables, locals: ts.Locals, each: each})
+		}
+
+		stepScope := &validateScope{
+			variables: ts.Variables,
+			locals:    ts.Locals,
+			fixtures:  make(map[string]map[string]bool, len(ts.Fixtures)+len(tc.Fixtures)),
+			steps:     true,
+			each:      each,
+		}
+		for _, fixture := range ts.CaseFixtures(tc) {
+			stepScope.fixtures[fixture.Name] = fixtureAttrs[fixture]
+		}
+
+		stepScope.modules = make(map[string]map[string]bool, len(tc.Modules))
+		for _, m := range tc.Modules {
+			outputs := make(map[string]bool, len(m.outputs))
+			for name := range m.outputs {
+				outputs[name] = true
+			}
+			stepScope.modules[m.Name] = outputs
+		}
+
+		for _, step := range tc.TestSteps {
+			if step.module == nil {
+				diags = append(diags, validateStep(step, stepScope)...)
+			}
+		}
+
+		for _, m := range tc.Modules {
+			diags = append(diags, validateBody(m.body, stepScope)...)
+
+			inputs := make(map[string]bool, len(m.inputs))
+			for name := range m.inputs {
+				inputs[name] = true
+			}
+			moduleScope := &validateScope{
+				variables: ts.Variables,
+				locals:    ts.Locals,
+				fixtures:  make(map[string]map[string]bool, len(m.Fixtures)),
+				steps:     true,
+				each:      each,
+				inputs:    inputs,
+			}
+			for _, fixture := range m.Fixtures {
+				validateFixture(fixture, &validateScope{variables: ts.Variables, locals: ts.Locals, each: each, inputs: inputs})
+				moduleScope.fixtures[fixture.Name] = fixtureAttrs[fixture]
+			}
+			for _, step := range m.Steps {
+				diags = append(diags, validateStep(step, moduleScope)...)
+			}
+			for _, name := range m.OutputNames() {
+				diags = append(diags, validateExpr(m.outputs[name].expr, moduleScope)...)
+			}
+		}
+	}
+
+	// The instances of an expanded testcase share their bodies, so their
+	// diagnostics are only reported once.
+	diags = uniqueDiagnostics(diags, make(map[string]bool))
+	return annotateIncludes(ts.includedFrom, diags)
+}
+
+// validateStep checks the body and snapshot blocks of step, which may refer
+// to the step's results as self only where its type evaluates them.
+func validateStep(step *TestStep, scope *validateScope) hcl.Diagnostics {
+	selfBlocks := []string{"snapshot"}
+	var selfAttrs []string
+	if schema := StepSchema(step.Type); schema != nil {
+		for _, block := range schema.Blocks {
+			if block.Type == "assert" {
+				selfBlocks = append(selfBlocks, block.Type)
+			}
+		}
+	}
+	if stepType, ok := stepTypes[step.Type].(selfAttributer); ok {
+		selfAttrs = stepType.selfAttributes()
+	}
+	bodyScope := *scope
+	bodyScope.selfRanges = selfRanges(step.Config, selfBlocks, selfAttrs)
+	diags := validateBody(step.Config, &bodyScope)
+
+	snapshotScope := *scope
+	snapshotScope.self = true
+	for _, snap := range step.snapshots {
+		diags = append(diags, validateExpr(snap.name, &snapshotScope)...)
+		diags = append(diags, validateExpr(snap.value, &snapshotScope)...)
+	}
+	return step.annotateTemplate(diags)
+}
+
+// selfRanges returns the ranges of the blocks of a step body with a type in
+// blockTypes and of its attributes named in attrNames, where the step's
+// results are in scope.
+func selfRanges(body hcl.Body, blockTypes, attrNames []string) []hcl.Range {
+	var ranges []hcl.Range
+	switch body := body.(type) {
+	case *templateBody:
+		return append(selfRanges(body.template, blockTypes, attrNames), selfRanges(body.step, blockTypes, attrNames)...)
+	case *hclsyntax.Body:
+		for _, block := range body.Blocks {
+			blockType := block.Type
+			if blockType == "dynamic" && len(block.Labels) == 1 {
+				blockType = block.Labels[0]
+			}
+			if containsString(blockTypes, blockType) {
+				ranges = append(ranges, block.Range())
+			}
+		}
+		for name, attr := range body.Attributes {
+			if containsString(attrNames, name) {
+				ranges = append(ranges, attr.SrcRange)
+			}
+		}
+	case hcl.Body:
+		// In JSON, blocks are attributes holding objects.
+		attrs, _ := body.JustAttributes()
+		for name, attr := range attrs {
+			if containsString(blockTypes, name) || containsString(attrNames, name) {
+				ranges = append(ranges, attr.Range)
+			}
+		}
+	}
+	return ranges
+}
+
+func validateBody(body hcl.Body, scope *validateScope) hcl.Diagnostics {
+	return scope.validate(bodyTraversals(body), bodyFunctionCalls(body))
+}
+
+// validateExpr is validateBody for a single expression.
+func validateExpr(expr hcl.Expression, scope *validateScope) hcl.Diagnostics {
+	var traversals []hcl.Traversal
+	for _, traversal := range expr.Variables() {
+		traversals = append(traversals, relocateJSONTraversal(traversal, expr.Range()))
+	}
+
+	var calls []*hclsyntax.FunctionCallExpr
+	if syntaxExpr, ok := expr.(hclsyntax.Expression); ok {
+		hclsyntax.VisitAll(syntaxExpr, func(n hclsyntax.Node) hcl.Diagnostics {
+			if call, ok := n.(*hclsyntax.FunctionCallExpr); ok {
+				calls = append(calls, call)
+			}
+			return nil
+		})
+	}
+	return scope.validate(traversals, calls)
+}
+
+func (scope *validateScope) validate(traversals []hcl.Traversal, calls []*hclsyntax.FunctionCallExpr) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for _, traversal := range traversals {
+		diags = append(diags, scope.validateTraversal(traversal)...)
+	}
+
+	for _, call := range calls {
+		if _, exists := Functions[call.Name]; exists {
+			continue
+		}
+
+		names := make([]string, 0, len(Functions))
+		for name := range Functions {
+			names = append(names, name)
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Call to unknown function",
+			Detail:   fmt.Sprintf("There is no function named %q.%s", call.Name, didYouMean(call.Name, names)),
+			Subject:  call.NameRange.Ptr(),
+			Context:  call.Range().Ptr(),
+		})
+	}
+
+	return diags
+}
+
+func (scope *validateScope) validateTraversal(traversal hcl.Traversal) hcl.Diagnostics {
+	root := traversal.RootName()
+
+	if _, exists := scope.variables[root]; exists {
+		return nil
+	}
+
+	switch {
+	case root == "local":
+		return scope.validateLocalTraversal(traversal)
+	case root == "step" && scope.steps:
+		return nil
+	case root == "each" && scope.each:
+		return nil
+	case root == "self" && scope.allowsSelf(traversal.SourceRange()):
+		return nil
+	case root == "self":
+		return hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid reference to self",
+				Detail:   "self refers to the results of a step, so it can only be used where the step has already run, as in its assert and snapshot blocks.",
+				Subject:  traversal[0].SourceRange().Ptr(),
+			},
+		}
+	case root == "fixture" && scope.fixtures != nil:
+		return scope.validateFixtureTraversal(traversal)
+	case root == "input" && scope.inputs != nil:
+		return scope.validateInputTraversal(traversal)
+	case root == "module" && scope.modules != nil:
+		return scope.validateModuleTraversal(traversal)
+	}
+
+	names := make([]string, 0, len(scope.variables)+7)
+	for name := range scope.variables {
+		names = append(names, name)
+	}
+	if len(scope.locals) > 0 {
+		names = append(names, "local")
+	}
+	if scope.fixtures != nil {
+		names = append(names, "fixture")
+	}
+	if scope.steps {
+		names = append(names, "step")
+	}
+	if scope.each {
+		names = append(names, "each")
+	}
+	if scope.self {
+		names = append(names, "self")
+	}
+	if scope.inputs != nil {
+		names = append(names, "input")
+	}
+	if len(scope.modules) > 0 {
+		names = append(names, "module")
+	}
+
+	return hcl.Diagnostics{
+		{
+			Severity: hcl.DiagError,
+			Summary:  "Unknown variable",
+			Detail:   fmt.Sprintf("There is no variable named %q.%s", root, didYouMean(root, names)),
+			Subject:  traversal[0].SourceRange().Ptr(),
+		},
+	}
+}
+
+// allowsSelf reports whether an expression at rng may refer to self.
+func (scope *validateScope) allowsSelf(rng hcl.Range) bool {
+	if scope.self {
+		return true
+	}
+	for _, selfRange := range scope.selfRanges {
+		if selfRange.Filename == rng.Filename && selfRange.ContainsOffset(rng.Start.Byte) {
+			return true
+		}
+	}
+	return false
+}
+
+func (scope *validateScope) validateLocalTraversal(traversal hcl.Traversal) hcl.Diagnostics {
+	if len(traversal) < 2 {
+		return nil
+	}
+	nameStep, ok := traversal[1].(hcl.TraverseAttr)
+	if !ok {
+		return nil
+	}
+	if _, exists := scope.locals[nameStep.Name]; exists {
+		return nil
+	}
+
+	names := make([]string, 0, len(scope.locals))
+	for name := range scope.locals {
+		names = append(names, name)
+	}
+	return hcl.Diagnostics{
+		{
+			Severity: hcl.DiagError,
+			Summary:  "Unknown local value",
+			Detail:   fmt.Sprintf("There is no local value named %q.%s", nameStep.Name, didYouMean(nameStep.Name, names)),
+			Subject:  hcl.RangeBetween(traversal[0].SourceRange(), nameStep.SrcRange).Ptr(),
+		},
+	}
+}
+
+func (scope *validateScope) validateFixtureTraversal(traversal hcl.Traversal) hcl.Diagnostics {
+	if len(traversal) < 2 {
+		return nil
+	}
+	nameStep, ok := traversal[1].(hcl.TraverseAttr)
+	if !ok {
+		return nil
+	}
+
+	attrs, exists := scope.fixtures[nameStep.Name]
+	if !exists {
+		names := make([]string, 0, len(scope.fixtures))
+		for name := range scope.fixtures {
+			names = append(names, name)
+		}
+		return hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  "Unknown fixture",
+				Detail:   fmt.Sprintf("This testcase has no fixture named %q.%s", nameStep.Name, didYouMean(nameStep.Name, names)),
+				Subject:  hcl.RangeBetween(traversal[0].SourceRange(), nameStep.SrcRange).Ptr(),
+			},
+		}
+	}
+
+	if len(traversal) < 3 {
+		return nil
+	}
+	attrStep, ok := traversal[2].(hcl.TraverseAttr)
+	if !ok || attrs[attrStep.Name] {
+		return nil
+	}
+
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	return hcl.Diagnostics{
+		{
+			Severity: hcl.DiagError,
+			Summary:  "Unknown fixture attribute",
+			Detail:   fmt.Sprintf("Fixture %q has no attribute named %q.%s", nameStep.Name, attrStep.Name, didYouMean(attrStep.Name, names)),
+			Subject:  hcl.RangeBetween(traversal[0].SourceRange(), attrStep.SrcRange).Ptr(),
+		},
+	}
+}
+
+func (scope *validateScope) validateInputTraversal(traversal hcl.Traversal) hcl.Diagnostics {
+	if len(traversal) < 2 {
+		return nil
+	}
+	nameStep, ok := traversal[1].(hcl.TraverseAttr)
+	if !ok || scope.inputs[nameStep.Name] {
+		return nil
+	}
+
+	names := make([]string, 0, len(scope.inputs))
+	for name := range scope.inputs {
+		names = append(names, name)
+	}
+	return hcl.Diagnostics{
+		{
+			Severity: hcl.DiagError,
+			Summary:  "Unknown module input",
+			Detail:   fmt.Sprintf("This module has no input named %q.%s", nameStep.Name, didYouMean(nameStep.Name, names)),
+			Subject:  hcl.RangeBetween(traversal[0].SourceRange(), nameStep.SrcRange).Ptr(),
+		},
+	}
+}
+
+// validateModuleTraversal checks the output named by a reference to a
+// module. References to unknown modules are reported when the dependency
+// graph is built.
+func (scope *validateScope) validateModuleTraversal(traversal hcl.Traversal) hcl.Diagnostics {
+	if len(traversal) < 3 {
+		return nil
+	}
+	nameStep, ok := traversal[1].(hcl.TraverseAttr)
+	if !ok {
+		return nil
+	}
+	outputs, exists := scope.modules[nameStep.Name]
+	if !exists {
+		return nil
+	}
+	outputStep, ok := traversal[2].(hcl.TraverseAttr)
+	if !ok || outputs[outputStep.Name] {
+		return nil
+	}
+
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	return hcl.Diagnostics{
+		{
+			Severity: hcl.DiagError,
+			Summary:  "Unknown module output",
+			Detail:   fmt.Sprintf("Module %q has no output named %q.%s", nameStep.Name, outputStep.Name, didYouMean(outputStep.Name, names)),
+			Subject:  hcl.RangeBetween(traversal[0].SourceRange(), outputStep.SrcRange).Ptr(),
+		},
+	}
+}
+
+// bodyFunctionCalls returns every function call made by the expressions
+// within body, including those in nested blocks. The calls in the string
+// templates of JSON bodies are positioned at the attributes holding them.
+func bodyFunctionCalls(body hcl.Body) []*hclsyntax.FunctionCallExpr {
+	if tb, ok := body.(*templateBody); ok {
+		var calls []*hclsyntax.FunctionCallExpr
+		for _, call := range bodyFunctionCalls(tb.template) {
+			if !tb.overrides(call.Range()) {
+				calls = append(calls, call)
+			}
+		}
+		return append(calls, bodyFunctionCalls(tb.step)...)
+	}
+
+	var calls []*hclsyntax.FunctionCallExpr
+	if sb, ok := body.(*hclsyntax.Body); ok {
+		hclsyntax.VisitAll(sb, func(n hclsyntax.Node) hcl.Diagnostics {
+			if call, ok := n.(*hclsyntax.FunctionCallExpr); ok {
+				calls = append(calls, call)
+			}
+			return nil
+		})
+	} else if body != nil {
+		attrs, _ := body.JustAttributes()
+		for _, attr := range attrs {
+			calls = append(calls, jsonFunctionCalls(attr.Expr)...)
+		}
+	}
+
+	sort.SliceStable(calls, func(i, j int) bool {
+		return calls[i].NameRange.Start.Byte < calls[j].NameRange.Start.Byte
+	})
+	return calls
+}
@@ -0,0 +1,198 @@
+package suite
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateSelf(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "assert and snapshot",
+			files: map[string]string{"suite.hcl": `
+suitename = "s"
+
+testcase "c" {
+  step "h" {
+    type = "http"
+    url  = "http://localhost"
+
+    assert {
+      condition = self.status == 200
+    }
+
+    snapshot {
+      name  = "h"
+      value = self.body
+    }
+  }
+}
+`},
+		},
+		{
+			name: "wait condition",
+			files: map[string]string{"suite.hcl": `
+suitename = "s"
+
+testcase "c" {
+  step "w" {
+    type      = "wait"
+    http      = "http://localhost"
+    condition = self.status == 200
+  }
+}
+`},
+		},
+		{
+			name: "step attributes",
+			files: map[string]string{"suite.hcl": `
+suitename = "s"
+
+testcase "c" {
+  step "h" {
+    type = "http"
+    url  = self.status
+  }
+
+  step "w" {
+    type      = "wait"
+    tcp       = "localhost:80"
+    timeout   = self.timeout
+  }
+}
+`},
+			want: []string{"Invalid reference to self", "Invalid reference to self"},
+		},
+		{
+			name: "free-form assert block",
+			files: map[string]string{"suite.hcl": `
+suitename = "s"
+
+testcase "c" {
+  step "n" {
+    assert {
+      condition = self.ok
+    }
+  }
+}
+`},
+			want: []string{"Invalid reference to self"},
+		},
+		{
+			name: "fixture",
+			files: map[string]string{"suite.hcl": `
+suitename = "s"
+
+testcase "c" {
+  fixture "f" {
+    value = self.value
+  }
+}
+`},
+			want: []string{"Invalid reference to self"},
+		},
+		{
+			name: "json",
+			files: map[string]string{"suite.hcl.json": `{
+  "suitename": "s",
+  "testcase": {
+    "c": {
+      "step": {
+        "h": {
+          "type": "http",
+          "url": "${self.status}",
+          "assert": {"condition": "${self.status == 200}"}
+        }
+      }
+    }
+  }
+}
+`},
+			want: []string{"Invalid reference to self"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ts, diags := NewLoader().Load(writeSuite(t, test.files))
+			if diags.HasErrors() {
+				t.Fatal(diags.Error())
+			}
+			diags = ts.Validate()
+			if got := diagSummaries(diags); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got errors %q, want %q\n%s", got, test.want, diags.Error())
+			}
+		})
+	}
+}
+
+func TestValidateFunctionCalls(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "native",
+			files: map[string]string{"suite.hcl": `
+suitename = "s"
+
+testcase "c" {
+  step "a" {
+    value = upper("a")
+
+    assert {
+      condition = lenght("a") == 1
+    }
+  }
+}
+`},
+			want: []string{"Call to unknown function at suite.hcl:9,19-25"},
+		},
+		{
+			name: "json",
+			files: map[string]string{"suite.hcl.json": `{
+  "suitename": "s",
+  "testcase": {
+    "c": {
+      "step": {
+        "a": {
+          "value": ["${upper(\"a\")}", {"b": "${lowr(\"B\")}"}],
+          "assert": {"condition": "${lenght(\"a\") == 1}"}
+        }
+      }
+    }
+  }
+}
+`},
+			want: []string{
+				"Call to unknown function at suite.hcl.json:7,20-64",
+				"Call to unknown function at suite.hcl.json:8,21-59",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := writeSuite(t, test.files)
+			ts, diags := NewLoader().Load(dir)
+			if diags.HasErrors() {
+				t.Fatal(diags.Error())
+			}
+			var got []string
+			for _, diag := range ts.Validate() {
+				rel, _ := filepath.Rel(dir, diag.Subject.Filename)
+				got = append(got, fmt.Sprintf("%s at %s:%d,%d-%d", diag.Summary, rel, diag.Subject.Start.Line, diag.Subject.Start.Column, diag.Subject.End.Column))
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}